@@ -0,0 +1,290 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/manojnakp/scount/api/internal"
+	"github.com/manojnakp/scount/db"
+)
+
+// ActivitySchema is the location for `Activity` JSON schema.
+const ActivitySchema = "/schema/Activity.json"
+
+// ErrActivityQuery defines parsing errors for ActivityQuery.
+var ErrActivityQuery = errors.New("invalid activity query parameters")
+
+// ActivitySorter is the default sort order for activity queries, newest
+// first.
+var ActivitySorter = []db.Sorter{
+	{
+		Column: "time",
+		Desc:   true,
+	},
+}
+
+// Activity describes the activity resource, that is an entry of the
+// activity feed of a scount. Before and After are the changed resource
+// (Target) either side of the change, if any.
+// schema is defined at `Activity.json`.
+type Activity struct {
+	Schema string          `json:"$schema,omitempty"`
+	Id     string          `json:"id"`
+	Scount string          `json:"scount"`
+	Actor  string          `json:"actor"`
+	Kind   db.ActivityKind `json:"kind"`
+	Target string          `json:"target"`
+	Time   time.Time       `json:"time"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// NewActivity constructs the activity resource from db.Activity.
+func NewActivity(activity db.Activity) Activity {
+	return Activity{
+		Schema: ActivitySchema,
+		Id:     activity.Aid,
+		Scount: activity.Sid,
+		Actor:  activity.Actor,
+		Kind:   activity.Kind,
+		Target: activity.Target,
+		Time:   activity.Time,
+		Before: activity.Before,
+		After:  activity.After,
+	}
+}
+
+// ActivityQuery describes the url query parameters
+// used for filtering the activity feed of a scount.
+// schema is defined at `ActivityQuery.json`.
+type ActivityQuery struct {
+	Actor  string
+	Kind   db.ActivityKind
+	Target string
+	Sort   []db.Sorter
+	Paging Paginator
+}
+
+// ParseActivityQuery parses the query parameters on activity collection resource.
+func ParseActivityQuery(query url.Values) (*ActivityQuery, error) {
+	paging, err := ParsePaginator(query)
+	if err != nil {
+		return nil, err
+	}
+	list, err := internal.ParseSort(query.Get("sort"), internal.ActivitySortMap)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid 'sort' parameter: %w", ErrActivityQuery, err)
+	}
+	// fallback to default sorter
+	if len(list) == 0 {
+		list = ActivitySorter
+	}
+	return &ActivityQuery{
+		Actor:  query.Get("actor"),
+		Kind:   db.ActivityKind(query.Get("kind")),
+		Target: query.Get("target"),
+		Sort:   list,
+		Paging: paging,
+	}, nil
+}
+
+// ActivityResource is the http.Handler for the activity feed of a scount.
+//
+// Pre-requisite: ScountKey, AuthUserKey and AccessKey should be present
+// in request context.
+type ActivityResource struct {
+	DB *db.Store
+}
+
+// Router constructs a new chi.Router for the ActivityResource.
+func (res ActivityResource) Router() chi.Router {
+	r := chi.NewRouter()
+	r.With(QueryParser(ParseActivityQuery)).
+		Get("/", res.ListActivity)
+	return r
+}
+
+// ServeHTTP implements http.Handler on ActivityResource.
+func (res ActivityResource) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	mux := res.Router()
+	mux.ServeHTTP(w, r)
+}
+
+// ListActivity handles GET requests at `/scounts/{sid}/activity`.
+func (res ActivityResource) ListActivity(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx   = r.Context()
+		sid   = ctx.Value(ScountKey).(string)
+		query = ctx.Value(QueryKey).(*ActivityQuery)
+	)
+	projector, err := query.Paging.Projector(query.Sort, db.ActivityKeyCols)
+	if err != nil {
+		ProblemInvalidQuery.With(err.Error()).Write(w)
+		return
+	}
+	// database call
+	activities, err := res.DB.Activities.Find(
+		ctx,
+		&db.ActivityFilter{Sid: sid, Actor: query.Actor, Kind: query.Kind, Target: query.Target},
+		projector,
+	)
+	switch {
+	case errors.Is(err, db.ErrInvalidColumn):
+		ProblemInvalidColumn.Write(w)
+		return
+	case err != nil:
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	page, err := PageOf(path.Join("/scounts", sid, "activity"), r.URL.Query(), query.Paging, projector, activities)
+	if err != nil {
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	// build response collection
+	list := make([]Activity, 0, len(page.Items))
+	for _, activity := range page.Items {
+		list = append(list, NewActivity(activity))
+	}
+	page.Header(w)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(list)
+}
+
+// Viewer gives the resource changed by an activity as found in store,
+// nil if not found. See Track.
+type Viewer func(store *db.Store) (any, error)
+
+// Track runs change on store as a unit of work along with recording the
+// activity of kind on target within scount sid by the current user (from
+// AuthUserKey). The values before and after the change are given by
+// view, so that creations have none before and deletions none after.
+// Errors of change are returned as is.
+func Track(
+	ctx context.Context,
+	store *db.Store,
+	sid string,
+	kind db.ActivityKind,
+	target string,
+	view Viewer,
+	change func(tx *db.Store) error,
+) error {
+	return store.WithTx(ctx, func(tx *db.Store) error {
+		before, err := view(tx)
+		if err != nil {
+			return err
+		}
+		err = change(tx)
+		if err != nil {
+			return err
+		}
+		after, err := view(tx)
+		if err != nil {
+			return err
+		}
+		return Record(ctx, tx, sid, kind, target, before, after)
+	})
+}
+
+// Record appends the activity of kind on target within scount sid by the
+// current user (from AuthUserKey) to store, with before and after values
+// (if not nil) encoded as JSON. It is meant to run in the same unit of
+// work as the change, see Track.
+func Record(
+	ctx context.Context,
+	store *db.Store,
+	sid string,
+	kind db.ActivityKind,
+	target string,
+	before, after any,
+) error {
+	activity := db.Activity{
+		Aid:    GenerateID(),
+		Sid:    sid,
+		Actor:  ctx.Value(AuthUserKey).(string),
+		Kind:   kind,
+		Target: target,
+		Time:   time.Now(),
+	}
+	var err error
+	activity.Before, err = encode(before)
+	if err != nil {
+		return err
+	}
+	activity.After, err = encode(after)
+	if err != nil {
+		return err
+	}
+	return store.Activities.Insert(ctx, activity)
+}
+
+// encode gives value as JSON, nil if value is nil.
+func encode(value any) (json.RawMessage, error) {
+	if value == nil {
+		return nil, nil
+	}
+	return json.Marshal(value)
+}
+
+// missing gives no resource for db.ErrNoRows, otherwise err. See Viewer.
+func missing(err error) (any, error) {
+	if errors.Is(err, db.ErrNoRows) {
+		return nil, nil
+	}
+	return nil, err
+}
+
+// viewScount constructs the Viewer of the scount by id.
+func viewScount(ctx context.Context, id *db.ScountId) Viewer {
+	return func(store *db.Store) (any, error) {
+		scount, err := store.Scounts.FindOne(ctx, id)
+		if err != nil {
+			return missing(err)
+		}
+		return NewScount(scount), nil
+	}
+}
+
+// viewMember constructs the Viewer of the member by id.
+func viewMember(ctx context.Context, id *db.MemberId) Viewer {
+	return func(store *db.Store) (any, error) {
+		member, err := store.Members.FindOne(ctx, id)
+		if err != nil {
+			return missing(err)
+		}
+		return NewMember(member), nil
+	}
+}
+
+// viewExpense constructs the Viewer of the expense by id.
+func viewExpense(ctx context.Context, id *db.ExpenseId) Viewer {
+	return func(store *db.Store) (any, error) {
+		expense, err := store.Expenses.FindOne(ctx, id)
+		if err != nil {
+			return missing(err)
+		}
+		return NewExpense(expense), nil
+	}
+}
+
+// viewSettlement constructs the Viewer of the settlement by id.
+func viewSettlement(ctx context.Context, id *db.SettlementId) Viewer {
+	return func(store *db.Store) (any, error) {
+		settlement, err := store.Settlements.FindOne(ctx, id)
+		if err != nil {
+			return missing(err)
+		}
+		return NewSettlement(settlement), nil
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -18,10 +19,23 @@ var ErrPaginator = errors.New("invalid pagination parameter")
 // PageSize is the default number of items limit to a page.
 const PageSize = 10
 
-// Paginator represents the pagination query parameters.
+// MaxPageSize is the largest page size that may be requested, as per
+// `Paginator.json`.
+const MaxPageSize = 50
+
+// Paginator represents the pagination query parameters. Pages are
+// requested by number (offset mode) if Offset, that is unless `after` or
+// `before` is given. Otherwise pages are requested by the opaque cursors
+// After (or Before) from the links of the previous responses, an empty
+// `after` requesting the first page. Count requests the total number of
+// items, always counted in offset mode.
 type Paginator struct {
-	Page int
-	Size int
+	Page   int
+	Size   int
+	Offset bool
+	After  string
+	Before string
+	Count  bool
 }
 
 // DefaultPaginator is a paginator with default values.
@@ -41,10 +55,36 @@ func ParsePaginator(query url.Values) (Paginator, error) {
 		log.Println("failed to parse 'size' parameter", err)
 		return zero, fmt.Errorf("%w: 'size' not a number", ErrPaginator)
 	}
-	return Paginator{
-		Page: page,
-		Size: size,
-	}, nil
+	// offset of the page (page * size) fits an int
+	if page < 0 || size < 1 || size > MaxPageSize || page > math.MaxInt/size {
+		return zero, fmt.Errorf("%w: 'page' or 'size' out of range", ErrPaginator)
+	}
+	count := false
+	if s := query.Get("count"); s != "" {
+		count, err = strconv.ParseBool(s)
+		if err != nil {
+			return zero, fmt.Errorf("%w: 'count' not a boolean", ErrPaginator)
+		}
+	}
+	paginator := Paginator{
+		Page:   page,
+		Size:   size,
+		Offset: !query.Has("after") && !query.Has("before"),
+		After:  query.Get("after"),
+		Before: query.Get("before"),
+		Count:  count,
+	}
+	// at most one way of requesting a page
+	modes := 0
+	for _, name := range []string{"page", "after", "before"} {
+		if query.Has(name) {
+			modes++
+		}
+	}
+	if modes > 1 {
+		return zero, fmt.Errorf("%w: only one of 'page', 'after' and 'before'", ErrPaginator)
+	}
+	return paginator, nil
 }
 
 // WebLink defines a link as per [RFC8288].
@@ -29,12 +29,17 @@ type RegisterRequest struct {
 // Validate implements Validator on RegisterRequest.
 // Simply check non-empty.
 func (r RegisterRequest) Validate() error {
-	if r.Username == "" ||
-		r.Email == "" ||
-		r.Password == "" {
-		return errors.New("api: validation failed")
+	var invalid ValidationError
+	if r.Username == "" {
+		invalid.Add("username", "must not be empty")
 	}
-	return nil
+	if r.Email == "" {
+		invalid.Add("email", "must not be empty")
+	}
+	if r.Password == "" {
+		invalid.Add("password", "must not be empty")
+	}
+	return invalid.Err()
 }
 
 // RegisterResponse is the JSON response format
@@ -57,10 +62,14 @@ type LoginRequest struct {
 // Validate implements Validator on LoginRequest.
 // Simply check non-empty.
 func (r LoginRequest) Validate() error {
-	if r.Email == "" || r.Password == "" {
-		return errors.New("api: validation failed")
+	var invalid ValidationError
+	if r.Email == "" {
+		invalid.Add("email", "must not be empty")
 	}
-	return nil
+	if r.Password == "" {
+		invalid.Add("password", "must not be empty")
+	}
+	return invalid.Err()
 }
 
 // LoginResponse is the JSON response body format
@@ -72,7 +81,7 @@ type LoginResponse struct {
 }
 
 // PasswordChanger is the JSON request body format
-// at the `/auth/change` endpoint.
+// at the `/auth/password` endpoint (and its former alias `/auth/change`).
 type PasswordChanger struct {
 	// /schema/PasswordChanger.json
 	// Schema string `json:"$schema,omitempty"`
@@ -83,10 +92,14 @@ type PasswordChanger struct {
 // Validate implements Validator on PasswordChanger.
 // Simply check non-empty.
 func (r PasswordChanger) Validate() error {
-	if r.Old == "" || r.New == "" {
-		return errors.New("api: validation failed")
+	var invalid ValidationError
+	if r.Old == "" {
+		invalid.Add("old", "must not be empty")
+	}
+	if r.New == "" {
+		invalid.Add("new", "must not be empty")
 	}
-	return nil
+	return invalid.Err()
 }
 
 // AuthResource is http.Handler for all requests to `/auth`
@@ -97,11 +110,14 @@ type AuthResource struct {
 // Router constructs a new chi router for the auth resource.
 func (res AuthResource) Router() chi.Router {
 	r := chi.NewRouter()
-	r.With(BodyParser[RegisterRequest], Validware[RegisterRequest]).
+	r.With(Schemaware("RegisterRequest.json"), BodyParser[RegisterRequest], Validware[RegisterRequest]).
 		Post("/register", res.RegisterUser)
-	r.With(BodyParser[LoginRequest], Validware[LoginRequest]).
+	r.With(Schemaware("LoginRequest.json"), BodyParser[LoginRequest], Validware[LoginRequest]).
 		Post("/login", res.LoginUser)
-	r.With(BodyParser[PasswordChanger], Validware[PasswordChanger], Authware).
+	r.With(Schemaware("PasswordChanger.json"), BodyParser[PasswordChanger], Validware[PasswordChanger], Authware).
+		Post("/password", res.ChangePassword)
+	// former endpoint of ChangePassword, kept for existing clients
+	r.With(Schemaware("PasswordChanger.json"), BodyParser[PasswordChanger], Validware[PasswordChanger], Authware).
 		Post("/change", res.ChangePassword)
 	return r
 }
@@ -118,7 +134,7 @@ func (res AuthResource) RegisterUser(w http.ResponseWriter, r *http.Request) {
 	uid := GenerateID()
 	password, err := bcrypt.GenerateFromPassword([]byte(body.Password), BCryptCost)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		ProblemInternal.Write(w)
 		log.Println(err)
 		return
 	}
@@ -136,13 +152,13 @@ func (res AuthResource) RegisterUser(w http.ResponseWriter, r *http.Request) {
 	switch {
 	case errors.Is(err, db.ErrInvalidData),
 		errors.Is(err, db.ErrSyntaxPrivilege):
-		w.WriteHeader(http.StatusBadRequest)
+		ProblemInvalidData.Write(w)
 		return
 	case errors.Is(err, db.ErrConflict):
-		w.WriteHeader(http.StatusConflict)
+		ProblemConflict.With("The email is already registered.").Write(w)
 		return
 	case err != nil:
-		w.WriteHeader(http.StatusInternalServerError)
+		ProblemInternal.Write(w)
 		return
 	}
 	// newly created user resource at location
@@ -165,10 +181,10 @@ func (res AuthResource) LoginUser(w http.ResponseWriter, r *http.Request) {
 	}
 	switch {
 	case errors.Is(err, db.ErrNoRows): // not found
-		w.WriteHeader(http.StatusUnprocessableEntity)
+		ProblemInvalidCredentials.With("The email or the password is wrong.").Write(w)
 		return
 	case err != nil: // db error
-		w.WriteHeader(http.StatusInternalServerError)
+		ProblemInternal.Write(w)
 		return
 	}
 	err = bcrypt.CompareHashAndPassword(user.Password, []byte(body.Password))
@@ -178,15 +194,15 @@ func (res AuthResource) LoginUser(w http.ResponseWriter, r *http.Request) {
 	switch {
 	// invalid password provided by client in request body
 	case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
-		w.WriteHeader(http.StatusUnprocessableEntity)
+		ProblemInvalidCredentials.With("The email or the password is wrong.").Write(w)
 		return
 	case err != nil: // server error
-		w.WriteHeader(http.StatusInternalServerError)
+		ProblemInternal.Write(w)
 		return
 	}
 	token, err := GenerateToken(user.Uid)
 	if err != nil { // base64 failed to decode
-		w.WriteHeader(http.StatusInternalServerError)
+		ProblemInternal.Write(w)
 		log.Println(err)
 		return
 	}
@@ -211,10 +227,10 @@ func (res AuthResource) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	switch {
 	case errors.Is(err, db.ErrNoRows): // no matching user
 		w.Header().Set("WWW-Authenticate", `bearer error="invalid_user"`)
-		w.WriteHeader(http.StatusUnauthorized)
+		ProblemUnauthorized.With("The user of the auth token does not exist.").Write(w)
 		return
 	case err != nil:
-		w.WriteHeader(http.StatusInternalServerError)
+		ProblemInternal.Write(w)
 		return
 	}
 	// check if old password is valid
@@ -225,16 +241,16 @@ func (res AuthResource) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	switch {
 	// old password does not match
 	case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
-		w.WriteHeader(http.StatusUnprocessableEntity)
+		ProblemInvalidCredentials.With("The old password is wrong.").Write(w)
 		return
 	case err != nil:
-		w.WriteHeader(http.StatusInternalServerError)
+		ProblemInternal.Write(w)
 		return
 	}
 	// ok, now generate hash for new password
 	password, err := bcrypt.GenerateFromPassword([]byte(body.New), BCryptCost)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		ProblemInternal.Write(w)
 		log.Println(err)
 		return
 	}
@@ -252,13 +268,13 @@ func (res AuthResource) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	}
 	switch {
 	case errors.Is(err, db.ErrNoRows): // someone changed db in b/w
-		w.WriteHeader(http.StatusUnprocessableEntity)
+		ProblemInvalidCredentials.With("The password was changed meanwhile.").Write(w)
 		return
 	case errors.Is(err, db.ErrConflict): // update causes a conflict
-		w.WriteHeader(http.StatusConflict)
+		ProblemConflict.Write(w)
 		return
 	case err != nil: // some server error happened
-		w.WriteHeader(http.StatusInternalServerError)
+		ProblemInternal.Write(w)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent) // ALL OK
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/manojnakp/scount/db"
+)
+
+// ErrForbidden is returned when the current user lacks the permission
+// for an action on a scount.
+var ErrForbidden = errors.New("api: forbidden")
+
+// Permission is an action on a scount that is granted to some roles only.
+type Permission int
+
+// Permissions granted to the roles of scount members. Transferring the
+// ownership and deleting the scount are left to the owner alone.
+const (
+	// PermAddExpense allows adding expenses and settlements.
+	PermAddExpense Permission = iota
+	// PermEditExpenses allows editing and deleting expenses paid by
+	// other members. Members may always edit their own expenses.
+	PermEditExpenses
+	// PermManageMembers allows adding and removing members, and changing
+	// their roles.
+	PermManageMembers
+	// PermRenameScount allows changing the title of the scount.
+	PermRenameScount
+)
+
+// RolePermissions maps every role to the permissions granted to it.
+var RolePermissions = map[db.Role][]Permission{
+	db.RoleOwner:  {PermAddExpense, PermEditExpenses, PermManageMembers, PermRenameScount},
+	db.RoleAdmin:  {PermAddExpense, PermEditExpenses, PermManageMembers, PermRenameScount},
+	db.RoleMember: {PermAddExpense},
+	db.RoleViewer: {},
+}
+
+// Access describes the access of the current user to a scount, that is
+// the scount along with the membership of the current user.
+type Access struct {
+	Scount db.Scount
+	Member db.Member
+}
+
+// IsOwner reports whether the current user owns the scount.
+func (a Access) IsOwner() bool {
+	return a.Member.Role == db.RoleOwner
+}
+
+// Can reports whether the role of the current user grants permission p.
+func (a Access) Can(p Permission) bool {
+	for _, perm := range RolePermissions[a.Member.Role] {
+		if perm == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize is the middleware that loads the scount and the membership
+// of the current user in it once, and sets them in request context using
+// AccessKey. Non-members of the scount get 404 Not Found, as if the
+// scount did not exist at all.
+//
+// Pre-requisite: ScountKey and AuthUserKey should be present in request
+// context.
+func Authorize(store *db.Store) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var (
+				ctx = r.Context()
+				sid = ctx.Value(ScountKey).(string)
+				uid = ctx.Value(AuthUserKey).(string)
+			)
+			access, err := loadAccess(ctx, store, sid, uid)
+			switch {
+			case errors.Is(err, db.ErrNoRows): // no scount or not a member
+				ProblemNotFound.With("The scount does not exist.").Write(w)
+				return
+			case err != nil:
+				log.Println(err)
+				ProblemInternal.Write(w)
+				return
+			}
+			ctx = context.WithValue(ctx, AccessKey, access)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// loadAccess fetches the access of user uid to scount sid from store.
+// If either the scount does not exist or the user is not a member of
+// the scount, then db.ErrNoRows.
+func loadAccess(ctx context.Context, store *db.Store, sid, uid string) (Access, error) {
+	member, err := store.Members.FindOne(ctx, &db.MemberId{Sid: sid, Uid: uid})
+	if err != nil {
+		return Access{}, err
+	}
+	scount, err := store.Scounts.FindOne(ctx, &db.ScountId{Sid: sid})
+	if err != nil {
+		return Access{}, err
+	}
+	return Access{Scount: scount, Member: member}, nil
+}
+
+// OwnerOnly is the middleware that lets only the owner of the scount
+// through, other members get 403 Forbidden.
+//
+// Pre-requisite: AccessKey should be present in request context, see
+// Authorize.
+func OwnerOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		access := r.Context().Value(AccessKey).(Access)
+		if !access.IsOwner() {
+			ProblemForbidden.With("Only the owner of the scount is allowed.").Write(w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Require is the middleware that lets only the members having permission
+// p through, other members get 403 Forbidden.
+//
+// Pre-requisite: AccessKey should be present in request context, see
+// Authorize.
+func Require(p Permission) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			access := r.Context().Value(AccessKey).(Access)
+			if !access.Can(p) {
+				ProblemForbidden.With("The role of the user in the scount does not allow it.").Write(w)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
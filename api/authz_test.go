@@ -0,0 +1,375 @@
+package api_test
+
+import (
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/manojnakp/scount/api"
+	"github.com/manojnakp/scount/db"
+	"github.com/manojnakp/scount/db/memory"
+)
+
+// Roles are the roles of the callers in the matrix of TestAccess, the
+// empty role standing for a user who is not a member of the scount.
+var Roles = []db.Role{db.RoleOwner, db.RoleAdmin, db.RoleMember, db.RoleViewer, ""}
+
+// Cast is the set of registered users of TestAccess, the callers by
+// role along with a member without a role in the matrix and a user to
+// be added as a member.
+type Cast struct {
+	Clients  map[db.Role]Client
+	Uids     map[db.Role]string
+	Extra    string // member of every scount, target of member management
+	Newcomer string // registered user, not a member
+}
+
+// NewCast registers the users of the Cast and signs in the callers.
+func NewCast(t *testing.T, router http.Handler) Cast {
+	t.Helper()
+	anon := Client{t: t, router: router}
+	register := func(name string) string {
+		t.Helper()
+		return anon.Create(http.MethodPost, "/auth/register", map[string]any{
+			"email":    name + "@example.com",
+			"username": name,
+			"password": name + "password",
+		}, "user_id")
+	}
+	cast := Cast{
+		Clients:  make(map[db.Role]Client),
+		Uids:     make(map[db.Role]string),
+		Extra:    register("frank"),
+		Newcomer: register("grace"),
+	}
+	names := []string{"alice", "bob", "carol", "dave", "eve"}
+	for i, role := range Roles {
+		cast.Uids[role] = register(names[i])
+		token := anon.Create(http.MethodPost, "/auth/login", map[string]any{
+			"email":    names[i] + "@example.com",
+			"password": names[i] + "password",
+		}, "token")
+		cast.Clients[role] = Client{t: t, router: router, token: token}
+	}
+	return cast
+}
+
+// Scount sets up a scount of the owner with the members of the cast by
+// role (and the extra member), along with an expense and a settlement
+// of the owner to the admin, an expense and a settlement of the member,
+// a settlement of the owner to the viewer and an invite.
+// It gives the ids of the records, by path parameter.
+func (c Cast) Scount() map[string]string {
+	owner := c.Clients[db.RoleOwner]
+	amount := map[string]any{"value": "30.00", "currency": "EUR"}
+	sid := owner.Create(http.MethodPost, "/scounts", map[string]any{
+		"title": "City Trip",
+	}, "scount_id")
+	scount := "/scounts/" + sid
+	for _, role := range []db.Role{db.RoleAdmin, db.RoleMember, db.RoleViewer} {
+		owner.Create(http.MethodPost, scount+"/members", map[string]any{
+			"uid":  c.Uids[role],
+			"role": role,
+		}, "member_id")
+	}
+	member := c.Clients[db.RoleMember]
+	params := map[string]string{
+		"sid": sid,
+		"eid": owner.Create(http.MethodPost, scount+"/expenses", map[string]any{
+			"title":  "Dinner",
+			"amount": amount,
+		}, "expense_id"),
+		"member_eid": member.Create(http.MethodPost, scount+"/expenses", map[string]any{
+			"title":  "Tickets",
+			"amount": amount,
+		}, "expense_id"),
+		"stid": owner.Create(http.MethodPost, scount+"/settlements", map[string]any{
+			"payee":  c.Uids[db.RoleAdmin],
+			"amount": amount,
+		}, "settlement_id"),
+		"member_stid": member.Create(http.MethodPost, scount+"/settlements", map[string]any{
+			"payee":  c.Uids[db.RoleOwner],
+			"amount": amount,
+		}, "settlement_id"),
+		"viewer_stid": owner.Create(http.MethodPost, scount+"/settlements", map[string]any{
+			"payee":  c.Uids[db.RoleViewer],
+			"amount": amount,
+		}, "settlement_id"),
+		"iid": owner.Create(http.MethodPost, scount+"/invites", map[string]any{}, "invite_id"),
+		"uid": c.Extra,
+	}
+	// added last, so as to have no share in the expenses
+	owner.Create(http.MethodPost, scount+"/members", map[string]any{
+		"uid": c.Extra,
+	}, "member_id")
+	return params
+}
+
+// TestAccess checks the matrix of the roles in a scount against the
+// routes of the scount: users who are not members do not find the
+// scount, members are forbidden from what their role does not allow.
+func TestAccess(t *testing.T) {
+	err := api.LoadSchemas(os.DirFS("../schema"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		everyone = []db.Role{db.RoleOwner, db.RoleAdmin, db.RoleMember, db.RoleViewer}
+		adders   = []db.Role{db.RoleOwner, db.RoleAdmin, db.RoleMember}
+		editors  = []db.Role{db.RoleOwner, db.RoleAdmin}
+		owner    = []db.Role{db.RoleOwner}
+	)
+	amount := map[string]any{"value": "5.00", "currency": "EUR"}
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    func(params map[string]string) any
+		prepare func(owner Client, params map[string]string)
+		allowed []db.Role
+		denied  int // status of members denied, 403 by default
+	}{
+		{
+			name: "get scount", method: http.MethodGet, path: "/scounts/{sid}",
+			allowed: everyone,
+		},
+		{
+			name: "rename scount", method: http.MethodPatch, path: "/scounts/{sid}",
+			body: func(map[string]string) any {
+				return map[string]any{"title": "Road Trip"}
+			},
+			allowed: editors,
+		},
+		{
+			name: "delete scount", method: http.MethodDelete, path: "/scounts/{sid}",
+			allowed: owner,
+		},
+		{
+			// the trash of others is not found
+			name: "restore scount", method: http.MethodPost, path: "/scounts/{sid}/restore",
+			prepare: func(owner Client, params map[string]string) {
+				owner.Do(http.MethodDelete, "/scounts/"+params["sid"], nil)
+			},
+			allowed: owner,
+			denied:  http.StatusNotFound,
+		},
+		{
+			name: "get balances", method: http.MethodGet, path: "/scounts/{sid}/balances",
+			allowed: everyone,
+		},
+		{
+			name: "get settle plan", method: http.MethodGet, path: "/scounts/{sid}/settle-plan",
+			allowed: everyone,
+		},
+		{
+			name: "list activity", method: http.MethodGet, path: "/scounts/{sid}/activity",
+			allowed: everyone,
+		},
+		{
+			name: "list members", method: http.MethodGet, path: "/scounts/{sid}/members",
+			allowed: everyone,
+		},
+		{
+			name: "add member", method: http.MethodPost, path: "/scounts/{sid}/members",
+			body: func(params map[string]string) any {
+				return map[string]any{"uid": params["newcomer"]}
+			},
+			allowed: editors,
+		},
+		{
+			name: "get member", method: http.MethodGet, path: "/scounts/{sid}/members/{uid}",
+			allowed: everyone,
+		},
+		{
+			name: "update member", method: http.MethodPatch, path: "/scounts/{sid}/members/{uid}",
+			body: func(map[string]string) any {
+				return map[string]any{"role": db.RoleViewer}
+			},
+			allowed: editors,
+		},
+		{
+			name: "remove member", method: http.MethodDelete, path: "/scounts/{sid}/members/{uid}",
+			allowed: editors,
+		},
+		{
+			name: "list expenses", method: http.MethodGet, path: "/scounts/{sid}/expenses",
+			allowed: everyone,
+		},
+		{
+			name: "add expense", method: http.MethodPost, path: "/scounts/{sid}/expenses",
+			body: func(map[string]string) any {
+				return map[string]any{"title": "Lunch", "amount": amount}
+			},
+			allowed: adders,
+		},
+		{
+			name: "add expense paid by another", method: http.MethodPost, path: "/scounts/{sid}/expenses",
+			body: func(params map[string]string) any {
+				return map[string]any{"title": "Lunch", "amount": amount, "payer": params["uid"]}
+			},
+			allowed: editors,
+		},
+		{
+			name: "list expense trash", method: http.MethodGet, path: "/scounts/{sid}/expenses/trash",
+			allowed: editors,
+		},
+		{
+			name: "get expense", method: http.MethodGet, path: "/scounts/{sid}/expenses/{eid}",
+			allowed: everyone,
+		},
+		{
+			name: "update expense of another", method: http.MethodPatch, path: "/scounts/{sid}/expenses/{eid}",
+			body: func(map[string]string) any {
+				return map[string]any{"title": "Lunch"}
+			},
+			allowed: editors,
+		},
+		{
+			name: "update expense of the member", method: http.MethodPatch, path: "/scounts/{sid}/expenses/{member_eid}",
+			body: func(map[string]string) any {
+				return map[string]any{"title": "Lunch"}
+			},
+			allowed: adders,
+		},
+		{
+			name: "hand expense over to another", method: http.MethodPatch, path: "/scounts/{sid}/expenses/{member_eid}",
+			body: func(params map[string]string) any {
+				return map[string]any{"payer": params["uid"]}
+			},
+			allowed: editors,
+		},
+		{
+			name: "delete expense of another", method: http.MethodDelete, path: "/scounts/{sid}/expenses/{eid}",
+			allowed: editors,
+		},
+		{
+			name: "delete expense of the member", method: http.MethodDelete, path: "/scounts/{sid}/expenses/{member_eid}",
+			allowed: adders,
+		},
+		{
+			name: "restore expense", method: http.MethodPost, path: "/scounts/{sid}/expenses/{eid}/restore",
+			prepare: func(owner Client, params map[string]string) {
+				owner.Do(http.MethodDelete, "/scounts/"+params["sid"]+"/expenses/"+params["eid"], nil)
+			},
+			allowed: editors,
+		},
+		{
+			name: "list settlements", method: http.MethodGet, path: "/scounts/{sid}/settlements",
+			allowed: everyone,
+		},
+		{
+			name: "record settlement", method: http.MethodPost, path: "/scounts/{sid}/settlements",
+			body: func(params map[string]string) any {
+				return map[string]any{"payee": params["uid"], "amount": amount}
+			},
+			allowed: adders,
+		},
+		{
+			name: "record settlement between others", method: http.MethodPost, path: "/scounts/{sid}/settlements",
+			body: func(params map[string]string) any {
+				return map[string]any{"payer": params["uid"], "payee": params["newcomer"], "amount": amount}
+			},
+			prepare: func(owner Client, params map[string]string) {
+				owner.Do(http.MethodPost, "/scounts/"+params["sid"]+"/members", map[string]any{
+					"uid": params["newcomer"],
+				})
+			},
+			allowed: editors,
+		},
+		{
+			name: "get settlement", method: http.MethodGet, path: "/scounts/{sid}/settlements/{stid}",
+			allowed: everyone,
+		},
+		{
+			// only the payer and the payee, whatever their role
+			name: "delete settlement to the admin", method: http.MethodDelete, path: "/scounts/{sid}/settlements/{stid}",
+			allowed: []db.Role{db.RoleOwner, db.RoleAdmin},
+		},
+		{
+			name: "delete settlement of the member", method: http.MethodDelete, path: "/scounts/{sid}/settlements/{member_stid}",
+			allowed: []db.Role{db.RoleOwner, db.RoleMember},
+		},
+		{
+			name: "delete settlement to the viewer", method: http.MethodDelete, path: "/scounts/{sid}/settlements/{viewer_stid}",
+			allowed: []db.Role{db.RoleOwner, db.RoleViewer},
+		},
+		{
+			name: "list invites", method: http.MethodGet, path: "/scounts/{sid}/invites",
+			allowed: editors,
+		},
+		{
+			name: "create invite", method: http.MethodPost, path: "/scounts/{sid}/invites",
+			body: func(map[string]string) any {
+				return map[string]any{}
+			},
+			allowed: editors,
+		},
+		{
+			name: "get invite", method: http.MethodGet, path: "/scounts/{sid}/invites/{iid}",
+			allowed: editors,
+		},
+		{
+			name: "revoke invite", method: http.MethodDelete, path: "/scounts/{sid}/invites/{iid}",
+			allowed: editors,
+		},
+	}
+	router := NewRouter(memory.NewStore(memory.NewDatabase()))
+	cast := NewCast(t, router)
+	// every route of a scount is in the matrix
+	covered := make(map[string]bool)
+	for _, tt := range tests {
+		covered[tt.method+" "+tt.path] = true
+	}
+	err = chi.Walk(router, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		route = Normalize(route)
+		if strings.HasPrefix(route, "/scounts/{sid}") && !covered[method+" "+route] {
+			t.Errorf("%s %s: route not in the matrix", method, route)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		for _, role := range Roles {
+			name := string(role)
+			if role == "" {
+				name = "stranger"
+			}
+			t.Run(tt.name+"/"+name, func(t *testing.T) {
+				params := cast.Scount()
+				params["newcomer"] = cast.Newcomer
+				if tt.prepare != nil {
+					tt.prepare(cast.Clients[db.RoleOwner], params)
+				}
+				var body any
+				if tt.body != nil {
+					body = tt.body(params)
+				}
+				op := Operation{Method: tt.method, Path: tt.path}
+				res := cast.Clients[role].Do(tt.method, Target(t, op, params), body)
+				switch {
+				case role == "":
+					if res.Code != http.StatusNotFound {
+						t.Errorf("%s: %d %s, want %d", op, res.Code, res.Body, http.StatusNotFound)
+					}
+				case slices.Contains(tt.allowed, role):
+					if res.Code < 200 || res.Code > 299 {
+						t.Errorf("%s: %d %s, want success", op, res.Code, res.Body)
+					}
+				default:
+					want := tt.denied
+					if want == 0 {
+						want = http.StatusForbidden
+					}
+					if res.Code != want {
+						t.Errorf("%s: %d %s, want %d", op, res.Code, res.Body, want)
+					}
+				}
+			})
+		}
+	}
+}
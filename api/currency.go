@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/manojnakp/scount/db"
+	"github.com/manojnakp/scount/money"
+)
+
+// DefaultCurrency is the currency of a scount unless requested otherwise.
+const DefaultCurrency money.Currency = "EUR"
+
+// ErrCurrencyQuery defines parsing errors for CurrencyQuery.
+var ErrCurrencyQuery = errors.New("invalid currency query parameters")
+
+// CurrencyQuery describes the url query parameters used for viewing
+// amounts in a currency other than that of the scount.
+type CurrencyQuery struct {
+	Currency money.Currency
+}
+
+// ParseCurrencyQuery parses the `currency` query parameter. Empty
+// currency means the currency of the scount.
+func ParseCurrencyQuery(query url.Values) (*CurrencyQuery, error) {
+	currency := money.Currency(query.Get("currency"))
+	if currency != "" && !currency.Valid() {
+		return nil, fmt.Errorf("%w: invalid 'currency' parameter", ErrCurrencyQuery)
+	}
+	return &CurrencyQuery{Currency: currency}, nil
+}
+
+// ratesOrDefault gives rates, or else money.DefaultRates if nil.
+func ratesOrDefault(rates money.ExchangeRates) money.ExchangeRates {
+	if rates == nil {
+		return money.DefaultRates
+	}
+	return rates
+}
+
+// convert converts amount into currency to as per rates, giving the
+// rate used along with the converted amount.
+func convert(
+	ctx context.Context,
+	rates money.ExchangeRates,
+	amount money.Amount,
+	to money.Currency,
+) (money.Rate, money.Amount, error) {
+	rate, err := ratesOrDefault(rates).Rate(ctx, amount.Currency, to)
+	if err != nil {
+		return money.Rate{}, money.Amount{}, err
+	}
+	base, err := rate.Convert(amount)
+	if err != nil {
+		return money.Rate{}, money.Amount{}, err
+	}
+	return rate, base, nil
+}
+
+// convertShares hands out base among shares in proportion to the amount
+// of every share, so that the converted shares add up to base exactly.
+func convertShares(base money.Amount, shares []db.Share) error {
+	weights := make([]int64, len(shares))
+	for i, share := range shares {
+		weights[i] = share.Amount.Minor
+	}
+	bases, err := base.Allocate(weights...)
+	if err != nil {
+		return err
+	}
+	for i := range shares {
+		shares[i].Base = bases[i]
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/manojnakp/scount/db"
+)
+
+// ErrCursor is returned when a paging cursor is malformed, or does not
+// belong to the requested sort order.
+var ErrCursor = errors.New("api: invalid paging cursor")
+
+// cursor is the content of an opaque paging cursor, that is the keyset
+// of a record along with the sort order it was taken in.
+type cursor struct {
+	Order string    `json:"o"`
+	Keys  db.Keyset `json:"k"`
+}
+
+// orderSpec is the textual form of order, same as `sort` parameter.
+func orderSpec(order []db.Sorter) string {
+	fields := make([]string, 0, len(order))
+	for _, sorter := range order {
+		field := string(sorter.Column)
+		if sorter.Desc {
+			field = "~" + field
+		}
+		fields = append(fields, field)
+	}
+	return strings.Join(fields, ",")
+}
+
+// EncodeCursor gives the opaque cursor for keyset taken in order.
+func EncodeCursor(keyset db.Keyset, order []db.Sorter) string {
+	data, _ := json.Marshal(cursor{Order: orderSpec(order), Keys: keyset})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses the opaque cursor s into the keyset, which must be
+// taken in order. Keys are strings, numbers or null only, whole numbers
+// being decoded as int64.
+func DecodeCursor(s string, order []db.Sorter) (db.Keyset, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCursor, err)
+	}
+	var c cursor
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err = decoder.Decode(&c); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCursor, err)
+	}
+	if c.Order != orderSpec(order) || len(c.Keys) != len(order) {
+		return nil, fmt.Errorf("%w: sort order mismatch", ErrCursor)
+	}
+	for i, key := range c.Keys {
+		switch key := key.(type) {
+		case nil, string:
+		case json.Number:
+			if n, err := key.Int64(); err == nil {
+				c.Keys[i] = n
+			} else {
+				c.Keys[i] = key.String()
+			}
+		default: // objects, arrays and booleans are no keys
+			return nil, fmt.Errorf("%w: key of type %T", ErrCursor, key)
+		}
+	}
+	return c.Keys, nil
+}
+
+// Projector builds the projection for fetching the page requested by
+// paging, from the records sorted by order. The key columns are appended
+// to order so that cursors identify a unique position. In cursor mode, an
+// extra record is fetched to learn whether more records follow.
+func (paging Paginator) Projector(order []db.Sorter, keys []db.Column) (*db.Projector, error) {
+	order = db.KeysetOrder(order, keys)
+	projector := &db.Projector{
+		Order: order,
+		Count: paging.Offset || paging.Count,
+	}
+	if paging.Offset {
+		projector.Paging = &db.Paging{Limit: paging.Size, Offset: paging.Page * paging.Size}
+		return projector, nil
+	}
+	var err error
+	projector.Paging = &db.Paging{Limit: paging.Size + 1}
+	switch {
+	case paging.After != "":
+		projector.Paging.After, err = DecodeCursor(paging.After, order)
+	case paging.Before != "":
+		projector.Paging.Before, err = DecodeCursor(paging.Before, order)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return projector, nil
+}
+
+// Page is a page of records from a collection, along with the links to
+// the neighbouring pages.
+type Page[T any] struct {
+	Items []T
+	Links []WebLink
+	Total int // -1 if not counted
+}
+
+// Header sets the `Link` and `X-Total-Count` (if counted) headers of w.
+func (page Page[T]) Header(w http.ResponseWriter) {
+	LinkHeader(w, page.Links)
+	if page.Total >= 0 {
+		w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	}
+}
+
+// PageOf gathers the page requested by paging from list, which is found
+// using projector built by paging. Links to the next and previous pages
+// carry the cursors of the last and first record of the page, whereas
+// offset mode links by page number.
+func PageOf[T db.Keyed](
+	base string,
+	params url.Values,
+	paging Paginator,
+	projector *db.Projector,
+	list *db.Iterable[T],
+) (Page[T], error) {
+	var items []T
+	list.Iterator(func(item T) bool {
+		items = append(items, item)
+		return true
+	})
+	if err := list.Err(); err != nil {
+		return Page[T]{}, err
+	}
+	page := Page[T]{Items: items, Total: list.Total()}
+	if paging.Offset {
+		page.Links = PagingLinks(base, params, page.Total)
+		return page, nil
+	}
+	backward := paging.Before != ""
+	more := len(items) > paging.Size
+	if more && backward { // extra record is at the front
+		items = items[1:]
+	} else if more {
+		items = items[:paging.Size]
+	}
+	page.Items = items
+	params.Del("page")
+	params.Del("after")
+	params.Del("before")
+	// empty cursor keeps the first page in cursor mode
+	params.Set("after", "")
+	page.Links = append(page.Links, NewWebLink(base, params, "first"))
+	params.Del("after")
+	if len(items) == 0 {
+		return page, nil
+	}
+	if more || backward {
+		last := db.KeysetOf(items[len(items)-1], projector.Order)
+		params.Set("after", EncodeCursor(last, projector.Order))
+		page.Links = append(page.Links, NewWebLink(base, params, "next"))
+		params.Del("after")
+	}
+	if (more && backward) || paging.After != "" {
+		first := db.KeysetOf(items[0], projector.Order)
+		params.Set("before", EncodeCursor(first, projector.Order))
+		page.Links = append(page.Links, NewWebLink(base, params, "prev"))
+		params.Del("before")
+	}
+	return page, nil
+}
@@ -0,0 +1,45 @@
+package api_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/manojnakp/scount/api"
+	"github.com/manojnakp/scount/db"
+)
+
+func TestDecodeCursor(t *testing.T) {
+	order := []db.Sorter{{Column: "time", Desc: true}, {Column: "aid"}}
+	raw := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+	tests := []struct {
+		name   string
+		cursor string
+		want   db.Keyset
+		err    error
+	}{
+		{"encoded", api.EncodeCursor(db.Keyset{int64(1700000000), "a1"}, order), db.Keyset{int64(1700000000), "a1"}, nil},
+		{"null key", raw(`{"o":"~time,aid","k":[null,"a1"]}`), db.Keyset{nil, "a1"}, nil},
+		{"fractional number", raw(`{"o":"~time,aid","k":[1.5,"a1"]}`), db.Keyset{"1.5", "a1"}, nil},
+		{"not base64", "not a cursor!", nil, api.ErrCursor},
+		{"not json", raw(`{"o":`), nil, api.ErrCursor},
+		{"other order", raw(`{"o":"time,aid","k":[1,"a1"]}`), nil, api.ErrCursor},
+		{"missing key", raw(`{"o":"~time,aid","k":[1]}`), nil, api.ErrCursor},
+		{"object key", raw(`{"o":"~time,aid","k":[{"$gt":1},"a1"]}`), nil, api.ErrCursor},
+		{"array key", raw(`{"o":"~time,aid","k":[[1,2],"a1"]}`), nil, api.ErrCursor},
+		{"boolean key", raw(`{"o":"~time,aid","k":[true,"a1"]}`), nil, api.ErrCursor},
+	}
+	for _, tt := range tests {
+		got, err := api.DecodeCursor(tt.cursor, order)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: DecodeCursor() error = %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if tt.err == nil && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: DecodeCursor() = %#v, want %#v", tt.name, got, tt.want)
+		}
+	}
+}
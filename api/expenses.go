@@ -0,0 +1,627 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/manojnakp/scount/api/internal"
+	"github.com/manojnakp/scount/db"
+	"github.com/manojnakp/scount/money"
+)
+
+// ExpenseSchema is the location for `Expense` JSON schema.
+const ExpenseSchema = "/schema/Expense.json"
+
+// ErrExpenseQuery defines parsing errors for ExpenseQuery.
+var ErrExpenseQuery = errors.New("invalid expense query parameters")
+
+// ExpenseSorter is the default sort order for expense queries.
+var ExpenseSorter = []db.Sorter{
+	{
+		Column: "eid",
+	},
+}
+
+// Expense describes the expense resource. Converted is the amount in
+// the currency of the scount at the rate recorded along with the expense.
+// Deleted is the time the expense was moved to the trash, if so.
+// schema is defined at `Expense.json`.
+type Expense struct {
+	Schema    string       `json:"$schema,omitempty"`
+	Id        string       `json:"id"`
+	Scount    string       `json:"scount"`
+	Payer     string       `json:"payer"`
+	Title     string       `json:"title"`
+	Amount    money.Amount `json:"amount"`
+	Rate      string       `json:"rate"`
+	Converted money.Amount `json:"converted"`
+	Split     Split        `json:"split"`
+	Deleted   *time.Time   `json:"deleted,omitempty"`
+}
+
+// NewExpense constructs the expense resource from db.Expense.
+func NewExpense(expense db.Expense) Expense {
+	parts := make([]SplitPart, 0, len(expense.Shares))
+	for _, share := range expense.Shares {
+		amount := share.Amount
+		part := SplitPart{Member: share.Uid, Amount: &amount}
+		if expense.Mode == db.SplitPercent || expense.Mode == db.SplitShares {
+			part.Weight = share.Weight
+		}
+		parts = append(parts, part)
+	}
+	return Expense{
+		Schema:    ExpenseSchema,
+		Id:        expense.Eid,
+		Scount:    expense.Sid,
+		Payer:     expense.Payer,
+		Title:     expense.Title,
+		Amount:    expense.Amount,
+		Rate:      expense.Rate.Decimal(),
+		Converted: expense.Base,
+		Split:     Split{Mode: expense.Mode, Parts: parts},
+		Deleted:   deletedAt(expense.Deleted),
+	}
+}
+
+// ExpenseQuery describes the url query parameters
+// used for filtering the expenses of a scount.
+// schema is defined at `ExpenseQuery.json`.
+type ExpenseQuery struct {
+	Id     string
+	Payer  string
+	Title  string
+	Sort   []db.Sorter
+	Paging Paginator
+}
+
+// ParseExpenseQuery parses the query parameters on expense collection resource.
+func ParseExpenseQuery(query url.Values) (*ExpenseQuery, error) {
+	paging, err := ParsePaginator(query)
+	if err != nil {
+		return nil, err
+	}
+	list, err := internal.ParseSort(query.Get("sort"), internal.ExpenseSortMap)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid 'sort' parameter: %w", ErrExpenseQuery, err)
+	}
+	// fallback to default sorter
+	if len(list) == 0 {
+		list = ExpenseSorter
+	}
+	return &ExpenseQuery{
+		Id:     query.Get("id"),
+		Payer:  query.Get("payer"),
+		Title:  query.Get("title"),
+		Sort:   list,
+		Paging: paging,
+	}, nil
+}
+
+// ExpenseRequest describes new expense creation request. Missing split
+// means the expense is split equally among all the members of the scount.
+// schema is defined at `ExpenseRequest.json`
+type ExpenseRequest struct {
+	Title  string       `json:"title"`
+	Payer  string       `json:"payer,omitempty"`
+	Amount money.Amount `json:"amount"`
+	Split  *Split       `json:"split,omitempty"`
+}
+
+// Validate implements Validator on ExpenseRequest.
+// Split (if any) must add up to the amount.
+func (e ExpenseRequest) Validate() error {
+	var invalid ValidationError
+	if e.Title == "" {
+		invalid.Add("title", "must not be empty")
+	}
+	if e.Amount.Sign() <= 0 {
+		invalid.Add("amount", "must be positive")
+	} else if e.Split != nil {
+		_, err := e.Split.Resolve(e.Amount)
+		if err != nil {
+			invalid.Add("split", SplitReason(err))
+		}
+	}
+	return invalid.Err()
+}
+
+// ExpenseResponse points to the newly created expense resource.
+// schema is defined at `ExpenseResponse.json`
+type ExpenseResponse struct {
+	Schema    string `json:"$schema,omitempty"`
+	ExpenseId string `json:"expense_id"`
+}
+
+// ExpenseUpdater describes expense resource update request.
+// schema is defined at `ExpenseUpdater.json`
+type ExpenseUpdater struct {
+	Title  string        `json:"title,omitempty"`
+	Payer  string        `json:"payer,omitempty"`
+	Amount *money.Amount `json:"amount,omitempty"`
+	Split  *Split        `json:"split,omitempty"`
+}
+
+// Validate implements Validator on ExpenseUpdater. Split (if any) is
+// checked against the amount later on, as amount may not be updated.
+func (e ExpenseUpdater) Validate() error {
+	var invalid ValidationError
+	if e.Amount != nil && e.Amount.Sign() <= 0 {
+		invalid.Add("amount", "must be positive")
+	}
+	if e.Split != nil {
+		err := e.Split.Validate()
+		if err != nil {
+			invalid.Add("split", SplitReason(err))
+		}
+	}
+	return invalid.Err()
+}
+
+// ExpenseResource is the http.Handler for all requests to
+// `/scounts/{sid}/expenses`. Rates converts amounts into the currency
+// of the scount, money.DefaultRates if nil.
+//
+// Pre-requisite: ScountKey, AuthUserKey and AccessKey should be present
+// in request context, hence it is supposed to be mounted under
+// ScountResource.
+type ExpenseResource struct {
+	DB    *db.Store
+	Rates money.ExchangeRates
+}
+
+// ExpensePathWare is the middleware to set context key corresponding
+// to "eid" path parameter using ExpenseKey.
+func ExpensePathWare(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		eid := chi.URLParam(r, "eid")
+		ctx := context.WithValue(r.Context(), ExpenseKey, eid)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Router constructs a new chi.Router for the ExpenseResource.
+func (res ExpenseResource) Router() chi.Router {
+	r := chi.NewRouter()
+	r.With(QueryParser(ParseExpenseQuery)).
+		Get("/", res.ListExpenses)
+	r.With(Require(PermAddExpense), Schemaware("ExpenseRequest.json"), BodyParser[ExpenseRequest], Validware[ExpenseRequest]).
+		Post("/", res.CreateExpense)
+	r.With(Require(PermEditExpenses), QueryParser(ParseExpenseQuery)).
+		Get("/trash", res.ListTrash)
+	r.Route("/{eid}", func(r chi.Router) {
+		r.Use(ExpensePathWare)
+		r.Get("/", res.GetExpense)
+		r.With(res.editable, Schemaware("ExpenseUpdater.json"), BodyParser[ExpenseUpdater], Validware[ExpenseUpdater]).
+			Patch("/", res.UpdateExpense)
+		r.With(res.editable).
+			Delete("/", res.DeleteExpense)
+		r.With(Require(PermEditExpenses)).
+			Post("/restore", res.RestoreExpense)
+	})
+	return r
+}
+
+// ServeHTTP implements http.Handler on ExpenseResource.
+func (res ExpenseResource) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	mux := res.Router()
+	mux.ServeHTTP(w, r)
+}
+
+// ListExpenses handles GET requests at `/scounts/{sid}/expenses`.
+func (res ExpenseResource) ListExpenses(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx   = r.Context()
+		sid   = ctx.Value(ScountKey).(string)
+		query = ctx.Value(QueryKey).(*ExpenseQuery)
+	)
+	res.list(w, r, path.Join("/scounts", sid, "expenses"), &db.ExpenseFilter{
+		Sid:   sid,
+		Eid:   query.Id,
+		Payer: query.Payer,
+		Title: query.Title,
+	})
+}
+
+// ListTrash handles GET requests at `/scounts/{sid}/expenses/trash`.
+func (res ExpenseResource) ListTrash(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx   = r.Context()
+		sid   = ctx.Value(ScountKey).(string)
+		query = ctx.Value(QueryKey).(*ExpenseQuery)
+	)
+	res.list(w, r, path.Join("/scounts", sid, "expenses", "trash"), &db.ExpenseFilter{
+		Sid:   sid,
+		Eid:   query.Id,
+		Payer: query.Payer,
+		Title: query.Title,
+		Trash: true,
+	})
+}
+
+// list responds with the page of expenses matching filter, as per the
+// ExpenseQuery in context, at location.
+func (res ExpenseResource) list(
+	w http.ResponseWriter,
+	r *http.Request,
+	location string,
+	filter *db.ExpenseFilter,
+) {
+	var (
+		ctx   = r.Context()
+		query = ctx.Value(QueryKey).(*ExpenseQuery)
+	)
+	projector, err := query.Paging.Projector(query.Sort, db.ExpenseKeyCols)
+	if err != nil {
+		ProblemInvalidQuery.With(err.Error()).Write(w)
+		return
+	}
+	// database call
+	expenses, err := res.DB.Expenses.Find(ctx, filter, projector)
+	switch {
+	case errors.Is(err, db.ErrInvalidColumn):
+		ProblemInvalidColumn.Write(w)
+		return
+	case err != nil:
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	page, err := PageOf(location, r.URL.Query(), query.Paging, projector, expenses)
+	if err != nil {
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	// build response collection
+	list := make([]Expense, 0, len(page.Items))
+	for _, expense := range page.Items {
+		list = append(list, NewExpense(expense))
+	}
+	page.Header(w)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(list)
+}
+
+// CreateExpense handles POST request at `/scounts/{sid}/expenses`.
+func (res ExpenseResource) CreateExpense(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx  = r.Context()
+		sid  = ctx.Value(ScountKey).(string)
+		body = ctx.Value(BodyKey).(ExpenseRequest)
+		eid  = GenerateID()
+	)
+	// payer defaults to the current user
+	uid := ctx.Value(AuthUserKey).(string)
+	payer := body.Payer
+	if payer == "" {
+		payer = uid
+	}
+	// expenses paid by others are left to members allowed to edit them
+	if payer != uid && !ctx.Value(AccessKey).(Access).Can(PermEditExpenses) {
+		ProblemForbidden.With("Only members allowed to edit others' expenses can record one paid by another member.").Write(w)
+		return
+	}
+	// split defaults to all members equally
+	split := body.Split
+	if split == nil {
+		var err error
+		split, err = res.equalSplit(ctx, sid)
+		if err != nil {
+			log.Println(err)
+			ProblemInternal.Write(w)
+			return
+		}
+	}
+	shares, err := split.Resolve(body.Amount)
+	if err != nil {
+		log.Println(err)
+		ProblemOf(ValidationError{{Name: "split", Reason: SplitReason(err)}}).Write(w)
+		return
+	}
+	// convert into currency of the scount
+	rate, base, err := res.convert(ctx, body.Amount, shares)
+	switch {
+	case errors.Is(err, money.ErrRate):
+		ProblemNoRate.With(err.Error()).Write(w)
+		return
+	case err != nil:
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	// insert into db
+	id := &db.ExpenseId{Sid: sid, Eid: eid}
+	err = Track(ctx, res.DB, sid, db.ActivityExpenseAdded, eid, viewExpense(ctx, id), func(tx *db.Store) error {
+		return tx.Expenses.Insert(ctx, db.Expense{
+			Eid:    eid,
+			Sid:    sid,
+			Payer:  payer,
+			Title:  body.Title,
+			Amount: body.Amount,
+			Rate:   rate,
+			Base:   base,
+			Mode:   split.Mode,
+			Shares: shares,
+		})
+	})
+	// match error
+	switch {
+	case errors.Is(err, db.ErrInvalidData), errors.Is(err, db.ErrSyntaxPrivilege):
+		ProblemInvalidData.Write(w)
+		return
+	case errors.Is(err, db.ErrConflict): // payer or split not among members
+		ProblemConflict.With("The payer or some member of the split is not a member of the scount.").Write(w)
+		return
+	case err != nil:
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	// newly created expense resource location
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", path.Join("/scounts", sid, "expenses", eid))
+	w.WriteHeader(http.StatusOK)
+	// json response
+	_ = json.NewEncoder(w).Encode(ExpenseResponse{
+		Schema:    "/schema/ExpenseResponse.json",
+		ExpenseId: eid,
+	})
+}
+
+// GetExpense handles GET requests at `/scounts/{sid}/expenses/{eid}`.
+func (res ExpenseResource) GetExpense(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx = r.Context()
+		sid = ctx.Value(ScountKey).(string)
+		eid = ctx.Value(ExpenseKey).(string)
+	)
+	expense, err := res.DB.Expenses.FindOne(ctx, &db.ExpenseId{Sid: sid, Eid: eid})
+	switch {
+	case errors.Is(err, db.ErrNoRows): // eid not exist
+		ProblemNotFound.Write(w)
+		return
+	case err != nil: // failed to query the db
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // ALL OK
+	_ = json.NewEncoder(w).Encode(NewExpense(expense))
+}
+
+// UpdateExpense handles PATCH request at `/scounts/{sid}/expenses/{eid}`.
+func (res ExpenseResource) UpdateExpense(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx     = r.Context()
+		sid     = ctx.Value(ScountKey).(string)
+		eid     = ctx.Value(ExpenseKey).(string)
+		updater = ctx.Value(BodyKey).(ExpenseUpdater)
+	)
+	var zero ExpenseUpdater
+	// nothing to update: success
+	if updater == zero {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	// handing the expense over to another payer is editing others' expenses
+	uid := ctx.Value(AuthUserKey).(string)
+	if updater.Payer != "" && updater.Payer != uid && !ctx.Value(AccessKey).(Access).Can(PermEditExpenses) {
+		ProblemForbidden.With("Only members allowed to edit others' expenses can set another member as the payer.").Write(w)
+		return
+	}
+	id := &db.ExpenseId{Sid: sid, Eid: eid}
+	setter := &db.ExpenseUpdater{
+		Payer: updater.Payer,
+		Title: updater.Title,
+	}
+	if updater.Amount != nil {
+		setter.Amount = *updater.Amount
+	}
+	// amount or split changed: resolve the shares again
+	if updater.Amount != nil || updater.Split != nil {
+		expense, err := res.DB.Expenses.FindOne(ctx, id)
+		switch {
+		case errors.Is(err, db.ErrNoRows):
+			ProblemNotFound.Write(w)
+			return
+		case err != nil:
+			log.Println(err)
+			ProblemInternal.Write(w)
+			return
+		}
+		amount := expense.Amount
+		if updater.Amount != nil {
+			amount = *updater.Amount
+		}
+		split := updater.Split
+		if split == nil {
+			split = SplitOf(expense)
+		}
+		setter.Shares, err = split.Resolve(amount)
+		if err != nil {
+			log.Println(err)
+			ProblemOf(ValidationError{{Name: "split", Reason: SplitReason(err)}}).Write(w)
+			return
+		}
+		setter.Mode = split.Mode
+		// new amount is converted at the current rate
+		if updater.Amount != nil {
+			setter.Rate, setter.Base, err = res.convert(ctx, amount, setter.Shares)
+		} else {
+			err = convertShares(expense.Base, setter.Shares)
+		}
+		switch {
+		case errors.Is(err, money.ErrRate):
+			ProblemNoRate.With(err.Error()).Write(w)
+			return
+		case err != nil:
+			log.Println(err)
+			ProblemInternal.Write(w)
+			return
+		}
+	}
+	// database call
+	err := Track(ctx, res.DB, sid, db.ActivityExpenseEdited, eid, viewExpense(ctx, id), func(tx *db.Store) error {
+		return tx.Expenses.UpdateOne(ctx, id, setter)
+	})
+	switch {
+	case errors.Is(err, db.ErrNoRows):
+		ProblemNotFound.Write(w)
+		return
+	case errors.Is(err, db.ErrInvalidData):
+		ProblemInvalidData.Write(w)
+		return
+	case errors.Is(err, db.ErrConflict): // payer or split not among members
+		ProblemConflict.With("The payer or some member of the split is not a member of the scount.").Write(w)
+		return
+	case err != nil: // unknown error
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent) // ALL OK
+}
+
+// DeleteExpense handles DELETE request at `/scounts/{sid}/expenses/{eid}`.
+// The expense is moved to the trash, to be restored or purged after the
+// retention period.
+func (res ExpenseResource) DeleteExpense(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx = r.Context()
+		sid = ctx.Value(ScountKey).(string)
+		eid = ctx.Value(ExpenseKey).(string)
+	)
+	id := &db.ExpenseId{Sid: sid, Eid: eid}
+	err := Track(ctx, res.DB, sid, db.ActivityExpenseDeleted, eid, viewExpense(ctx, id), func(tx *db.Store) error {
+		return tx.Expenses.DeleteOne(ctx, id)
+	})
+	switch {
+	case errors.Is(err, db.ErrNoRows):
+		ProblemNotFound.Write(w)
+		return
+	case errors.Is(err, db.ErrConflict):
+		ProblemConflict.Write(w)
+		return
+	case err != nil:
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RestoreExpense handles POST request at
+// `/scounts/{sid}/expenses/{eid}/restore`.
+func (res ExpenseResource) RestoreExpense(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx = r.Context()
+		sid = ctx.Value(ScountKey).(string)
+		eid = ctx.Value(ExpenseKey).(string)
+	)
+	id := &db.ExpenseId{Sid: sid, Eid: eid}
+	err := Track(ctx, res.DB, sid, db.ActivityExpenseRestored, eid, viewExpense(ctx, id), func(tx *db.Store) error {
+		return tx.Expenses.Restore(ctx, id)
+	})
+	switch {
+	case errors.Is(err, db.ErrNoRows): // not in the trash
+		ProblemNotFound.Write(w)
+		return
+	case err != nil:
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// editable is the middleware that lets through the payer of the expense
+// and the members having PermEditExpenses, other members get 403
+// Forbidden.
+func (res ExpenseResource) editable(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			ctx    = r.Context()
+			sid    = ctx.Value(ScountKey).(string)
+			eid    = ctx.Value(ExpenseKey).(string)
+			access = ctx.Value(AccessKey).(Access)
+		)
+		if access.Can(PermEditExpenses) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		expense, err := res.DB.Expenses.FindOne(ctx, &db.ExpenseId{Sid: sid, Eid: eid})
+		switch {
+		case errors.Is(err, db.ErrNoRows): // eid not exist
+			ProblemNotFound.Write(w)
+			return
+		case err != nil:
+			log.Println(err)
+			ProblemInternal.Write(w)
+			return
+		}
+		// neither the payer nor allowed to edit others' expenses
+		if expense.Payer != access.Member.Uid || !access.Can(PermAddExpense) {
+			ProblemForbidden.With("Only the payer or members allowed to edit others' expenses are allowed.").Write(w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// equalSplit constructs a Split equally among all members of scount sid.
+func (res ExpenseResource) equalSplit(ctx context.Context, sid string) (*Split, error) {
+	members, err := res.DB.Members.Find(ctx, &db.MemberFilter{Sid: sid}, nil)
+	if err != nil {
+		return nil, err
+	}
+	split := &Split{Mode: db.SplitEqual}
+	members.Iterator(func(m db.Member) bool {
+		split.Parts = append(split.Parts, SplitPart{Member: m.Uid})
+		return true
+	})
+	return split, members.Err()
+}
+
+// convert converts amount of an expense along with its shares into the
+// currency of the scount (from AccessKey), giving the rate used and the
+// converted amount.
+func (res ExpenseResource) convert(
+	ctx context.Context,
+	amount money.Amount,
+	shares []db.Share,
+) (money.Rate, money.Amount, error) {
+	currency := ctx.Value(AccessKey).(Access).Scount.Currency
+	rate, base, err := convert(ctx, res.Rates, amount, currency)
+	if err != nil {
+		return money.Rate{}, money.Amount{}, err
+	}
+	return rate, base, convertShares(base, shares)
+}
+
+// SplitOf reconstructs the requested Split of an existing expense.
+func SplitOf(expense db.Expense) *Split {
+	split := &Split{Mode: expense.Mode}
+	for _, share := range expense.Shares {
+		part := SplitPart{Member: share.Uid}
+		switch expense.Mode {
+		case db.SplitExact:
+			amount := money.New(share.Weight, expense.Amount.Currency)
+			part.Amount = &amount
+		case db.SplitPercent, db.SplitShares:
+			part.Weight = share.Weight
+		}
+		split.Parts = append(split.Parts, part)
+	}
+	return split
+}
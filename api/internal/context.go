@@ -12,4 +12,14 @@ type (
 	QueryKey struct{}
 	// ScountKey is context key type for `sid` path parameter.
 	ScountKey struct{}
+	// ExpenseKey is context key type for `eid` path parameter.
+	ExpenseKey struct{}
+	// SettlementKey is context key type for `stid` path parameter.
+	SettlementKey struct{}
+	// MemberKey is context key type for `uid` path parameter.
+	MemberKey struct{}
+	// InviteKey is context key type for `iid` path parameter.
+	InviteKey struct{}
+	// AccessKey is context key type for access of the current user to a scount.
+	AccessKey struct{}
 )
@@ -1,35 +1,100 @@
 package internal
 
 import (
+	"errors"
+	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/manojnakp/scount/db"
 )
 
-// UserSortMap maps allowed values of *sort* query parameter to
-// corresponding sorters for user resource queries.
-var UserSortMap = map[string]db.Sorter{
-	"id": {
-		Column: "uid",
-	},
-	"email": {
-		Column: "email",
-	},
-	"name": {
-		Column: "username",
-	},
-	"~id": {
-		Column: "uid",
-		Desc:   true,
-	},
-	"~email": {
-		Column: "email",
-		Desc:   true,
-	},
-	"~name": {
-		Column: "username",
-		Desc:   true,
-	},
+// ErrSort defines parsing errors for sort specs.
+var ErrSort = errors.New("invalid sort spec")
+
+// UserSortMap maps allowed fields of *sort* query parameter to
+// corresponding columns for user resource queries.
+var UserSortMap = map[string]db.Column{
+	"id":    "uid",
+	"email": "email",
+	"name":  "username",
+}
+
+// ScountSortMap maps allowed fields of *sort* query parameter to
+// corresponding columns for scount resource queries.
+var ScountSortMap = map[string]db.Column{
+	"sid":   "sid",
+	"owner": "owner",
+	"title": "title",
+}
+
+// ExpenseSortMap maps allowed fields of *sort* query parameter to
+// corresponding columns for expense resource queries.
+var ExpenseSortMap = map[string]db.Column{
+	"id":     "eid",
+	"payer":  "payer",
+	"title":  "title",
+	"amount": "amount",
+}
+
+// SettlementSortMap maps allowed fields of *sort* query parameter to
+// corresponding columns for settlement resource queries.
+var SettlementSortMap = map[string]db.Column{
+	"id":     "stid",
+	"payer":  "payer",
+	"payee":  "payee",
+	"amount": "amount",
+}
+
+// MemberSortMap maps allowed fields of *sort* query parameter to
+// corresponding columns for member resource queries.
+var MemberSortMap = map[string]db.Column{
+	"id":   "uid",
+	"role": "role",
+}
+
+// InviteSortMap maps allowed fields of *sort* query parameter to
+// corresponding columns for invite resource queries.
+var InviteSortMap = map[string]db.Column{
+	"id":      "iid",
+	"expires": "expires",
+}
+
+// ActivitySortMap maps allowed fields of *sort* query parameter to
+// corresponding columns for activity resource queries.
+var ActivitySortMap = map[string]db.Column{
+	"id":    "aid",
+	"actor": "actor",
+	"kind":  "kind",
+	"time":  "time",
+}
+
+// ParseSort parses sort spec like `title,~id` into sorters as per
+// sortMap, `~` prefix meaning descending order. Empty fields are
+// skipped, hence empty spec gives no sorters. Fields not in sortMap, or
+// sorting on the same field twice, gives ErrSort.
+func ParseSort(spec string, sortMap map[string]db.Column) ([]db.Sorter, error) {
+	fields := strings.Split(spec, ",")
+	list := make([]db.Sorter, 0, len(fields))
+	seen := make(map[db.Column]bool, len(fields))
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		// skip empty string
+		if field == "" {
+			continue
+		}
+		name, desc := strings.CutPrefix(field, "~")
+		column, ok := sortMap[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown field %q", ErrSort, name)
+		}
+		if seen[column] {
+			return nil, fmt.Errorf("%w: duplicate field %q", ErrSort, name)
+		}
+		seen[column] = true
+		list = append(list, db.Sorter{Column: column, Desc: desc})
+	}
+	return list, nil
 }
 
 // ParseInt is wrapper on strconv.Atoi with default value in case of empty string.
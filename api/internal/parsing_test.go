@@ -0,0 +1,82 @@
+package internal_test
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/manojnakp/scount/api/internal"
+	"github.com/manojnakp/scount/db"
+)
+
+func TestParseSort(t *testing.T) {
+	sortMap := map[string]db.Column{
+		"id":    "uid",
+		"uid":   "uid", // alias of id
+		"email": "email",
+		"name":  "username",
+	}
+	tests := []struct {
+		spec string
+		want []db.Sorter
+		err  error
+	}{
+		{"", []db.Sorter{}, nil},
+		{"id", []db.Sorter{{Column: "uid"}}, nil},
+		{"~id", []db.Sorter{{Column: "uid", Desc: true}}, nil},
+		{"name,~email", []db.Sorter{{Column: "username"}, {Column: "email", Desc: true}}, nil},
+		{"~name,~email,id", []db.Sorter{
+			{Column: "username", Desc: true},
+			{Column: "email", Desc: true},
+			{Column: "uid"},
+		}, nil},
+		{",", []db.Sorter{}, nil},
+		{"name,,email,", []db.Sorter{{Column: "username"}, {Column: "email"}}, nil},
+		{" name , ~email ", []db.Sorter{{Column: "username"}, {Column: "email", Desc: true}}, nil},
+		{"username", nil, internal.ErrSort},
+		{"Name", nil, internal.ErrSort},
+		{"~", nil, internal.ErrSort},
+		{"~~name", nil, internal.ErrSort},
+		{"- name", nil, internal.ErrSort},
+		{"~ name", nil, internal.ErrSort},
+		{"name,name", nil, internal.ErrSort},
+		{"name,~name", nil, internal.ErrSort},
+		{"id,uid", nil, internal.ErrSort},
+	}
+	for _, tt := range tests {
+		got, err := internal.ParseSort(tt.spec, sortMap)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("ParseSort(%q) error = %v, want %v", tt.spec, err, tt.err)
+			continue
+		}
+		if tt.err == nil && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseSort(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+// TestSortMaps checks that the fields of every sort map refer to the
+// columns allowed for sorting by the datastore.
+func TestSortMaps(t *testing.T) {
+	tests := []struct {
+		name    string
+		sortMap map[string]db.Column
+		allowed []db.Column
+	}{
+		{"user", internal.UserSortMap, db.UserAllowedCols},
+		{"scount", internal.ScountSortMap, db.ScountAllowedCols},
+		{"expense", internal.ExpenseSortMap, db.ExpenseAllowedCols},
+		{"settlement", internal.SettlementSortMap, db.SettlementAllowedCols},
+		{"member", internal.MemberSortMap, db.MemberAllowedCols},
+		{"invite", internal.InviteSortMap, db.InviteAllowedCols},
+		{"activity", internal.ActivitySortMap, db.ActivityAllowedCols},
+	}
+	for _, tt := range tests {
+		for field, column := range tt.sortMap {
+			if !slices.Contains(tt.allowed, column) {
+				t.Errorf("%s: field %q sorts on column %q not allowed", tt.name, field, column)
+			}
+		}
+	}
+}
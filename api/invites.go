@@ -0,0 +1,497 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+
+	"github.com/manojnakp/scount/api/internal"
+	"github.com/manojnakp/scount/db"
+)
+
+// InviteSchema is the location for `Invite` JSON schema.
+const InviteSchema = "/schema/Invite.json"
+
+// Limits on the lifetime of invites, in seconds.
+const (
+	InviteTTL    = 7 * 24 * 60 * 60  // default: a week
+	InviteMaxTTL = 30 * 24 * 60 * 60 // at most: a month
+)
+
+// ErrInviteQuery defines parsing errors for InviteQuery.
+var ErrInviteQuery = errors.New("invalid invite query parameters")
+
+// InviteSorter is the default sort order for invite queries.
+var InviteSorter = []db.Sorter{
+	{
+		Column: "expires",
+	},
+}
+
+// Invite describes the invite resource, that is a link for joining
+// a scount. Token is to be redeemed at `/invites/{token}/accept`. Guest
+// is the guest member to be claimed by the user accepting the invite.
+// schema is defined at `Invite.json`.
+type Invite struct {
+	Schema    string    `json:"$schema,omitempty"`
+	Id        string    `json:"id"`
+	Scount    string    `json:"scount"`
+	Creator   string    `json:"creator"`
+	Role      db.Role   `json:"role"`
+	Guest     string    `json:"guest,omitempty"`
+	Expires   time.Time `json:"expires"`
+	SingleUse bool      `json:"single_use"`
+	Uses      int       `json:"uses"`
+	Token     string    `json:"token"`
+}
+
+// NewInvite constructs the invite resource from db.Invite, along with
+// a signed token for it.
+func NewInvite(invite db.Invite) (Invite, error) {
+	token, err := GenerateInviteToken(invite.Iid, invite.Expires)
+	if err != nil {
+		return Invite{}, err
+	}
+	return Invite{
+		Schema:    InviteSchema,
+		Id:        invite.Iid,
+		Scount:    invite.Sid,
+		Creator:   invite.Creator,
+		Role:      invite.Role,
+		Guest:     invite.Guest,
+		Expires:   invite.Expires,
+		SingleUse: invite.SingleUse,
+		Uses:      invite.Uses,
+		Token:     string(token),
+	}, nil
+}
+
+// InviteQuery describes the url query parameters
+// used for filtering the invites of a scount.
+// schema is defined at `InviteQuery.json`.
+type InviteQuery struct {
+	Id      string
+	Creator string
+	Sort    []db.Sorter
+	Paging  Paginator
+}
+
+// ParseInviteQuery parses the query parameters on invite collection resource.
+func ParseInviteQuery(query url.Values) (*InviteQuery, error) {
+	paging, err := ParsePaginator(query)
+	if err != nil {
+		return nil, err
+	}
+	list, err := internal.ParseSort(query.Get("sort"), internal.InviteSortMap)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid 'sort' parameter: %w", ErrInviteQuery, err)
+	}
+	// fallback to default sorter
+	if len(list) == 0 {
+		list = InviteSorter
+	}
+	return &InviteQuery{
+		Id:      query.Get("id"),
+		Creator: query.Get("creator"),
+		Sort:    list,
+		Paging:  paging,
+	}, nil
+}
+
+// InviteRequest describes new invite creation request. TTL is the
+// lifetime of the invite in seconds, defaults to InviteTTL. Role of
+// the joining members defaults to `member`, and cannot be `owner`.
+// Invites for claiming a Guest member are always single use, and the
+// role of the guest is kept.
+// schema is defined at `InviteRequest.json`
+type InviteRequest struct {
+	Role      db.Role `json:"role,omitempty"`
+	Guest     string  `json:"guest,omitempty"`
+	TTL       int     `json:"ttl,omitempty"`
+	SingleUse bool    `json:"single_use,omitempty"`
+}
+
+// Validate implements Validator on InviteRequest.
+func (i InviteRequest) Validate() error {
+	var invalid ValidationError
+	if i.Role != "" && (!i.Role.Valid() || i.Role == db.RoleOwner) {
+		invalid.Add("role", ReasonRole)
+	}
+	if i.TTL < 0 || i.TTL > InviteMaxTTL {
+		invalid.Add("ttl", fmt.Sprintf("must be between 0 and %d", InviteMaxTTL))
+	}
+	if i.Guest != "" && i.Role != "" {
+		invalid.Add("role", "must not be given along with guest")
+	}
+	return invalid.Err()
+}
+
+// InviteResponse points to the newly created invite resource, along
+// with the token to be shared.
+// schema is defined at `InviteResponse.json`
+type InviteResponse struct {
+	Schema   string `json:"$schema,omitempty"`
+	InviteId string `json:"invite_id"`
+	Token    string `json:"token"`
+}
+
+// InviteResource is the http.Handler for all requests to
+// `/scounts/{sid}/invites`. Managing invites requires PermManageMembers.
+//
+// Pre-requisite: ScountKey, AuthUserKey and AccessKey should be present
+// in request context, hence it is supposed to be mounted under
+// ScountResource.
+type InviteResource struct {
+	DB *db.Store
+}
+
+// InvitePathWare is the middleware to set context key corresponding
+// to "iid" path parameter using InviteKey.
+func InvitePathWare(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		iid := chi.URLParam(r, "iid")
+		ctx := context.WithValue(r.Context(), InviteKey, iid)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Router constructs a new chi.Router for the InviteResource.
+func (res InviteResource) Router() chi.Router {
+	r := chi.NewRouter()
+	r.Use(Require(PermManageMembers))
+	r.With(QueryParser(ParseInviteQuery)).
+		Get("/", res.ListInvites)
+	r.With(Schemaware("InviteRequest.json"), BodyParser[InviteRequest], Validware[InviteRequest]).
+		Post("/", res.CreateInvite)
+	r.Route("/{iid}", func(r chi.Router) {
+		r.Use(InvitePathWare)
+		r.Get("/", res.GetInvite)
+		r.Delete("/", res.RevokeInvite)
+	})
+	return r
+}
+
+// ServeHTTP implements http.Handler on InviteResource.
+func (res InviteResource) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	mux := res.Router()
+	mux.ServeHTTP(w, r)
+}
+
+// ListInvites handles GET requests at `/scounts/{sid}/invites`.
+func (res InviteResource) ListInvites(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx   = r.Context()
+		sid   = ctx.Value(ScountKey).(string)
+		query = ctx.Value(QueryKey).(*InviteQuery)
+	)
+	projector, err := query.Paging.Projector(query.Sort, db.InviteKeyCols)
+	if err != nil {
+		ProblemInvalidQuery.With(err.Error()).Write(w)
+		return
+	}
+	// database call
+	invites, err := res.DB.Invites.Find(
+		ctx,
+		&db.InviteFilter{Sid: sid, Iid: query.Id, Creator: query.Creator},
+		projector,
+	)
+	switch {
+	case errors.Is(err, db.ErrInvalidColumn):
+		ProblemInvalidColumn.Write(w)
+		return
+	case err != nil:
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	page, err := PageOf(path.Join("/scounts", sid, "invites"), r.URL.Query(), query.Paging, projector, invites)
+	if err != nil {
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	// build response collection
+	list := make([]Invite, 0, len(page.Items))
+	for _, invite := range page.Items {
+		item, err := NewInvite(invite)
+		if err != nil {
+			log.Println(err)
+			ProblemInternal.Write(w)
+			return
+		}
+		list = append(list, item)
+	}
+	page.Header(w)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(list)
+}
+
+// CreateInvite handles POST request at `/scounts/{sid}/invites`. Guest
+// to be claimed must be a guest member of the scount.
+func (res InviteResource) CreateInvite(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx  = r.Context()
+		sid  = ctx.Value(ScountKey).(string)
+		uid  = ctx.Value(AuthUserKey).(string)
+		body = ctx.Value(BodyKey).(InviteRequest)
+		iid  = GenerateID()
+	)
+	// defaults
+	role := body.Role
+	if role == "" {
+		role = db.RoleMember
+	}
+	ttl := body.TTL
+	if ttl == 0 {
+		ttl = InviteTTL
+	}
+	// guest is claimed at most once
+	single := body.SingleUse
+	if body.Guest != "" {
+		guest, err := res.DB.Members.FindOne(ctx, &db.MemberId{Sid: sid, Uid: body.Guest})
+		switch {
+		case errors.Is(err, db.ErrNoRows): // guest not a member
+			ProblemNotFound.With("The guest is not a member of the scount.").Write(w)
+			return
+		case err != nil:
+			log.Println(err)
+			ProblemInternal.Write(w)
+			return
+		case !guest.Guest: // registered user
+			ProblemConflict.With("The member to be claimed is not a guest.").Write(w)
+			return
+		}
+		role = guest.Role
+		single = true
+	}
+	// expiry at a precision the db keeps, for tokens to match
+	expires := time.Now().Add(time.Duration(ttl) * time.Second).Truncate(time.Second)
+	token, err := GenerateInviteToken(iid, expires)
+	if err != nil {
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	// insert into db
+	err = res.DB.Invites.Insert(ctx, db.Invite{
+		Iid:       iid,
+		Sid:       sid,
+		Creator:   uid,
+		Role:      role,
+		Guest:     body.Guest,
+		Expires:   expires,
+		SingleUse: single,
+	})
+	// match error
+	switch {
+	case errors.Is(err, db.ErrInvalidData), errors.Is(err, db.ErrSyntaxPrivilege):
+		ProblemInvalidData.Write(w)
+		return
+	case errors.Is(err, db.ErrConflict):
+		ProblemConflict.Write(w)
+		return
+	case err != nil:
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	// newly created invite resource location
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", path.Join("/scounts", sid, "invites", iid))
+	w.WriteHeader(http.StatusOK)
+	// json response
+	_ = json.NewEncoder(w).Encode(InviteResponse{
+		Schema:   "/schema/InviteResponse.json",
+		InviteId: iid,
+		Token:    string(token),
+	})
+}
+
+// GetInvite handles GET requests at `/scounts/{sid}/invites/{iid}`.
+func (res InviteResource) GetInvite(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx = r.Context()
+		sid = ctx.Value(ScountKey).(string)
+		iid = ctx.Value(InviteKey).(string)
+	)
+	invite, err := res.DB.Invites.FindOne(ctx, &db.InviteId{Sid: sid, Iid: iid})
+	switch {
+	case errors.Is(err, db.ErrNoRows): // iid not exist
+		ProblemNotFound.Write(w)
+		return
+	case err != nil: // failed to query the db
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	resp, err := NewInvite(invite)
+	if err != nil {
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // ALL OK
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// RevokeInvite handles DELETE request at `/scounts/{sid}/invites/{iid}`.
+// Tokens of a revoked invite are no longer accepted.
+func (res InviteResource) RevokeInvite(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx = r.Context()
+		sid = ctx.Value(ScountKey).(string)
+		iid = ctx.Value(InviteKey).(string)
+	)
+	err := res.DB.Invites.DeleteOne(ctx, &db.InviteId{Sid: sid, Iid: iid})
+	switch {
+	case errors.Is(err, db.ErrNoRows):
+		ProblemNotFound.Write(w)
+		return
+	case err != nil:
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AcceptResource is the http.Handler for all requests to `/invites`,
+// where any authenticated user redeems invite tokens.
+type AcceptResource struct {
+	DB *db.Store
+}
+
+// Router constructs a new chi.Router for the AcceptResource.
+func (res AcceptResource) Router() chi.Router {
+	r := chi.NewRouter()
+	r.Use(Authware)
+	r.Post("/{token}/accept", res.AcceptInvite)
+	return r
+}
+
+// ServeHTTP implements http.Handler on AcceptResource.
+func (res AcceptResource) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	mux := res.Router()
+	mux.ServeHTTP(w, r)
+}
+
+// AcceptInvite handles POST request at `/invites/{token}/accept`. The
+// current user joins the scount of the invite with the role of the
+// invite, claiming the guest of the invite (if any) along with its
+// history. Invalid or revoked tokens are not found, while expired and
+// used up invites are gone. Existing members are a conflict.
+func (res AcceptResource) AcceptInvite(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx = r.Context()
+		uid = ctx.Value(AuthUserKey).(string)
+	)
+	iid, err := ParseInviteToken(chi.URLParam(r, "token"))
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired()):
+		ProblemGone.With("The invite has expired.").Write(w)
+		return
+	case err != nil:
+		ProblemNotFound.With("The invite token is invalid.").Write(w)
+		return
+	}
+	id := &db.InviteId{Iid: iid}
+	invite, err := res.DB.Invites.FindOne(ctx, id)
+	switch {
+	case errors.Is(err, db.ErrNoRows): // revoked
+		ProblemNotFound.With("The invite was revoked.").Write(w)
+		return
+	case err != nil:
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	// invites of scounts in the trash are on hold
+	_, err = res.DB.Scounts.FindOne(ctx, &db.ScountId{Sid: invite.Sid})
+	switch {
+	case errors.Is(err, db.ErrNoRows):
+		ProblemNotFound.With("The scount of the invite does not exist.").Write(w)
+		return
+	case err != nil:
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	// joining twice does not use up the invite
+	_, err = res.DB.Members.FindOne(ctx, &db.MemberId{Sid: invite.Sid, Uid: uid})
+	switch {
+	case err == nil: // already a member
+		ProblemConflict.With("The user is already a member of the scount.").Write(w)
+		return
+	case !errors.Is(err, db.ErrNoRows):
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	// use up the invite only upon joining
+	joined := false
+	err = res.DB.WithTx(ctx, func(tx *db.Store) error {
+		err := tx.Invites.Use(ctx, id)
+		if err != nil {
+			return err
+		}
+		joined = true
+		// insert into db, or take over the guest
+		var before any
+		if invite.Guest != "" {
+			guest := &db.MemberId{Sid: invite.Sid, Uid: invite.Guest}
+			before, err = viewMember(ctx, guest)(tx)
+			if err != nil {
+				return err
+			}
+			err = tx.Members.Claim(ctx, guest, uid)
+		} else {
+			err = tx.Members.Insert(ctx, db.Member{Sid: invite.Sid, Uid: uid, Role: invite.Role})
+		}
+		if err != nil {
+			return err
+		}
+		after, err := viewMember(ctx, &db.MemberId{Sid: invite.Sid, Uid: uid})(tx)
+		if err != nil {
+			return err
+		}
+		return Record(ctx, tx, invite.Sid, db.ActivityMemberAdded, uid, before, after)
+	})
+	// match error
+	switch {
+	case !joined && errors.Is(err, db.ErrNoRows): // revoked meanwhile
+		ProblemNotFound.With("The invite was revoked.").Write(w)
+		return
+	case !joined && errors.Is(err, db.ErrConflict): // expired or used up
+		ProblemGone.With("The invite has expired or is used up.").Write(w)
+		return
+	case errors.Is(err, db.ErrNoRows): // guest removed meanwhile
+		ProblemGone.With("The guest of the invite was removed.").Write(w)
+		return
+	case errors.Is(err, db.ErrConflict): // joined meanwhile
+		ProblemConflict.With("The user is already a member of the scount.").Write(w)
+		return
+	case err != nil:
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	// newly added member resource location
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", path.Join("/scounts", invite.Sid, "members", uid))
+	w.WriteHeader(http.StatusOK)
+	// json response
+	_ = json.NewEncoder(w).Encode(MemberResponse{
+		Schema:   "/schema/MemberResponse.json",
+		MemberId: uid,
+	})
+}
@@ -0,0 +1,456 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/manojnakp/scount/api/internal"
+	"github.com/manojnakp/scount/db"
+)
+
+// MemberSchema is the location for `Member` JSON schema.
+const MemberSchema = "/schema/Member.json"
+
+// ErrMemberQuery defines parsing errors for MemberQuery.
+var ErrMemberQuery = errors.New("invalid member query parameters")
+
+// ErrMemberRemoval is returned when a member cannot be removed from a scount.
+var ErrMemberRemoval = errors.New("api: member cannot be removed")
+
+// MemberSorter is the default sort order for member queries.
+var MemberSorter = []db.Sorter{
+	{
+		Column: "uid",
+	},
+}
+
+// Member describes the member resource, that is a user taking part
+// in a scount. Guests are placeholders without a user account, known
+// by their display name only.
+// schema is defined at `Member.json`.
+type Member struct {
+	Schema string  `json:"$schema,omitempty"`
+	Id     string  `json:"id"`
+	Scount string  `json:"scount"`
+	Role   db.Role `json:"role"`
+	Name   string  `json:"name,omitempty"`
+	Guest  bool    `json:"guest,omitempty"`
+}
+
+// NewMember constructs the member resource from db.Member.
+func NewMember(member db.Member) Member {
+	return Member{
+		Schema: MemberSchema,
+		Id:     member.Uid,
+		Scount: member.Sid,
+		Role:   member.Role,
+		Name:   member.Name,
+		Guest:  member.Guest,
+	}
+}
+
+// MemberQuery describes the url query parameters
+// used for filtering the members of a scount.
+// schema is defined at `MemberQuery.json`.
+type MemberQuery struct {
+	Id     string
+	Role   db.Role
+	Sort   []db.Sorter
+	Paging Paginator
+}
+
+// ParseMemberQuery parses the query parameters on member collection resource.
+func ParseMemberQuery(query url.Values) (*MemberQuery, error) {
+	paging, err := ParsePaginator(query)
+	if err != nil {
+		return nil, err
+	}
+	list, err := internal.ParseSort(query.Get("sort"), internal.MemberSortMap)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid 'sort' parameter: %w", ErrMemberQuery, err)
+	}
+	// fallback to default sorter
+	if len(list) == 0 {
+		list = MemberSorter
+	}
+	role := db.Role(query.Get("role"))
+	if role != "" && !role.Valid() {
+		return nil, fmt.Errorf("%w: invalid 'role' parameter", ErrMemberQuery)
+	}
+	return &MemberQuery{
+		Id:     query.Get("id"),
+		Role:   role,
+		Sort:   list,
+		Paging: paging,
+	}, nil
+}
+
+// MemberRequest describes new member addition request. Exactly one of
+// user id or email of the user to be added, or the display name of a
+// guest, is required. Role defaults to `member`, and cannot be `owner`.
+// schema is defined at `MemberRequest.json`
+type MemberRequest struct {
+	Uid   string  `json:"uid,omitempty"`
+	Email string  `json:"email,omitempty"`
+	Name  string  `json:"name,omitempty"`
+	Role  db.Role `json:"role,omitempty"`
+}
+
+// Validate implements Validator on MemberRequest.
+func (m MemberRequest) Validate() error {
+	var (
+		invalid ValidationError
+		count   int
+	)
+	for _, s := range []string{m.Uid, m.Email, m.Name} {
+		if s != "" {
+			count++
+		}
+	}
+	if count != 1 {
+		invalid.Add("uid", "exactly one of uid, email and name must be given")
+	}
+	if m.Role != "" && (!m.Role.Valid() || m.Role == db.RoleOwner) {
+		invalid.Add("role", ReasonRole)
+	}
+	return invalid.Err()
+}
+
+// ReasonRole is the reason of an invalid role of a member, as the
+// ownership is transferred through ScountUpdater alone.
+const ReasonRole = "must be one of admin, member and viewer"
+
+// MemberUpdater describes member role change request. Ownership is
+// transferred through ScountUpdater instead, hence role cannot be
+// `owner`.
+// schema is defined at `MemberUpdater.json`
+type MemberUpdater struct {
+	Role db.Role `json:"role,omitempty"`
+}
+
+// Validate implements Validator on MemberUpdater.
+func (m MemberUpdater) Validate() error {
+	var invalid ValidationError
+	if m.Role != "" && (!m.Role.Valid() || m.Role == db.RoleOwner) {
+		invalid.Add("role", ReasonRole)
+	}
+	return invalid.Err()
+}
+
+// MemberResponse points to the newly added member resource.
+// schema is defined at `MemberResponse.json`
+type MemberResponse struct {
+	Schema   string `json:"$schema,omitempty"`
+	MemberId string `json:"member_id"`
+}
+
+// MemberResource is the http.Handler for all requests to
+// `/scounts/{sid}/members`.
+//
+// Pre-requisite: ScountKey, AuthUserKey and AccessKey should be present
+// in request context, hence it is supposed to be mounted under
+// ScountResource.
+type MemberResource struct {
+	DB *db.Store
+}
+
+// MemberPathWare is the middleware to set context key corresponding
+// to "uid" path parameter using MemberKey. `me` refers to the current
+// user.
+func MemberPathWare(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uid := chi.URLParam(r, "uid")
+		if uid == "me" {
+			uid = r.Context().Value(AuthUserKey).(string)
+		}
+		ctx := context.WithValue(r.Context(), MemberKey, uid)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Router constructs a new chi.Router for the MemberResource.
+func (res MemberResource) Router() chi.Router {
+	r := chi.NewRouter()
+	r.With(QueryParser(ParseMemberQuery)).
+		Get("/", res.ListMembers)
+	r.With(Require(PermManageMembers), Schemaware("MemberRequest.json"), BodyParser[MemberRequest], Validware[MemberRequest]).
+		Post("/", res.AddMember)
+	r.Route("/{uid}", func(r chi.Router) {
+		r.Use(MemberPathWare)
+		r.Get("/", res.GetMember)
+		r.With(Require(PermManageMembers), Schemaware("MemberUpdater.json"), BodyParser[MemberUpdater], Validware[MemberUpdater]).
+			Patch("/", res.UpdateMember)
+		r.Delete("/", res.RemoveMember)
+	})
+	return r
+}
+
+// ServeHTTP implements http.Handler on MemberResource.
+func (res MemberResource) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	mux := res.Router()
+	mux.ServeHTTP(w, r)
+}
+
+// ListMembers handles GET requests at `/scounts/{sid}/members`.
+func (res MemberResource) ListMembers(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx   = r.Context()
+		sid   = ctx.Value(ScountKey).(string)
+		query = ctx.Value(QueryKey).(*MemberQuery)
+	)
+	projector, err := query.Paging.Projector(query.Sort, db.MemberKeyCols)
+	if err != nil {
+		ProblemInvalidQuery.With(err.Error()).Write(w)
+		return
+	}
+	// database call
+	members, err := res.DB.Members.Find(
+		ctx,
+		&db.MemberFilter{Sid: sid, Uid: query.Id, Role: query.Role},
+		projector,
+	)
+	switch {
+	case errors.Is(err, db.ErrInvalidColumn):
+		ProblemInvalidColumn.Write(w)
+		return
+	case err != nil:
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	page, err := PageOf(path.Join("/scounts", sid, "members"), r.URL.Query(), query.Paging, projector, members)
+	if err != nil {
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	// build response collection
+	list := make([]Member, 0, len(page.Items))
+	for _, member := range page.Items {
+		list = append(list, NewMember(member))
+	}
+	page.Header(w)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(list)
+}
+
+// AddMember handles POST request at `/scounts/{sid}/members`. The user
+// to be added is looked up by uid or email, otherwise a guest is added
+// by name.
+func (res MemberResource) AddMember(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx  = r.Context()
+		sid  = ctx.Value(ScountKey).(string)
+		body = ctx.Value(BodyKey).(MemberRequest)
+	)
+	role := body.Role
+	if role == "" {
+		role = db.RoleMember
+	}
+	member := db.Member{Sid: sid, Role: role}
+	// lookup the user
+	var (
+		user db.User
+		err  error
+	)
+	switch {
+	case body.Name != "": // guest gets an id of its own
+		member.Uid = GenerateID()
+		member.Name = body.Name
+		member.Guest = true
+	case body.Email != "":
+		user, err = res.DB.Users.FindByEmail(ctx, body.Email)
+	default:
+		user, err = res.DB.Users.FindOne(ctx, &db.UserId{Uid: body.Uid})
+	}
+	switch {
+	case errors.Is(err, db.ErrNoRows): // user not exist
+		ProblemNotFound.With("The user to be added does not exist.").Write(w)
+		return
+	case err != nil:
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	if !member.Guest {
+		member.Uid = user.Uid
+	}
+	// insert into db
+	id := &db.MemberId{Sid: sid, Uid: member.Uid}
+	err = Track(ctx, res.DB, sid, db.ActivityMemberAdded, member.Uid, viewMember(ctx, id), func(tx *db.Store) error {
+		return tx.Members.Insert(ctx, member)
+	})
+	// match error
+	switch {
+	case errors.Is(err, db.ErrInvalidData), errors.Is(err, db.ErrSyntaxPrivilege):
+		ProblemInvalidData.Write(w)
+		return
+	case errors.Is(err, db.ErrConflict): // already a member
+		ProblemConflict.With("The user is already a member of the scount.").Write(w)
+		return
+	case err != nil:
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	// newly added member resource location
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", path.Join("/scounts", sid, "members", member.Uid))
+	w.WriteHeader(http.StatusOK)
+	// json response
+	_ = json.NewEncoder(w).Encode(MemberResponse{
+		Schema:   "/schema/MemberResponse.json",
+		MemberId: member.Uid,
+	})
+}
+
+// GetMember handles GET requests at `/scounts/{sid}/members/{uid}`.
+func (res MemberResource) GetMember(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx = r.Context()
+		sid = ctx.Value(ScountKey).(string)
+		uid = ctx.Value(MemberKey).(string)
+	)
+	member, err := res.DB.Members.FindOne(ctx, &db.MemberId{Sid: sid, Uid: uid})
+	switch {
+	case errors.Is(err, db.ErrNoRows): // uid not a member
+		ProblemNotFound.Write(w)
+		return
+	case err != nil: // failed to query the db
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // ALL OK
+	_ = json.NewEncoder(w).Encode(NewMember(member))
+}
+
+// UpdateMember handles PATCH request at `/scounts/{sid}/members/{uid}`.
+// The role of the owner cannot be changed, that being a conflict.
+func (res MemberResource) UpdateMember(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx     = r.Context()
+		sid     = ctx.Value(ScountKey).(string)
+		uid     = ctx.Value(MemberKey).(string)
+		updater = ctx.Value(BodyKey).(MemberUpdater)
+		access  = ctx.Value(AccessKey).(Access)
+	)
+	var zero MemberUpdater
+	// nothing to update: success
+	if updater == zero {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	// owner demoted only by transferring the ownership
+	if access.Scount.Owner == uid {
+		ProblemConflict.With("The role of the owner changes only by transferring the ownership.").Write(w)
+		return
+	}
+	// database call
+	id := &db.MemberId{Sid: sid, Uid: uid}
+	err := Track(ctx, res.DB, sid, db.ActivityMemberUpdated, uid, viewMember(ctx, id), func(tx *db.Store) error {
+		return tx.Members.UpdateOne(ctx, id, &db.MemberUpdater{Role: updater.Role})
+	})
+	switch {
+	case errors.Is(err, db.ErrNoRows): // uid not a member
+		ProblemNotFound.Write(w)
+		return
+	case errors.Is(err, db.ErrInvalidData):
+		ProblemInvalidData.Write(w)
+		return
+	case errors.Is(err, db.ErrConflict): // conflict
+		ProblemConflict.Write(w)
+		return
+	case err != nil: // unknown error
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent) // ALL OK
+}
+
+// RemoveMember handles DELETE request at `/scounts/{sid}/members/{uid}`,
+// `/scounts/{sid}/members/me` being the current user leaving the scount.
+// Removing other members requires PermManageMembers. The owner cannot leave without
+// transferring ownership and a member with non-zero balance cannot be
+// removed, both being a conflict. Expenses and settlements of the member
+// are kept, by a guest named db.FormerMember in its place.
+func (res MemberResource) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx    = r.Context()
+		sid    = ctx.Value(ScountKey).(string)
+		uid    = ctx.Value(MemberKey).(string)
+		access = ctx.Value(AccessKey).(Access)
+	)
+	// neither leaving nor managing members
+	if uid != access.Member.Uid && !access.Can(PermManageMembers) {
+		ProblemForbidden.With("The role of the user in the scount does not allow it.").Write(w)
+		return
+	}
+	err := res.removable(ctx, access.Scount, uid)
+	switch {
+	case errors.Is(err, db.ErrNoRows):
+		ProblemNotFound.Write(w)
+		return
+	case errors.Is(err, ErrMemberRemoval) && uid == access.Scount.Owner:
+		ProblemOwnerRemoval.Write(w)
+		return
+	case errors.Is(err, ErrMemberRemoval):
+		ProblemMemberBalance.Write(w)
+		return
+	case err != nil:
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	// a former member guest keeps the history (if any) in place
+	id := &db.MemberId{Sid: sid, Uid: uid}
+	err = Track(ctx, res.DB, sid, db.ActivityMemberRemoved, uid, viewMember(ctx, id), func(tx *db.Store) error {
+		return tx.Members.Leave(ctx, id, GenerateID())
+	})
+	switch {
+	case errors.Is(err, db.ErrNoRows):
+		ProblemNotFound.Write(w)
+		return
+	case errors.Is(err, db.ErrConflict): // guest with history
+		ProblemConflict.With("The guest is still referred to by expenses or settlements.").Write(w)
+		return
+	case err != nil:
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// removable checks whether member uid can be removed from scount. If not
+// a member, then db.ErrNoRows. If the member owns the scount or has a
+// non-zero balance, then ErrMemberRemoval.
+func (res MemberResource) removable(ctx context.Context, scount db.Scount, uid string) error {
+	if scount.Owner == uid {
+		return fmt.Errorf("%w: %q owns the scount", ErrMemberRemoval, uid)
+	}
+	balances, err := res.DB.Scounts.Balances(ctx, scount.Sid)
+	if err != nil {
+		return err
+	}
+	for _, b := range balances {
+		if b.Uid != uid {
+			continue
+		}
+		if !b.Net().IsZero() {
+			return fmt.Errorf("%w: %q has balance %s", ErrMemberRemoval, uid, b.Net())
+		}
+		return nil
+	}
+	return db.ErrNoRows
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"mime"
 	"net/http"
@@ -17,11 +18,16 @@ import (
 
 // Context keys used for passing data across middlewares.
 var (
-	BodyKey     internal.BodyKey
-	AuthUserKey internal.AuthUserKey
-	UserKey     internal.UserKey
-	QueryKey    internal.QueryKey
-	ScountKey   internal.ScountKey
+	BodyKey       internal.BodyKey
+	AuthUserKey   internal.AuthUserKey
+	UserKey       internal.UserKey
+	QueryKey      internal.QueryKey
+	ScountKey     internal.ScountKey
+	ExpenseKey    internal.ExpenseKey
+	SettlementKey internal.SettlementKey
+	MemberKey     internal.MemberKey
+	InviteKey     internal.InviteKey
+	AccessKey     internal.AccessKey
 )
 
 // Middleware is a convenient alias for http middleware.
@@ -43,14 +49,14 @@ func BodyParser[T any](next http.Handler) http.Handler {
 		mediatype, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
 		// missing or non-json media type
 		if err != nil || mediatype != "application/json" {
-			w.WriteHeader(http.StatusUnsupportedMediaType)
+			ProblemUnsupportedMediaType.Write(w)
 			log.Println(err)
 			return
 		}
 		err = json.NewDecoder(r.Body).Decode(&body)
 		// request body not conforming to schema
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+			malformed(err).Write(w)
 			log.Println(err)
 			return
 		}
@@ -59,6 +65,18 @@ func BodyParser[T any](next http.Handler) http.Handler {
 	})
 }
 
+// malformed gives the problem of the request body failing to decode
+// with err, pointing out the field if of the wrong type.
+func malformed(err error) Problem {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		p := ProblemMalformedBody
+		p.InvalidParams = []InvalidParam{{Name: typeErr.Field, Reason: "cannot be " + typeErr.Value}}
+		return p
+	}
+	return ProblemMalformedBody.With(err.Error())
+}
+
 // QueryParser is a generic url query parser. Parsed query parameters
 // are stored in context with key QueryKey.
 func QueryParser[T any](parser func(url.Values) (T, error)) Middleware {
@@ -67,13 +85,13 @@ func QueryParser[T any](parser func(url.Values) (T, error)) Middleware {
 			err := r.ParseForm()
 			if err != nil {
 				log.Println(err)
-				w.WriteHeader(http.StatusBadRequest)
+				ProblemInvalidQuery.Write(w)
 				return
 			}
 			query, err := parser(r.Form)
 			if err != nil {
 				log.Println(err)
-				w.WriteHeader(http.StatusBadRequest)
+				ProblemInvalidQuery.With(err.Error()).Write(w)
 				return
 			}
 			ctx := context.WithValue(r.Context(), QueryKey, query)
@@ -92,7 +110,7 @@ func Validware[T Validator](next http.Handler) http.Handler {
 		body := r.Context().Value(BodyKey).(T)
 		err := body.Validate()
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+			ProblemOf(err).Write(w)
 			log.Println(err)
 			return
 		}
@@ -112,7 +130,7 @@ func Authware(next http.Handler) http.Handler {
 		)
 		if err != nil {
 			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
-			w.WriteHeader(http.StatusUnauthorized)
+			ProblemUnauthorized.With("The auth token is missing, invalid or expired.").Write(w)
 			return
 		}
 		ctx := context.WithValue(r.Context(), AuthUserKey, token.Subject())
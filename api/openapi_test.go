@@ -0,0 +1,611 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/manojnakp/scount/api"
+	"github.com/manojnakp/scount/db"
+	"github.com/manojnakp/scount/db/memory"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// SpecURL is the URL of `openapi.json`, against which its references to
+// the JSON schemas (like `./schema/Scount.json`) are resolved.
+const SpecURL = "scount:///openapi.json"
+
+// Methods are the http methods of the operations of a path item, in the
+// order they are replayed.
+var Methods = []string{"get", "put", "post", "patch", "delete"}
+
+// Spec is the contract of the api as documented in `openapi.json`, with
+// its parts located by JSON pointers (like `/paths/~1scounts/get`).
+type Spec struct {
+	doc      any
+	paths    []string // in the order documented
+	compiler *jsonschema.Compiler
+}
+
+// Operation is an operation documented in Spec.
+type Operation struct {
+	Id     string
+	Method string // upper case, like `GET`
+	Path   string // like `/scounts/{sid}`
+	Ptr    string // JSON pointer to the operation object
+}
+
+// String implements fmt.Stringer on Operation.
+func (op Operation) String() string {
+	return op.Method + " " + op.Path
+}
+
+// LoadSpec loads the Spec from `openapi.json` at the root of the module,
+// along with the JSON schemas it refers to.
+func LoadSpec(t *testing.T) *Spec {
+	t.Helper()
+	root := os.DirFS("..")
+	b, err := fs.ReadFile(root, "openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Paths json.RawMessage `json:"paths"`
+	}
+	err = json.Unmarshal(b, &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths, err := keys(doc.Paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := &Spec{paths: paths, compiler: jsonschema.NewCompiler()}
+	err = decode(b, &spec.doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec.compiler.Draft = jsonschema.Draft2020
+	spec.compiler.AssertFormat = true
+	spec.compiler.LoadURL = func(url string) (io.ReadCloser, error) {
+		name, ok := strings.CutPrefix(url, "scount:///")
+		if !ok {
+			return nil, fmt.Errorf("schema %q outside the module", url)
+		}
+		return root.Open(name)
+	}
+	return spec
+}
+
+// Operations lists the operations of s, in the order documented.
+func (s *Spec) Operations() []Operation {
+	var ops []Operation
+	for _, path := range s.paths {
+		item, _ := s.Lookup(Pointer("paths", path)).(map[string]any)
+		for _, method := range Methods {
+			op, ok := item[method].(map[string]any)
+			if !ok {
+				continue
+			}
+			id, _ := op["operationId"].(string)
+			ops = append(ops, Operation{
+				Id:     id,
+				Method: strings.ToUpper(method),
+				Path:   path,
+				Ptr:    Pointer("paths", path, method),
+			})
+		}
+	}
+	return ops
+}
+
+// Lookup gives the value at the JSON pointer ptr, following `$ref`s
+// within s on the way. nil if not found.
+func (s *Spec) Lookup(ptr string) any {
+	value, _ := s.Resolve(ptr)
+	return value
+}
+
+// Resolve gives the value at the JSON pointer ptr along with the pointer
+// at which it is actually defined, following `$ref`s within s.
+func (s *Spec) Resolve(ptr string) (any, string) {
+	value, resolved := s.doc, ""
+	tokens := strings.Split(ptr, "/")[1:]
+	for len(tokens) != 0 {
+		value, resolved = s.deref(value, resolved)
+		token := strings.NewReplacer("~1", "/", "~0", "~").Replace(tokens[0])
+		switch v := value.(type) {
+		case map[string]any:
+			value = v[token]
+		case []any:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, ""
+			}
+			value = v[i]
+		default:
+			return nil, ""
+		}
+		resolved += "/" + tokens[0]
+		tokens = tokens[1:]
+	}
+	return s.deref(value, resolved)
+}
+
+// deref follows value if a `$ref` within s.
+func (s *Spec) deref(value any, ptr string) (any, string) {
+	object, _ := value.(map[string]any)
+	ref, ok := object["$ref"].(string)
+	if !ok || !strings.HasPrefix(ref, "#/") {
+		return value, ptr
+	}
+	return s.Resolve(strings.TrimPrefix(ref, "#"))
+}
+
+// Schema compiles the JSON schema at the JSON pointer ptr.
+func (s *Spec) Schema(ptr string) (*jsonschema.Schema, error) {
+	_, resolved := s.Resolve(ptr)
+	return s.compiler.Compile(SpecURL + "#" + resolved)
+}
+
+// Parameters lists the parameters of op located in (`path` or `query`),
+// those of its path item included.
+func (s *Spec) Parameters(op Operation, in string) []map[string]any {
+	var params []map[string]any
+	item := Pointer("paths", op.Path)
+	for _, ptr := range []string{item + "/parameters", op.Ptr + "/parameters"} {
+		list, _ := s.Lookup(ptr).([]any)
+		for i := range list {
+			param, _ := s.Lookup(ptr + "/" + strconv.Itoa(i)).(map[string]any)
+			if param["in"] == in {
+				params = append(params, param)
+			}
+		}
+	}
+	return params
+}
+
+// Examples lists the examples of the media type object at the JSON
+// pointer ptr (like a request body of JSON), by name.
+func (s *Spec) Examples(ptr string) map[string]any {
+	examples := make(map[string]any)
+	media, _ := s.Lookup(ptr).(map[string]any)
+	if example, ok := media["example"]; ok {
+		examples["example"] = example
+	}
+	named, _ := media["examples"].(map[string]any)
+	for name := range named {
+		example, _ := s.Lookup(ptr + "/examples/" + Escape(name)).(map[string]any)
+		examples[name] = example["value"]
+	}
+	return examples
+}
+
+// Check checks that the response to op is documented, with the body
+// valid against the schema of its media type.
+func (s *Spec) Check(op Operation, res *httptest.ResponseRecorder) error {
+	ptr := op.Ptr + "/responses/" + strconv.Itoa(res.Code)
+	if s.Lookup(ptr) == nil {
+		ptr = op.Ptr + "/responses/default"
+	}
+	response, _ := s.Lookup(ptr).(map[string]any)
+	if response == nil {
+		return fmt.Errorf("status %d not documented: %s", res.Code, res.Body)
+	}
+	content, _ := response["content"].(map[string]any)
+	if len(content) == 0 {
+		if res.Body.Len() != 0 {
+			return fmt.Errorf("status %d documented without body: %s", res.Code, res.Body)
+		}
+		return nil
+	}
+	mediatype, _, _ := mime.ParseMediaType(res.Header().Get("Content-Type"))
+	if _, ok := content[mediatype]; !ok {
+		// handlers omit the content type of json bodies at times
+		mediatype = "application/json"
+	}
+	if _, ok := content[mediatype]; !ok {
+		return fmt.Errorf("status %d: media type %q not documented", res.Code, mediatype)
+	}
+	schema, err := s.Schema(ptr + "/content/" + Escape(mediatype) + "/schema")
+	if err != nil {
+		return err
+	}
+	var body any
+	err = decode(res.Body.Bytes(), &body)
+	if err != nil {
+		return fmt.Errorf("status %d: %w: %s", res.Code, err, res.Body)
+	}
+	err = schema.Validate(body)
+	if err != nil {
+		return fmt.Errorf("status %d: %#v: %s", res.Code, err, res.Body)
+	}
+	return nil
+}
+
+// Pointer constructs the JSON pointer to the value at the path of keys.
+func Pointer(keys ...string) string {
+	var b strings.Builder
+	for _, key := range keys {
+		b.WriteString("/" + Escape(key))
+	}
+	return b.String()
+}
+
+// Escape escapes key to be a token of a JSON pointer.
+func Escape(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+// keys lists the keys of the JSON object in b, in order.
+func keys(b []byte) ([]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	_, err := decoder.Token() // '{'
+	if err != nil {
+		return nil, err
+	}
+	var list []string
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		var value json.RawMessage
+		err = decoder.Decode(&value)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, token.(string))
+	}
+	return list, nil
+}
+
+// decode decodes the JSON value in b into v, numbers as json.Number for
+// checking them exactly.
+func decode(b []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// NewRouter constructs the router of the api over store, the way the
+// server mounts it.
+func NewRouter(store *db.Store) chi.Router {
+	r := chi.NewRouter()
+	r.NotFound(api.NotFound)
+	r.MethodNotAllowed(api.MethodNotAllowed)
+	r.Mount("/auth", api.AuthResource{DB: store}.Router())
+	r.Mount("/users", api.UserResource{DB: store}.Router())
+	r.Mount("/scounts", api.ScountResource{DB: store}.Router())
+	r.Mount("/invites", api.AcceptResource{DB: store}.Router())
+	return r
+}
+
+// Client makes requests to the router of the api in process, signed in
+// by the bearer token (if any).
+type Client struct {
+	t      *testing.T
+	router http.Handler
+	token  string
+}
+
+// Do makes the request, body encoded as JSON unless nil.
+func (c Client) Do(method, target string, body any) *httptest.ResponseRecorder {
+	c.t.Helper()
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		reader = bytes.NewReader(b)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	res := httptest.NewRecorder()
+	c.router.ServeHTTP(res, req)
+	return res
+}
+
+// Create makes the request, expecting 200 OK with the id at key.
+func (c Client) Create(method, target string, body any, key string) string {
+	c.t.Helper()
+	res := c.Do(method, target, body)
+	var created map[string]any
+	_ = json.Unmarshal(res.Body.Bytes(), &created)
+	id, _ := created[key].(string)
+	if res.Code != http.StatusOK || id == "" {
+		c.t.Fatalf("%s %s: %d %s", method, target, res.Code, res.Body)
+	}
+	return id
+}
+
+// Fixture sets up the records to replay the documented operations
+// against: a scount of alice with bob as a member, an expense, a
+// settlement and an invite. It gives alice's client along with the ids
+// of the records, by path parameter.
+func Fixture(t *testing.T, router http.Handler) (Client, map[string]string) {
+	t.Helper()
+	anon := Client{t: t, router: router}
+	alice := anon.Create(http.MethodPost, "/auth/register", map[string]any{
+		"email":    "alice@example.com",
+		"username": "alice",
+		"password": "alicepassword",
+	}, "user_id")
+	bob := anon.Create(http.MethodPost, "/auth/register", map[string]any{
+		"email":    "bob@example.com",
+		"username": "bob",
+		"password": "bobpassword",
+	}, "user_id")
+	token := anon.Create(http.MethodPost, "/auth/login", map[string]any{
+		"email":    "alice@example.com",
+		"password": "alicepassword",
+	}, "token")
+	client := Client{t: t, router: router, token: token}
+	sid := client.Create(http.MethodPost, "/scounts", map[string]any{
+		"title": "City Trip",
+	}, "scount_id")
+	client.Create(http.MethodPost, "/scounts/"+sid+"/members", map[string]any{
+		"uid": bob,
+	}, "member_id")
+	eid := client.Create(http.MethodPost, "/scounts/"+sid+"/expenses", map[string]any{
+		"title":  "Dinner",
+		"amount": map[string]any{"value": "30.00", "currency": "EUR"},
+	}, "expense_id")
+	stid := client.Create(http.MethodPost, "/scounts/"+sid+"/settlements", map[string]any{
+		"payer":  bob,
+		"payee":  alice,
+		"amount": map[string]any{"value": "15.00", "currency": "EUR"},
+	}, "settlement_id")
+	iid := client.Create(http.MethodPost, "/scounts/"+sid+"/invites", map[string]any{}, "invite_id")
+	res := client.Do(http.MethodGet, "/scounts/"+sid+"/invites/"+iid, nil)
+	var invite struct{ Token string }
+	_ = json.Unmarshal(res.Body.Bytes(), &invite)
+	if invite.Token == "" {
+		t.Fatalf("no token of invite: %d %s", res.Code, res.Body)
+	}
+	return client, map[string]string{
+		"uid":   bob,
+		"sid":   sid,
+		"eid":   eid,
+		"stid":  stid,
+		"iid":   iid,
+		"token": invite.Token,
+	}
+}
+
+// Target gives the request target of op, path parameters filled in from
+// params.
+func Target(t *testing.T, op Operation, params map[string]string) string {
+	t.Helper()
+	target := op.Path
+	for name, value := range params {
+		target = strings.ReplaceAll(target, "{"+name+"}", url.PathEscape(value))
+	}
+	if strings.Contains(target, "{") {
+		t.Fatalf("%s: path parameter not in fixture", op)
+	}
+	return target
+}
+
+// Query gives the query of the example of the query parameter, nil if
+// none. Arrays are serialized in the form style, exploded unless said
+// otherwise.
+func Query(param map[string]any) url.Values {
+	name, _ := param["name"].(string)
+	example, ok := param["example"]
+	if !ok || example == "" {
+		return nil
+	}
+	list, ok := example.([]any)
+	if !ok {
+		return url.Values{name: {fmt.Sprint(example)}}
+	}
+	values := make([]string, 0, len(list))
+	for _, value := range list {
+		values = append(values, fmt.Sprint(value))
+	}
+	if param["explode"] == false {
+		values = []string{strings.Join(values, ",")}
+	}
+	return url.Values{name: values}
+}
+
+// Normalize gives the route pattern of chi as documented, without the
+// trailing slash of the subrouters.
+func Normalize(route string) string {
+	if route != "/" {
+		route = strings.TrimSuffix(route, "/")
+	}
+	return route
+}
+
+// TestRoutes checks that the routes of the api are exactly the
+// operations documented.
+func TestRoutes(t *testing.T) {
+	spec := LoadSpec(t)
+	documented := make(map[string]bool)
+	for _, op := range spec.Operations() {
+		documented[op.String()] = true
+	}
+	routed := make(map[string]bool)
+	router := NewRouter(memory.NewStore(memory.NewDatabase()))
+	err := chi.Walk(router, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		routed[method+" "+Normalize(route)] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for route := range routed {
+		if !documented[route] {
+			t.Errorf("%s: route not documented", route)
+		}
+	}
+	for op := range documented {
+		if !routed[op] {
+			t.Errorf("%s: documented but not routed", op)
+		}
+	}
+}
+
+// parser is the parser of the query parameters of an operation.
+type parser = func(url.Values) (any, error)
+
+// parse adapts a query parser of the api as parser.
+func parse[T any](f func(url.Values) (T, error)) parser {
+	return func(query url.Values) (any, error) {
+		return f(query)
+	}
+}
+
+// parsers are the parsers of the query parameters, by operation id.
+var parsers = map[string]parser{
+	"ListUsers":        parse(api.ParseUserQuery),
+	"ListScounts":      parse(api.ParseScountQuery),
+	"ListScountTrash":  parse(api.ParseScountQuery),
+	"GetBalances":      parse(api.ParseCurrencyQuery),
+	"GetSettlePlan":    parse(api.ParseCurrencyQuery),
+	"ListMembers":      parse(api.ParseMemberQuery),
+	"ListExpenses":     parse(api.ParseExpenseQuery),
+	"ListExpenseTrash": parse(api.ParseExpenseQuery),
+	"ListSettlements":  parse(api.ParseSettlementQuery),
+	"ListInvites":      parse(api.ParseInviteQuery),
+	"ListActivity":     parse(api.ParseActivityQuery),
+}
+
+// TestQueryParams checks that the documented query parameters are all
+// implemented, that is each of them is either rejected or changes the
+// query parsed.
+func TestQueryParams(t *testing.T) {
+	spec := LoadSpec(t)
+	for _, op := range spec.Operations() {
+		params := spec.Parameters(op, "query")
+		if len(params) == 0 {
+			continue
+		}
+		parse, ok := parsers[op.Id]
+		if !ok {
+			t.Errorf("%s: no parser of query parameters", op)
+			continue
+		}
+		zero, err := parse(nil)
+		if err != nil {
+			t.Fatalf("%s: %v", op, err)
+		}
+		for _, param := range params {
+			name, _ := param["name"].(string)
+			query, err := parse(url.Values{name: {"1"}})
+			if err == nil && reflect.DeepEqual(query, zero) {
+				t.Errorf("%s: query parameter %q not implemented", op, name)
+			}
+		}
+	}
+}
+
+// TestExamples replays the documented operations against the router of
+// the api, with every request body and query parameter example given,
+// and checks each response against the documented responses. Deletions
+// are replayed last, nested resources first.
+func TestExamples(t *testing.T) {
+	spec := LoadSpec(t)
+	err := api.LoadSchemas(os.DirFS("../schema"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := NewRouter(memory.NewStore(memory.NewDatabase()))
+	client, params := Fixture(t, router)
+	ops := spec.Operations()
+	var deletions []Operation
+	ops = slices.DeleteFunc(ops, func(op Operation) bool {
+		if op.Method == http.MethodDelete {
+			deletions = append(deletions, op)
+			return true
+		}
+		return false
+	})
+	slices.Reverse(deletions)
+	for _, op := range append(ops, deletions...) {
+		t.Run(op.Id, func(t *testing.T) {
+			target := Target(t, op, params)
+			replay := func(name string, target string, body any) {
+				t.Helper()
+				res := client.Do(op.Method, target, body)
+				err := spec.Check(op, res)
+				if err != nil {
+					t.Errorf("%s (%s): %v", op, name, err)
+				}
+			}
+			for _, param := range spec.Parameters(op, "query") {
+				query := Query(param)
+				if query == nil {
+					continue
+				}
+				name, _ := param["name"].(string)
+				replay(name, target+"?"+query.Encode(), nil)
+			}
+			examples := spec.Examples(op.Ptr + "/requestBody/content/application~1json")
+			for name, example := range examples {
+				replay(name, target, example)
+			}
+			if len(examples) == 0 {
+				replay("no example", target, nil)
+			}
+		})
+	}
+}
+
+// TestSchemas checks that the documented examples of request and response
+// bodies are valid against their schemas.
+func TestSchemas(t *testing.T) {
+	spec := LoadSpec(t)
+	for _, op := range spec.Operations() {
+		body := op.Ptr + "/requestBody/content/application~1json"
+		for name, example := range spec.Examples(body) {
+			schema, err := spec.Schema(body + "/schema")
+			if err != nil {
+				t.Fatalf("%s: %v", op, err)
+			}
+			err = schema.Validate(example)
+			if err != nil {
+				t.Errorf("%s: request body %s: %#v", op, name, err)
+			}
+		}
+		responses, _ := spec.Lookup(op.Ptr + "/responses").(map[string]any)
+		for status := range responses {
+			content, _ := spec.Lookup(op.Ptr + "/responses/" + status + "/content").(map[string]any)
+			for mediatype := range content {
+				ptr := op.Ptr + "/responses/" + status + "/content/" + Escape(mediatype)
+				schema, err := spec.Schema(ptr + "/schema")
+				if err != nil {
+					t.Fatalf("%s: %v", op, err)
+				}
+				examples := spec.Examples(ptr)
+				for name, example := range examples {
+					err = schema.Validate(example)
+					if err != nil {
+						t.Errorf("%s: %s response %s: %#v", op, status, name, err)
+					}
+				}
+			}
+		}
+	}
+}
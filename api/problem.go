@@ -0,0 +1,212 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/manojnakp/scount/db"
+)
+
+// Problem is a response body explaining why a request failed, in the
+// form of problem details (RFC 7807). Type tells the kind of problem,
+// Detail this very occurrence of it. schema is defined at `Problem.json`.
+type Problem struct {
+	Type          string         `json:"type,omitempty"`
+	Title         string         `json:"title"`
+	Status        int            `json:"status"`
+	Detail        string         `json:"detail,omitempty"`
+	InvalidParams []InvalidParam `json:"invalid-params,omitempty"`
+}
+
+// InvalidParam tells which field of the request is invalid and why.
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// Write writes p as the response to w, with the status of p.
+func (p Problem) Write(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// With gives a copy of p explained by detail.
+func (p Problem) With(detail string) Problem {
+	p.Detail = detail
+	return p
+}
+
+// NotFound is the http.HandlerFunc for requests matching no route.
+func NotFound(w http.ResponseWriter, _ *http.Request) {
+	ProblemNotFound.Write(w)
+}
+
+// MethodNotAllowed is the http.HandlerFunc for requests matching a route
+// but none of its methods.
+func MethodNotAllowed(w http.ResponseWriter, _ *http.Request) {
+	ProblemMethodNotAllowed.Write(w)
+}
+
+// problems of the api, by type. Handlers explain the occurrence (if
+// useful) using Problem.With.
+var (
+	ProblemMalformedBody = Problem{
+		Type:   "/problems/malformed-body",
+		Title:  "Malformed request body",
+		Status: http.StatusBadRequest,
+	}
+	ProblemInvalidQuery = Problem{
+		Type:   "/problems/invalid-query",
+		Title:  "Invalid query parameters",
+		Status: http.StatusBadRequest,
+	}
+	ProblemValidation = Problem{
+		Type:   "/problems/validation",
+		Title:  "Validation failed",
+		Status: http.StatusBadRequest,
+	}
+	ProblemInvalidData = Problem{
+		Type:   "/problems/invalid-data",
+		Title:  "Invalid data",
+		Status: http.StatusBadRequest,
+	}
+	ProblemInvalidColumn = Problem{
+		Type:   "/problems/invalid-column",
+		Title:  "Invalid sort column",
+		Status: http.StatusBadRequest,
+	}
+	ProblemNoRate = Problem{
+		Type:   "/problems/no-rate",
+		Title:  "Exchange rate unavailable",
+		Status: http.StatusBadRequest,
+	}
+	ProblemUnauthorized = Problem{
+		Type:   "/problems/unauthorized",
+		Title:  "Not authenticated",
+		Status: http.StatusUnauthorized,
+	}
+	ProblemForbidden = Problem{
+		Type:   "/problems/forbidden",
+		Title:  "Not allowed",
+		Status: http.StatusForbidden,
+	}
+	ProblemNotFound = Problem{
+		Type:   "/problems/not-found",
+		Title:  "Resource not found",
+		Status: http.StatusNotFound,
+	}
+	ProblemMethodNotAllowed = Problem{
+		Type:   "/problems/method-not-allowed",
+		Title:  "Method not allowed",
+		Status: http.StatusMethodNotAllowed,
+	}
+	ProblemConflict = Problem{
+		Type:   "/problems/conflict",
+		Title:  "Conflict with the current state",
+		Status: http.StatusConflict,
+	}
+	ProblemGone = Problem{
+		Type:   "/problems/gone",
+		Title:  "Resource no longer available",
+		Status: http.StatusGone,
+	}
+	ProblemUnsupportedMediaType = Problem{
+		Type:   "/problems/unsupported-media-type",
+		Title:  "Unsupported media type",
+		Status: http.StatusUnsupportedMediaType,
+		Detail: "The request body should be of type application/json.",
+	}
+	ProblemInvalidCredentials = Problem{
+		Type:   "/problems/invalid-credentials",
+		Title:  "Invalid credentials",
+		Status: http.StatusUnprocessableEntity,
+	}
+	ProblemInternal = Problem{
+		Type:   "/problems/internal",
+		Title:  "Internal server error",
+		Status: http.StatusInternalServerError,
+	}
+)
+
+// problems of refused user deletion.
+var (
+	ProblemOwnsScounts = Problem{
+		Type:   "/problems/owns-scounts",
+		Title:  "User owns scounts",
+		Status: http.StatusConflict,
+		Detail: "The account owns scounts, transfer their ownership to another member or delete them first.",
+	}
+	ProblemOpenBalance = Problem{
+		Type:   "/problems/open-balance",
+		Title:  "User has an open balance",
+		Status: http.StatusConflict,
+		Detail: "The account has a non-zero balance in some scount, settle up first.",
+	}
+)
+
+// problems of refused member removal.
+var (
+	ProblemOwnerRemoval = Problem{
+		Type:   "/problems/owner-removal",
+		Title:  "Member owns the scount",
+		Status: http.StatusConflict,
+		Detail: "The owner cannot leave the scount, transfer the ownership to another member first.",
+	}
+	ProblemMemberBalance = Problem{
+		Type:   "/problems/member-balance",
+		Title:  "Member has an open balance",
+		Status: http.StatusConflict,
+		Detail: "The member has a non-zero balance in the scount, settle up first.",
+	}
+)
+
+// ProblemOf gives the problem for err, as returned by the datastore or
+// by Validate. Details of db errors are left out as they may expose the
+// internals of the datastore, unknown errors are internal problems.
+func ProblemOf(err error) Problem {
+	var invalid ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		p := ProblemValidation
+		p.InvalidParams = invalid
+		return p
+	case errors.Is(err, db.ErrInvalidData), errors.Is(err, db.ErrSyntaxPrivilege):
+		return ProblemInvalidData
+	case errors.Is(err, db.ErrInvalidColumn):
+		return ProblemInvalidColumn
+	case errors.Is(err, db.ErrNoRows):
+		return ProblemNotFound
+	case errors.Is(err, db.ErrConflict):
+		return ProblemConflict
+	}
+	return ProblemInternal
+}
+
+// ValidationError is the error of Validate, listing the invalid fields
+// of the request.
+type ValidationError []InvalidParam
+
+// Error implements error on ValidationError.
+func (e ValidationError) Error() string {
+	reasons := make([]string, 0, len(e))
+	for _, p := range e {
+		reasons = append(reasons, p.Name+" "+p.Reason)
+	}
+	return "api: validation failed: " + strings.Join(reasons, "; ")
+}
+
+// Add adds the field name to e as invalid for reason.
+func (e *ValidationError) Add(name, reason string) {
+	*e = append(*e, InvalidParam{Name: name, Reason: reason})
+}
+
+// Err gives e as an error, nil if no field is invalid.
+func (e ValidationError) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
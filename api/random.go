@@ -1,7 +1,9 @@
 package api
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base32"
 	"io"
 	"log"
@@ -49,6 +51,41 @@ func GenerateToken(subject string) ([]byte, error) {
 	return payload, nil
 }
 
+// GenerateInviteToken constructs JWT for invite iid expiring at expires
+// and signs it with the invite key, so that invite tokens and auth tokens
+// are never mistaken for each other. Token is deterministic for an invite.
+func GenerateInviteToken(iid string, expires time.Time) ([]byte, error) {
+	token := jwt.New()
+	_ = token.Set(jwt.JwtIDKey, iid)
+	_ = token.Set(jwt.ExpirationKey, expires)
+	payload, err := jwt.Sign(token, jwt.WithKey(jwa.HS256, inviteKey()))
+	if err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// ParseInviteToken verifies invite token and gives the invite id in it.
+// Expired tokens fail validation with jwt.ErrTokenExpired.
+func ParseInviteToken(token string) (string, error) {
+	t, err := jwt.ParseString(
+		token,
+		jwt.WithValidate(true),
+		jwt.WithKey(jwa.HS256, inviteKey()),
+	)
+	if err != nil {
+		return "", err
+	}
+	return t.JwtID(), nil
+}
+
+// inviteKey derives the key used for invite tokens from secret key.
+func inviteKey() []byte {
+	mac := hmac.New(sha256.New, GetKey())
+	mac.Write([]byte("invite"))
+	return mac.Sum(nil)
+}
+
 // secret is private key used for signing JWT.
 var secret []byte
 
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// SchemaURL is the base URL of the JSON schemas, against which their
+// references (like `Amount.json`) are resolved.
+const SchemaURL = "scount:///schema/"
+
+// schemas are the compiled JSON schemas by file name, like
+// `ScountRequest.json`. nil until LoadSchemas.
+var schemas map[string]*jsonschema.Schema
+
+// muSchemas is the mutex guarding access to schemas.
+var muSchemas sync.Mutex
+
+// LoadSchemas compiles the JSON schemas (`*.json`) at the root of fsys
+// for Schemaware, asserting formats like `email`.
+func LoadSchemas(fsys fs.FS) error {
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft2020
+	compiler.AssertFormat = true
+	compiler.LoadURL = func(url string) (io.ReadCloser, error) {
+		name, ok := strings.CutPrefix(url, SchemaURL)
+		if !ok {
+			return nil, fmt.Errorf("api: schema %q outside %s", url, SchemaURL)
+		}
+		return fsys.Open(name)
+	}
+	names, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return err
+	}
+	compiled := make(map[string]*jsonschema.Schema, len(names))
+	for _, name := range names {
+		compiled[name], err = compiler.Compile(SchemaURL + name)
+		if err != nil {
+			return err
+		}
+	}
+	muSchemas.Lock()
+	defer muSchemas.Unlock()
+	schemas = compiled
+	return nil
+}
+
+// GetSchema obtains the compiled JSON schema by file name, nil if not
+// found. ok is false if schemas are not loaded at all.
+func GetSchema(name string) (schema *jsonschema.Schema, ok bool) {
+	muSchemas.Lock()
+	defer muSchemas.Unlock()
+	return schemas[name], schemas != nil
+}
+
+// Schemaware is the middleware for validation of the JSON request body
+// against the schema by file name, like `ScountRequest.json`. It runs
+// before BodyParser, which still rejects bodies not of JSON media type.
+// Violations are listed as invalid params of ProblemValidation. Bodies
+// are let through as is if schemas are not loaded, see LoadSchemas.
+func Schemaware(name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mediatype, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || mediatype != "application/json" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			schema, ok := GetSchema(name)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if schema == nil {
+				log.Println("api: no schema", name)
+				ProblemInternal.Write(w)
+				return
+			}
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				log.Println(err)
+				ProblemMalformedBody.Write(w)
+				return
+			}
+			// numbers as is, for checking them exactly
+			var value any
+			decoder := json.NewDecoder(bytes.NewReader(body))
+			decoder.UseNumber()
+			err = decoder.Decode(&value)
+			if err != nil {
+				log.Println(err)
+				ProblemMalformedBody.With(err.Error()).Write(w)
+				return
+			}
+			err = schema.Validate(value)
+			var invalid *jsonschema.ValidationError
+			switch {
+			case errors.As(err, &invalid):
+				log.Println(err)
+				ProblemOf(violations(invalid)).Write(w)
+				return
+			case err != nil:
+				log.Println(err)
+				ProblemInternal.Write(w)
+				return
+			}
+			// body is read again by BodyParser
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// violations gives the leaf errors of schema validation as a list of
+// invalid fields, named by their dotted path within the body (`body` for
+// the body as a whole).
+func violations(err *jsonschema.ValidationError) ValidationError {
+	var invalid ValidationError
+	var walk func(*jsonschema.ValidationError)
+	walk = func(err *jsonschema.ValidationError) {
+		for _, cause := range err.Causes {
+			walk(cause)
+		}
+		if len(err.Causes) != 0 {
+			return
+		}
+		name := strings.ReplaceAll(strings.TrimPrefix(err.InstanceLocation, "/"), "/", ".")
+		if name == "" {
+			name = "body"
+		}
+		invalid.Add(name, err.Message)
+	}
+	walk(err)
+	return invalid
+}
@@ -4,30 +4,98 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"net/url"
 	"path"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/manojnakp/scount/api/internal"
 	"github.com/manojnakp/scount/db"
+	"github.com/manojnakp/scount/money"
+	"github.com/manojnakp/scount/settle"
 )
 
 // ScountSchema is the location for `Scount` JSON schema.
 const ScountSchema = "/schema/Scount.json"
 
-// Scount describes the scount resource.
+// Scount describes the scount resource. Deleted is the time the scount
+// was moved to the trash, if so.
 // schema is defined at `Scount.json`.
 type Scount struct {
-	Schema string `json:"$schema,omitempty"`
-	Id     string `json:"id"`
-	Title  string `json:"title"`
-	Desc   string `json:"description"`
-	Owner  string `json:"owner"`
+	Schema   string         `json:"$schema,omitempty"`
+	Id       string         `json:"id"`
+	Title    string         `json:"title"`
+	Desc     string         `json:"description"`
+	Owner    string         `json:"owner"`
+	Currency money.Currency `json:"currency"`
+	Deleted  *time.Time     `json:"deleted,omitempty"`
+}
+
+// NewScount constructs the scount resource from db.Scount.
+func NewScount(scount db.Scount) Scount {
+	return Scount{
+		Schema:   ScountSchema,
+		Id:       scount.Sid,
+		Title:    scount.Title,
+		Desc:     scount.Description,
+		Owner:    scount.Owner,
+		Currency: scount.Currency,
+		Deleted:  deletedAt(scount.Deleted),
+	}
+}
+
+// deletedAt gives the time t of moving to the trash, nil if zero.
+func deletedAt(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// BalanceSchema is the location for `Balance` JSON schema.
+const BalanceSchema = "/schema/Balance.json"
+
+// Balance describes the net position of a member within a scount,
+// in the currency of the scount unless requested otherwise.
+// schema is defined at `Balance.json`.
+type Balance struct {
+	Schema   string       `json:"$schema,omitempty"`
+	Member   string       `json:"member"`
+	Paid     money.Amount `json:"paid"`
+	Owed     money.Amount `json:"owed"`
+	Sent     money.Amount `json:"sent"`
+	Received money.Amount `json:"received"`
+	Net      money.Amount `json:"net"`
+}
+
+// TransferSchema is the location for `Transfer` JSON schema.
+const TransferSchema = "/schema/Transfer.json"
+
+// Transfer describes a payment to be made from one member to another
+// so as to settle up the scount.
+// schema is defined at `Transfer.json`.
+type Transfer struct {
+	Schema string       `json:"$schema,omitempty"`
+	From   string       `json:"from"`
+	To     string       `json:"to"`
+	Amount money.Amount `json:"amount"`
+}
+
+// ErrScountQuery defines parsing errors for ScountQuery.
+var ErrScountQuery = errors.New("invalid scount query parameters")
+
+// ScountSorter is the default sort order for scount queries.
+var ScountSorter = []db.Sorter{
+	{
+		Column: "sid",
+	},
 }
 
 // ScountQuery describes the url query parameters
-// used for filtering the scounts.
+// used for filtering the scounts. Uid defaults to the current user.
 // schema is defined at `ScountQuery.json`.
 type ScountQuery struct {
 	Sid    string
@@ -39,20 +107,47 @@ type ScountQuery struct {
 }
 
 // ParseScountQuery parses the query parameters on scount collection resource.
-func ParseScountQuery(url.Values) (*ScountQuery, error) {
-	return new(ScountQuery), nil
+func ParseScountQuery(query url.Values) (*ScountQuery, error) {
+	paging, err := ParsePaginator(query)
+	if err != nil {
+		return nil, err
+	}
+	list, err := internal.ParseSort(query.Get("sort"), internal.ScountSortMap)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid 'sort' parameter: %w", ErrScountQuery, err)
+	}
+	// fallback to default sorter
+	if len(list) == 0 {
+		list = ScountSorter
+	}
+	return &ScountQuery{
+		Sid:    query.Get("sid"),
+		Uid:    query.Get("uid"),
+		Owner:  query.Get("owner"),
+		Title:  query.Get("title"),
+		Sort:   list,
+		Paging: paging,
+	}, nil
 }
 
 // ScountRequest describes new scount creation request.
 // schema is defined at `ScountRequest.json`
 type ScountRequest struct {
-	Title string `json:"title"`
-	Desc  string `json:"description"`
+	Title    string         `json:"title"`
+	Desc     string         `json:"description"`
+	Currency money.Currency `json:"currency,omitempty"`
 }
 
 // Validate implements Validator on ScountRequest.
-func (ScountRequest) Validate() error {
-	return nil
+func (s ScountRequest) Validate() error {
+	var invalid ValidationError
+	if s.Title == "" {
+		invalid.Add("title", "must not be empty")
+	}
+	if s.Currency != "" && !s.Currency.Valid() {
+		invalid.Add("currency", "must be an ISO 4217 code")
+	}
+	return invalid.Err()
 }
 
 // ScountResponse points to the newly created scount resource.
@@ -75,8 +170,10 @@ func (ScountUpdater) Validate() error {
 }
 
 // ScountResource is the http.Handler for all requests to `/scounts`.
+// Rates converts amounts between currencies, money.DefaultRates if nil.
 type ScountResource struct {
-	DB *db.Store
+	DB    *db.Store
+	Rates money.ExchangeRates
 }
 
 // ScountPathWare is the middleware to set context key corresponding
@@ -95,14 +192,31 @@ func (res ScountResource) Router() chi.Router {
 	r.Use(Authware)
 	r.With(QueryParser(ParseScountQuery)).
 		Get("/", res.ListScounts)
-	r.With(BodyParser[ScountRequest], Validware[ScountRequest]).
+	r.With(Schemaware("ScountRequest.json"), BodyParser[ScountRequest], Validware[ScountRequest]).
 		Post("/", res.CreateScount)
+	r.With(QueryParser(ParseScountQuery)).
+		Get("/trash", res.ListTrash)
 	r.Route("/{sid}", func(r chi.Router) {
 		r.Use(ScountPathWare)
-		r.Get("/", res.GetScount)
-		r.With(BodyParser[ScountUpdater], Validware[ScountUpdater]).
-			Patch("/", res.UpdateScount)
-		r.Delete("/", res.DeleteScount)
+		// scounts in the trash are not found by Authorize
+		r.Post("/restore", res.RestoreScount)
+		r.Group(func(r chi.Router) {
+			r.Use(Authorize(res.DB))
+			r.Get("/", res.GetScount)
+			r.With(Require(PermRenameScount), Schemaware("ScountUpdater.json"), BodyParser[ScountUpdater], Validware[ScountUpdater]).
+				Patch("/", res.UpdateScount)
+			r.With(OwnerOnly).
+				Delete("/", res.DeleteScount)
+			r.With(QueryParser(ParseCurrencyQuery)).
+				Get("/balances", res.GetBalances)
+			r.With(QueryParser(ParseCurrencyQuery)).
+				Get("/settle-plan", res.GetSettlePlan)
+			r.Mount("/members", MemberResource{DB: res.DB}.Router())
+			r.Mount("/expenses", ExpenseResource{DB: res.DB, Rates: res.Rates}.Router())
+			r.Mount("/settlements", SettlementResource{DB: res.DB, Rates: res.Rates}.Router())
+			r.Mount("/invites", InviteResource{DB: res.DB}.Router())
+			r.Mount("/activity", ActivityResource{DB: res.DB}.Router())
+		})
 	})
 	return r
 }
@@ -113,45 +227,88 @@ func (res ScountResource) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	mux.ServeHTTP(w, r)
 }
 
-// ListScounts handles GET requests at `/scounts`.
+// ListScounts handles GET requests at `/scounts`. Only the scounts the
+// current user is a member of are listed, `uid` narrowing them down to
+// the ones shared with another user.
 func (res ScountResource) ListScounts(w http.ResponseWriter, r *http.Request) {
 	var (
 		ctx   = r.Context()
+		uid   = ctx.Value(AuthUserKey).(string)
 		query = ctx.Value(QueryKey).(*ScountQuery)
-		page  = query.Paging.Page
-		size  = query.Paging.Size
 	)
-	// database call
-	scounts, err := res.DB.Scounts.Find(
-		ctx,
-		&db.ScountFilter{Sid: query.Sid, Uid: query.Uid, Owner: query.Owner, Title: query.Title},
-		&db.Projector{Order: query.Sort, Paging: &db.Paging{Limit: size, Offset: page * size}},
+	// scounts of the current user by default
+	member := query.Uid
+	if member == "" {
+		member = uid
+	}
+	// only scounts visible to the current user
+	res.list(w, r, "/scounts", &db.ScountFilter{
+		Sid:    query.Sid,
+		Uid:    member,
+		Owner:  query.Owner,
+		Title:  query.Title,
+		Member: uid,
+	})
+}
+
+// ListTrash handles GET requests at `/scounts/trash`. Only the scounts
+// in the trash owned by the current user are listed, the `owner`
+// parameter is ignored.
+func (res ScountResource) ListTrash(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx   = r.Context()
+		uid   = ctx.Value(AuthUserKey).(string)
+		query = ctx.Value(QueryKey).(*ScountQuery)
+	)
+	res.list(w, r, "/scounts/trash", &db.ScountFilter{
+		Sid:   query.Sid,
+		Uid:   query.Uid,
+		Owner: uid,
+		Title: query.Title,
+		Trash: true,
+	})
+}
+
+// list responds with the page of scounts matching filter, as per the
+// ScountQuery in context, at location.
+func (res ScountResource) list(
+	w http.ResponseWriter,
+	r *http.Request,
+	location string,
+	filter *db.ScountFilter,
+) {
+	var (
+		ctx   = r.Context()
+		query = ctx.Value(QueryKey).(*ScountQuery)
 	)
+	projector, err := query.Paging.Projector(query.Sort, db.ScountKeyCols)
 	if err != nil {
+		ProblemInvalidQuery.With(err.Error()).Write(w)
+		return
+	}
+	// database call
+	scounts, err := res.DB.Scounts.Find(ctx, filter, projector)
+	switch {
+	case errors.Is(err, db.ErrInvalidColumn):
+		ProblemInvalidColumn.Write(w)
+		return
+	case err != nil:
 		log.Println(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		ProblemInternal.Write(w)
 		return
 	}
-	// build response collection
-	list := make([]Scount, 0)
-	scounts.Iterator(func(scount db.Scount) bool {
-		list = append(list, Scount{
-			Schema: ScountSchema,
-			Id:     scount.Sid,
-			Title:  scount.Title,
-			Desc:   scount.Description,
-			Owner:  scount.Owner,
-		})
-		return true
-	})
-	err = scounts.Err()
+	page, err := PageOf(location, r.URL.Query(), query.Paging, projector, scounts)
 	if err != nil {
 		log.Println(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		ProblemInternal.Write(w)
 		return
 	}
-	links := PagingLinks("/scounts", r.URL.Query(), scounts.Total())
-	LinkHeader(w, links)
+	// build response collection
+	list := make([]Scount, 0, len(page.Items))
+	for _, scount := range page.Items {
+		list = append(list, NewScount(scount))
+	}
+	page.Header(w)
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(list)
 }
@@ -164,24 +321,33 @@ func (res ScountResource) CreateScount(w http.ResponseWriter, r *http.Request) {
 		owner = ctx.Value(AuthUserKey).(string)
 		sid   = GenerateID()
 	)
-	// insert into db
-	err := res.DB.Scounts.Insert(
-		ctx,
-		db.Scount{Sid: sid, Owner: owner, Title: body.Title, Description: body.Desc},
-	)
-	if err != nil {
-		log.Println(err)
+	// currency defaults to DefaultCurrency
+	currency := body.Currency
+	if currency == "" {
+		currency = DefaultCurrency
 	}
+	// insert into db
+	id := &db.ScountId{Sid: sid}
+	err := Track(ctx, res.DB, sid, db.ActivityScountCreated, sid, viewScount(ctx, id), func(tx *db.Store) error {
+		return tx.Scounts.Insert(ctx, db.Scount{
+			Sid:         sid,
+			Owner:       owner,
+			Title:       body.Title,
+			Description: body.Desc,
+			Currency:    currency,
+		})
+	})
 	// match error
 	switch {
 	case errors.Is(err, db.ErrInvalidData), errors.Is(err, db.ErrSyntaxPrivilege):
-		w.WriteHeader(http.StatusBadRequest)
+		ProblemInvalidData.Write(w)
 		return
 	case errors.Is(err, db.ErrConflict):
-		w.WriteHeader(http.StatusConflict)
+		ProblemConflict.Write(w)
 		return
 	case err != nil:
-		w.WriteHeader(http.StatusInternalServerError)
+		log.Println(err)
+		ProblemInternal.Write(w)
 		return
 	}
 	// newly created scount resource location
@@ -197,35 +363,22 @@ func (res ScountResource) CreateScount(w http.ResponseWriter, r *http.Request) {
 
 // GetScount handles GET requests at `/scounts/{sid}`.
 func (res ScountResource) GetScount(w http.ResponseWriter, r *http.Request) {
-	var (
-		ctx = r.Context()
-		sid = ctx.Value(ScountKey).(string)
-	)
-	scount, err := res.DB.Scounts.FindOne(ctx, &db.ScountId{Sid: sid})
-	switch {
-	case errors.Is(err, db.ErrNoRows): // sid not exist
-		w.WriteHeader(http.StatusNotFound)
-		return
-	case err != nil: // failed to query the db
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+	// scount already loaded by Authorize
+	scount := r.Context().Value(AccessKey).(Access).Scount
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK) // ALL OK
-	_ = json.NewEncoder(w).Encode(Scount{
-		Schema: ScountSchema,
-		Id:     scount.Sid,
-		Title:  scount.Title,
-		Desc:   scount.Description,
-		Owner:  scount.Owner,
-	})
+	_ = json.NewEncoder(w).Encode(NewScount(scount))
 }
 
 // UpdateScount handles PATCH request at `/scounts/{sid}`.
+// Renaming requires PermRenameScount, while changing the owner is left to
+// the owner, who is then demoted to an admin.
 func (res ScountResource) UpdateScount(w http.ResponseWriter, r *http.Request) {
 	var (
 		ctx     = r.Context()
 		sid     = ctx.Value(ScountKey).(string)
 		updater = ctx.Value(BodyKey).(ScountUpdater)
+		access  = ctx.Value(AccessKey).(Access)
 	)
 	var zero ScountUpdater
 	// nothing to update: success
@@ -233,43 +386,241 @@ func (res ScountResource) UpdateScount(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
+	// only the owner transfers the ownership
+	if updater.Owner != "" && !access.IsOwner() {
+		ProblemForbidden.With("Only the owner of the scount transfers the ownership.").Write(w)
+		return
+	}
 	// database call
-	err := res.DB.Scounts.UpdateOne(
-		ctx,
-		&db.ScountId{Sid: sid},
-		&db.ScountUpdater{Owner: updater.Owner, Title: updater.Title},
-	)
+	id := &db.ScountId{Sid: sid}
+	err := Track(ctx, res.DB, sid, db.ActivityScountUpdated, sid, viewScount(ctx, id), func(tx *db.Store) error {
+		return tx.Scounts.UpdateOne(ctx, id, &db.ScountUpdater{Owner: updater.Owner, Title: updater.Title})
+	})
 	switch {
 	case errors.Is(err, db.ErrNoRows):
-		w.WriteHeader(http.StatusNotFound)
+		ProblemNotFound.Write(w)
 		return
-	case errors.Is(err, db.ErrConflict): // conflict
-		w.WriteHeader(http.StatusConflict)
+	case errors.Is(err, db.ErrConflict): // new owner not a member
+		ProblemConflict.With("The new owner is not a member of the scount.").Write(w)
 		return
 	case err != nil: // unknown error
-		w.WriteHeader(http.StatusInternalServerError)
+		log.Println(err)
+		ProblemInternal.Write(w)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent) // ALL OK
 }
 
-// DeleteScount handles DELETE request at `/scounts/{sid}`.
+// DeleteScount handles DELETE request at `/scounts/{sid}`. The scount
+// is moved to the trash, to be restored by the owner or purged along with
+// its members, expenses, settlements and invites after the retention
+// period.
 func (res ScountResource) DeleteScount(w http.ResponseWriter, r *http.Request) {
 	var (
 		ctx = r.Context()
 		sid = ctx.Value(ScountKey).(string)
 	)
-	err := res.DB.Scounts.DeleteOne(ctx, &db.ScountId{Sid: sid})
+	id := &db.ScountId{Sid: sid}
+	err := Track(ctx, res.DB, sid, db.ActivityScountDeleted, sid, viewScount(ctx, id), func(tx *db.Store) error {
+		return tx.Scounts.DeleteOne(ctx, id)
+	})
 	switch {
 	case errors.Is(err, db.ErrNoRows):
-		w.WriteHeader(http.StatusNotFound)
+		ProblemNotFound.Write(w)
 		return
 	case errors.Is(err, db.ErrConflict):
-		w.WriteHeader(http.StatusConflict)
+		ProblemConflict.Write(w)
 		return
 	case err != nil:
-		w.WriteHeader(http.StatusInternalServerError)
+		log.Println(err)
+		ProblemInternal.Write(w)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// RestoreScount handles POST request at `/scounts/{sid}/restore`. Only
+// the owner restores a scount from the trash, others get 404 Not Found.
+func (res ScountResource) RestoreScount(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx = r.Context()
+		sid = ctx.Value(ScountKey).(string)
+		uid = ctx.Value(AuthUserKey).(string)
+	)
+	// scount in the trash owned by the current user
+	scounts, err := res.DB.Scounts.Find(ctx, &db.ScountFilter{Sid: sid, Owner: uid, Trash: true}, nil)
+	if err != nil {
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	found := false
+	scounts.Iterator(func(db.Scount) bool {
+		found = true
+		return false
+	})
+	switch err = scounts.Err(); {
+	case err != nil:
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	case !found:
+		ProblemNotFound.Write(w)
+		return
+	}
+	id := &db.ScountId{Sid: sid}
+	err = Track(ctx, res.DB, sid, db.ActivityScountRestored, sid, viewScount(ctx, id), func(tx *db.Store) error {
+		return tx.Scounts.Restore(ctx, id)
+	})
+	switch {
+	case errors.Is(err, db.ErrNoRows): // restored or purged meanwhile
+		ProblemNotFound.Write(w)
+		return
+	case err != nil:
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetBalances handles GET requests at `/scounts/{sid}/balances`.
+// Balances are converted into the requested currency (if any) at the
+// current rates.
+func (res ScountResource) GetBalances(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx   = r.Context()
+		sid   = ctx.Value(ScountKey).(string)
+		query = ctx.Value(QueryKey).(*CurrencyQuery)
+	)
+	balances, err := res.DB.Scounts.Balances(ctx, sid)
+	switch {
+	case errors.Is(err, db.ErrNoRows): // sid not exist
+		ProblemNotFound.Write(w)
+		return
+	case err != nil: // failed to query the db
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	list := make([]Balance, 0, len(balances))
+	for _, b := range balances {
+		b, err = res.viewBalance(ctx, b, query.Currency)
+		if err != nil {
+			break
+		}
+		list = append(list, Balance{
+			Schema:   BalanceSchema,
+			Member:   b.Uid,
+			Paid:     b.Paid,
+			Owed:     b.Owed,
+			Sent:     b.Sent,
+			Received: b.Received,
+			Net:      b.Net(),
+		})
+	}
+	switch {
+	case errors.Is(err, money.ErrRate): // no rate for currency
+		ProblemNoRate.With(err.Error()).Write(w)
+		return
+	case err != nil: // failed to convert
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // ALL OK
+	_ = json.NewEncoder(w).Encode(list)
+}
+
+// GetSettlePlan handles GET requests at `/scounts/{sid}/settle-plan`.
+// Transfers are planned in the currency of the scount and converted into
+// the requested currency (if any) at the current rates.
+func (res ScountResource) GetSettlePlan(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx   = r.Context()
+		sid   = ctx.Value(ScountKey).(string)
+		query = ctx.Value(QueryKey).(*CurrencyQuery)
+	)
+	balances, err := res.DB.Scounts.Balances(ctx, sid)
+	switch {
+	case errors.Is(err, db.ErrNoRows): // sid not exist
+		ProblemNotFound.Write(w)
+		return
+	case err != nil: // failed to query the db
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	positions := make([]settle.Balance, 0, len(balances))
+	for _, b := range balances {
+		net := b.Net()
+		positions = append(positions, settle.Balance{
+			Member:   b.Uid,
+			Currency: string(net.Currency),
+			Amount:   net.Minor,
+		})
+	}
+	transfers, err := settle.Plan(positions)
+	if err != nil { // balances must always reconcile
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	list := make([]Transfer, 0, len(transfers))
+	for _, t := range transfers {
+		var amount money.Amount
+		amount, err = res.view(ctx, money.New(t.Amount, money.Currency(t.Currency)), query.Currency)
+		if err != nil {
+			break
+		}
+		list = append(list, Transfer{
+			Schema: TransferSchema,
+			From:   t.From,
+			To:     t.To,
+			Amount: amount,
+		})
+	}
+	switch {
+	case errors.Is(err, money.ErrRate): // no rate for currency
+		ProblemNoRate.With(err.Error()).Write(w)
+		return
+	case err != nil: // failed to convert
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // ALL OK
+	_ = json.NewEncoder(w).Encode(list)
+}
+
+// view converts amount into currency (if any) for viewing only, at the
+// current rates.
+func (res ScountResource) view(
+	ctx context.Context,
+	amount money.Amount,
+	currency money.Currency,
+) (money.Amount, error) {
+	if currency == "" || currency == amount.Currency {
+		return amount, nil
+	}
+	_, converted, err := convert(ctx, res.Rates, amount, currency)
+	return converted, err
+}
+
+// viewBalance converts every amount of b into currency (if any), see view.
+func (res ScountResource) viewBalance(
+	ctx context.Context,
+	b db.Balance,
+	currency money.Currency,
+) (db.Balance, error) {
+	var err error
+	for _, amount := range []*money.Amount{&b.Paid, &b.Owed, &b.Sent, &b.Received} {
+		*amount, err = res.view(ctx, *amount, currency)
+		if err != nil {
+			return b, err
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,371 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/manojnakp/scount/api/internal"
+	"github.com/manojnakp/scount/db"
+	"github.com/manojnakp/scount/money"
+)
+
+// SettlementSchema is the location for `Settlement` JSON schema.
+const SettlementSchema = "/schema/Settlement.json"
+
+// ErrSettlementQuery defines parsing errors for SettlementQuery.
+var ErrSettlementQuery = errors.New("invalid settlement query parameters")
+
+// SettlementSorter is the default sort order for settlement queries.
+var SettlementSorter = []db.Sorter{
+	{
+		Column: "stid",
+	},
+}
+
+// Settlement describes the settlement resource, that is a payment
+// recorded from one member to another. Converted is the amount in the
+// currency of the scount at the rate recorded along with the settlement.
+// schema is defined at `Settlement.json`.
+type Settlement struct {
+	Schema    string       `json:"$schema,omitempty"`
+	Id        string       `json:"id"`
+	Scount    string       `json:"scount"`
+	Payer     string       `json:"payer"`
+	Payee     string       `json:"payee"`
+	Amount    money.Amount `json:"amount"`
+	Rate      string       `json:"rate"`
+	Converted money.Amount `json:"converted"`
+}
+
+// NewSettlement constructs the settlement resource from db.Settlement.
+func NewSettlement(settlement db.Settlement) Settlement {
+	return Settlement{
+		Schema:    SettlementSchema,
+		Id:        settlement.Stid,
+		Scount:    settlement.Sid,
+		Payer:     settlement.Payer,
+		Payee:     settlement.Payee,
+		Amount:    settlement.Amount,
+		Rate:      settlement.Rate.Decimal(),
+		Converted: settlement.Base,
+	}
+}
+
+// SettlementQuery describes the url query parameters
+// used for filtering the settlements of a scount.
+// schema is defined at `SettlementQuery.json`.
+type SettlementQuery struct {
+	Id     string
+	Payer  string
+	Payee  string
+	Member string
+	Sort   []db.Sorter
+	Paging Paginator
+}
+
+// ParseSettlementQuery parses the query parameters on settlement collection resource.
+func ParseSettlementQuery(query url.Values) (*SettlementQuery, error) {
+	paging, err := ParsePaginator(query)
+	if err != nil {
+		return nil, err
+	}
+	list, err := internal.ParseSort(query.Get("sort"), internal.SettlementSortMap)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid 'sort' parameter: %w", ErrSettlementQuery, err)
+	}
+	// fallback to default sorter
+	if len(list) == 0 {
+		list = SettlementSorter
+	}
+	return &SettlementQuery{
+		Id:     query.Get("id"),
+		Payer:  query.Get("payer"),
+		Payee:  query.Get("payee"),
+		Member: query.Get("member"),
+		Sort:   list,
+		Paging: paging,
+	}, nil
+}
+
+// SettlementRequest describes new settlement creation request.
+// schema is defined at `SettlementRequest.json`
+type SettlementRequest struct {
+	Payer  string       `json:"payer,omitempty"`
+	Payee  string       `json:"payee"`
+	Amount money.Amount `json:"amount"`
+}
+
+// Validate implements Validator on SettlementRequest.
+func (s SettlementRequest) Validate() error {
+	var invalid ValidationError
+	if s.Payee == "" {
+		invalid.Add("payee", "must not be empty")
+	}
+	if s.Payee != "" && s.Payee == s.Payer {
+		invalid.Add("payee", "must not be the payer")
+	}
+	if s.Amount.Sign() <= 0 {
+		invalid.Add("amount", "must be positive")
+	}
+	return invalid.Err()
+}
+
+// SettlementResponse points to the newly created settlement resource.
+// schema is defined at `SettlementResponse.json`
+type SettlementResponse struct {
+	Schema       string `json:"$schema,omitempty"`
+	SettlementId string `json:"settlement_id"`
+}
+
+// SettlementResource is the http.Handler for all requests to
+// `/scounts/{sid}/settlements`. Rates converts amounts into the currency
+// of the scount, money.DefaultRates if nil.
+//
+// Pre-requisite: ScountKey, AuthUserKey and AccessKey should be present
+// in request context, hence it is supposed to be mounted under
+// ScountResource.
+type SettlementResource struct {
+	DB    *db.Store
+	Rates money.ExchangeRates
+}
+
+// SettlementPathWare is the middleware to set context key corresponding
+// to "stid" path parameter using SettlementKey.
+func SettlementPathWare(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stid := chi.URLParam(r, "stid")
+		ctx := context.WithValue(r.Context(), SettlementKey, stid)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Router constructs a new chi.Router for the SettlementResource.
+func (res SettlementResource) Router() chi.Router {
+	r := chi.NewRouter()
+	r.With(QueryParser(ParseSettlementQuery)).
+		Get("/", res.ListSettlements)
+	r.With(Require(PermAddExpense), Schemaware("SettlementRequest.json"), BodyParser[SettlementRequest], Validware[SettlementRequest]).
+		Post("/", res.CreateSettlement)
+	r.Route("/{stid}", func(r chi.Router) {
+		r.Use(SettlementPathWare)
+		r.Get("/", res.GetSettlement)
+		r.With(res.editable).
+			Delete("/", res.DeleteSettlement)
+	})
+	return r
+}
+
+// ServeHTTP implements http.Handler on SettlementResource.
+func (res SettlementResource) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	mux := res.Router()
+	mux.ServeHTTP(w, r)
+}
+
+// ListSettlements handles GET requests at `/scounts/{sid}/settlements`.
+func (res SettlementResource) ListSettlements(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx   = r.Context()
+		sid   = ctx.Value(ScountKey).(string)
+		query = ctx.Value(QueryKey).(*SettlementQuery)
+	)
+	projector, err := query.Paging.Projector(query.Sort, db.SettlementKeyCols)
+	if err != nil {
+		ProblemInvalidQuery.With(err.Error()).Write(w)
+		return
+	}
+	// database call
+	settlements, err := res.DB.Settlements.Find(
+		ctx,
+		&db.SettlementFilter{
+			Sid:    sid,
+			Stid:   query.Id,
+			Payer:  query.Payer,
+			Payee:  query.Payee,
+			Member: query.Member,
+		},
+		projector,
+	)
+	switch {
+	case errors.Is(err, db.ErrInvalidColumn):
+		ProblemInvalidColumn.Write(w)
+		return
+	case err != nil:
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	page, err := PageOf(path.Join("/scounts", sid, "settlements"), r.URL.Query(), query.Paging, projector, settlements)
+	if err != nil {
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	// build response collection
+	list := make([]Settlement, 0, len(page.Items))
+	for _, settlement := range page.Items {
+		list = append(list, NewSettlement(settlement))
+	}
+	page.Header(w)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(list)
+}
+
+// CreateSettlement handles POST request at `/scounts/{sid}/settlements`.
+func (res SettlementResource) CreateSettlement(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx  = r.Context()
+		sid  = ctx.Value(ScountKey).(string)
+		body = ctx.Value(BodyKey).(SettlementRequest)
+		stid = GenerateID()
+	)
+	// payer defaults to the current user
+	uid := ctx.Value(AuthUserKey).(string)
+	payer := body.Payer
+	if payer == "" {
+		payer = uid
+	}
+	// payments between others are left to members allowed to edit others' expenses
+	access := ctx.Value(AccessKey).(Access)
+	if uid != payer && uid != body.Payee && !access.Can(PermEditExpenses) {
+		ProblemForbidden.With("Only the payer, the payee or members allowed to edit others' expenses are allowed.").Write(w)
+		return
+	}
+	// paying oneself is meaningless
+	if payer == body.Payee {
+		ProblemOf(ValidationError{{Name: "payee", Reason: "must not be the payer"}}).Write(w)
+		return
+	}
+	// convert into currency of the scount
+	currency := access.Scount.Currency
+	rate, base, err := convert(ctx, res.Rates, body.Amount, currency)
+	switch {
+	case errors.Is(err, money.ErrRate):
+		ProblemNoRate.With(err.Error()).Write(w)
+		return
+	case err != nil:
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	// insert into db
+	id := &db.SettlementId{Sid: sid, Stid: stid}
+	err = Track(ctx, res.DB, sid, db.ActivitySettlementAdded, stid, viewSettlement(ctx, id), func(tx *db.Store) error {
+		return tx.Settlements.Insert(ctx, db.Settlement{
+			Stid:   stid,
+			Sid:    sid,
+			Payer:  payer,
+			Payee:  body.Payee,
+			Amount: body.Amount,
+			Rate:   rate,
+			Base:   base,
+		})
+	})
+	// match error
+	switch {
+	case errors.Is(err, db.ErrInvalidData), errors.Is(err, db.ErrSyntaxPrivilege):
+		ProblemInvalidData.Write(w)
+		return
+	case errors.Is(err, db.ErrConflict): // payer or payee not a member
+		ProblemConflict.With("The payer or the payee is not a member of the scount.").Write(w)
+		return
+	case err != nil:
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	// newly created settlement resource location
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", path.Join("/scounts", sid, "settlements", stid))
+	w.WriteHeader(http.StatusOK)
+	// json response
+	_ = json.NewEncoder(w).Encode(SettlementResponse{
+		Schema:       "/schema/SettlementResponse.json",
+		SettlementId: stid,
+	})
+}
+
+// GetSettlement handles GET requests at `/scounts/{sid}/settlements/{stid}`.
+func (res SettlementResource) GetSettlement(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx  = r.Context()
+		sid  = ctx.Value(ScountKey).(string)
+		stid = ctx.Value(SettlementKey).(string)
+	)
+	settlement, err := res.DB.Settlements.FindOne(ctx, &db.SettlementId{Sid: sid, Stid: stid})
+	switch {
+	case errors.Is(err, db.ErrNoRows): // stid not exist
+		ProblemNotFound.Write(w)
+		return
+	case err != nil: // failed to query the db
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // ALL OK
+	_ = json.NewEncoder(w).Encode(NewSettlement(settlement))
+}
+
+// DeleteSettlement handles DELETE request at `/scounts/{sid}/settlements/{stid}`.
+// Only the payer or the payee of the settlement can delete it, see
+// editable.
+func (res SettlementResource) DeleteSettlement(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx  = r.Context()
+		sid  = ctx.Value(ScountKey).(string)
+		stid = ctx.Value(SettlementKey).(string)
+		id   = &db.SettlementId{Sid: sid, Stid: stid}
+	)
+	err := Track(ctx, res.DB, sid, db.ActivitySettlementDeleted, stid, viewSettlement(ctx, id), func(tx *db.Store) error {
+		return tx.Settlements.DeleteOne(ctx, id)
+	})
+	switch {
+	case errors.Is(err, db.ErrNoRows):
+		ProblemNotFound.Write(w)
+		return
+	case err != nil:
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// editable is the middleware that lets through the payer and the payee
+// of the settlement only, whatever their role. Other members get 403
+// Forbidden.
+func (res SettlementResource) editable(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			ctx    = r.Context()
+			sid    = ctx.Value(ScountKey).(string)
+			stid   = ctx.Value(SettlementKey).(string)
+			access = ctx.Value(AccessKey).(Access)
+		)
+		settlement, err := res.DB.Settlements.FindOne(ctx, &db.SettlementId{Sid: sid, Stid: stid})
+		switch {
+		case errors.Is(err, db.ErrNoRows): // stid not exist
+			ProblemNotFound.Write(w)
+			return
+		case err != nil:
+			log.Println(err)
+			ProblemInternal.Write(w)
+			return
+		}
+		// neither payer nor payee
+		uid := access.Member.Uid
+		if uid != settlement.Payer && uid != settlement.Payee {
+			ProblemForbidden.With("Only the payer or the payee of the settlement are allowed.").Write(w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
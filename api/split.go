@@ -0,0 +1,140 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/manojnakp/scount/db"
+	"github.com/manojnakp/scount/money"
+)
+
+// ErrSplit defines validation errors for Split.
+var ErrSplit = errors.New("api: invalid split")
+
+// SplitReason gives the reason for err of Validate or Resolve, as the
+// reason of an invalid `split` field.
+func SplitReason(err error) string {
+	return strings.TrimPrefix(err.Error(), ErrSplit.Error()+": ")
+}
+
+// Split describes how an expense is shared among members of a scount.
+// schema is defined at `Split.json`.
+type Split struct {
+	Mode  db.SplitMode `json:"mode"`
+	Parts []SplitPart  `json:"parts"`
+}
+
+// SplitPart is the portion of a Split for a single member. Weight is
+// the percentage in `percent` mode or the number of shares in `shares`
+// mode. Amount is the exact amount in `exact` mode. In responses, Amount
+// is always the resolved amount owed by the member.
+type SplitPart struct {
+	Member string        `json:"member"`
+	Weight int64         `json:"weight,omitempty"`
+	Amount *money.Amount `json:"amount,omitempty"`
+}
+
+// Validate implements Validator on Split. It checks the structure of
+// the split only, use Resolve for checking it against a total.
+func (s Split) Validate() error {
+	if len(s.Parts) == 0 {
+		return fmt.Errorf("%w: no parts", ErrSplit)
+	}
+	seen := make(map[string]bool, len(s.Parts))
+	for _, p := range s.Parts {
+		if p.Member == "" {
+			return fmt.Errorf("%w: missing member", ErrSplit)
+		}
+		if seen[p.Member] {
+			return fmt.Errorf("%w: duplicate member %q", ErrSplit, p.Member)
+		}
+		seen[p.Member] = true
+		if p.Weight < 0 || p.Amount != nil && p.Amount.Sign() < 0 {
+			return fmt.Errorf("%w: negative value for %q", ErrSplit, p.Member)
+		}
+	}
+	var sum int64
+	for _, p := range s.Parts {
+		sum += p.Weight
+	}
+	switch s.Mode {
+	case db.SplitEqual:
+	case db.SplitExact:
+		for _, p := range s.Parts {
+			if p.Amount == nil {
+				return fmt.Errorf("%w: missing amount for %q", ErrSplit, p.Member)
+			}
+		}
+	case db.SplitPercent:
+		if sum != 100 {
+			return fmt.Errorf("%w: percentages add up to %d", ErrSplit, sum)
+		}
+	case db.SplitShares:
+		if sum <= 0 {
+			return fmt.Errorf("%w: no shares", ErrSplit)
+		}
+	default:
+		return fmt.Errorf("%w: unknown mode %q", ErrSplit, s.Mode)
+	}
+	return nil
+}
+
+// Resolve computes the amount owed by every member out of total as per
+// the split mode. Any remainder left after proportional division is
+// handed out one minor unit at a time to the parts with the largest
+// fractional remainder, ties broken by member id, so that the shares
+// always add up to the total (see money.Amount.Allocate). Shares are
+// sorted by member id.
+func (s Split) Resolve(total money.Amount) ([]db.Share, error) {
+	err := s.Validate()
+	if err != nil {
+		return nil, err
+	}
+	if total.Sign() <= 0 {
+		return nil, fmt.Errorf("%w: non-positive total", ErrSplit)
+	}
+	parts := make([]SplitPart, len(s.Parts))
+	copy(parts, s.Parts)
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].Member < parts[j].Member
+	})
+	shares := make([]db.Share, len(parts))
+	weights := make([]int64, len(parts))
+	for i, p := range parts {
+		shares[i].Uid = p.Member
+		switch s.Mode {
+		case db.SplitEqual:
+			weights[i] = 1
+		case db.SplitExact:
+			if p.Amount.Currency != total.Currency {
+				return nil, fmt.Errorf("%w: currency of %q", ErrSplit, p.Member)
+			}
+			weights[i] = p.Amount.Minor
+		default:
+			weights[i] = p.Weight
+		}
+		shares[i].Weight = weights[i]
+	}
+	if s.Mode == db.SplitExact {
+		var sum int64
+		for _, w := range weights {
+			sum += w
+		}
+		if sum != total.Minor {
+			return nil, fmt.Errorf(
+				"%w: amounts add up to %s, not %s",
+				ErrSplit, money.New(sum, total.Currency), total,
+			)
+		}
+	}
+	amounts, err := total.Allocate(weights...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSplit, err)
+	}
+	for i, amount := range amounts {
+		shares[i].Amount = amount
+	}
+	return shares, nil
+}
@@ -8,7 +8,6 @@ import (
 	"log"
 	"net/http"
 	"net/url"
-	"strings"
 
 	"github.com/manojnakp/scount/api/internal"
 
@@ -49,19 +48,9 @@ func ParseUserQuery(query url.Values) (*UserQuery, error) {
 	if err != nil {
 		return nil, err
 	}
-	sort := strings.Split(query.Get("sort"), ",")
-	list := make([]db.Sorter, 0, len(sort))
-	for _, s := range sort {
-		s = strings.TrimSpace(s)
-		// skip empty string
-		if s == "" {
-			continue
-		}
-		sorter, ok := internal.UserSortMap[s]
-		if !ok {
-			return nil, fmt.Errorf("%w: invalid 'sort' parameter", ErrUserQuery)
-		}
-		list = append(list, sorter)
+	list, err := internal.ParseSort(query.Get("sort"), internal.UserSortMap)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid 'sort' parameter: %w", ErrUserQuery, err)
 	}
 	// fallback to default sorter
 	if len(list) == 0 {
@@ -89,7 +78,7 @@ type User struct {
 type UserUpdater struct {
 	// /docs/UserUpdater.json
 	// Schema string `json:"$schema,omitempty"`
-	Username string `json:"username,omitempty"`
+	Name string `json:"name,omitempty"`
 }
 
 // Validate implements Validator on UserUpdater.
@@ -111,8 +100,10 @@ func (res UserResource) Router() chi.Router {
 	r.Get("/{uid}", res.GetUser)
 	r.With(res.setCurrentUser).
 		Get("/me", res.GetCurrentUser)
-	r.Patch("/me", res.UpdateUser)
-	r.Delete("/me", res.DeleteUser)
+	r.With(res.setCurrentUser, Schemaware("UserUpdater.json"), BodyParser[UserUpdater], Validware[UserUpdater]).
+		Patch("/me", res.UpdateUser)
+	r.With(res.setCurrentUser).
+		Delete("/me", res.DeleteUser)
 	return r
 }
 
@@ -128,10 +119,10 @@ func (res UserResource) fetch(w http.ResponseWriter, r *http.Request) {
 	user, err := res.DB.Users.FindOne(r.Context(), &db.UserId{Uid: id})
 	switch {
 	case errors.Is(err, db.ErrNoRows): // uid not exist
-		w.WriteHeader(http.StatusNotFound)
+		ProblemNotFound.Write(w)
 		return
 	case err != nil: // failed to query the db
-		w.WriteHeader(http.StatusInternalServerError)
+		ProblemInternal.Write(w)
 		return
 	}
 	w.WriteHeader(http.StatusOK) // ALL OK
@@ -179,33 +170,42 @@ func (res UserResource) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	err := res.DB.Users.UpdateOne(
 		r.Context(),
 		&db.UserId{Uid: id},
-		&db.UserUpdater{Username: updater.Username},
+		&db.UserUpdater{Username: updater.Name},
 	)
 	switch {
 	case errors.Is(err, db.ErrNoRows):
 		// also considered success
 	case errors.Is(err, db.ErrConflict): // conflict
-		w.WriteHeader(http.StatusConflict)
+		ProblemConflict.Write(w)
 		return
 	case err != nil: // unknown error
-		w.WriteHeader(http.StatusInternalServerError)
+		ProblemInternal.Write(w)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent) // ALL OK
 }
 
-// DeleteUser handles DELETE method on `users/me` route.
+// DeleteUser handles DELETE method on `users/me` route. Owners of
+// scounts and users with an open balance are refused with a problem
+// body, otherwise memberships with history are left as guests.
 func (res UserResource) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	id := r.Context().Value(UserKey).(string)
 	err := res.DB.Users.DeleteOne(r.Context(), &db.UserId{Uid: id})
 	switch {
 	case errors.Is(err, db.ErrNoRows):
 	// also considered success
+	case errors.Is(err, db.ErrOwnsScounts):
+		ProblemOwnsScounts.Write(w)
+		return
+	case errors.Is(err, db.ErrOpenBalance):
+		ProblemOpenBalance.Write(w)
+		return
 	case errors.Is(err, db.ErrConflict):
-		w.WriteHeader(http.StatusConflict)
+		ProblemConflict.Write(w)
 		return
 	case err != nil:
-		w.WriteHeader(http.StatusInternalServerError)
+		log.Println(err)
+		ProblemInternal.Write(w)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -215,37 +215,43 @@ func (res UserResource) DeleteUser(w http.ResponseWriter, r *http.Request) {
 func (res UserResource) ListUsers(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	query := ctx.Value(QueryKey).(*UserQuery)
-	page, size := query.Paging.Page, query.Paging.Size
+	projector, err := query.Paging.Projector(query.Sort, db.UserKeyCols)
+	if err != nil {
+		ProblemInvalidQuery.With(err.Error()).Write(w)
+		return
+	}
 	// database call
 	users, err := res.DB.Users.Find(
 		ctx,
 		&db.UserFilter{Uid: query.Id, Email: query.Email, Username: query.Name},
-		&db.Projector{Order: query.Sort, Paging: &db.Paging{Limit: size, Offset: size * page}},
+		projector,
 	)
+	switch {
+	case errors.Is(err, db.ErrInvalidColumn):
+		ProblemInvalidColumn.Write(w)
+		return
+	case err != nil:
+		log.Println(err)
+		ProblemInternal.Write(w)
+		return
+	}
+	page, err := PageOf("/users", r.URL.Query(), query.Paging, projector, users)
 	if err != nil {
 		log.Println(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		ProblemInternal.Write(w)
 		return
 	}
 	// build response collection
-	list := make([]User, 0)
-	users.Iterator(func(u db.User) bool {
+	list := make([]User, 0, len(page.Items))
+	for _, u := range page.Items {
 		list = append(list, User{
 			Schema: UserSchema,
 			Id:     u.Uid,
 			Email:  u.Email,
 			Name:   u.Username,
 		})
-		return true
-	})
-	err = users.Err()
-	if err != nil {
-		log.Println(err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
 	}
-	links := PagingLinks("/users", r.URL.Query(), users.Total())
-	LinkHeader(w, links)
+	page.Header(w)
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(list) // respond
 }
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ActivityKind tells what kind of change an activity records.
+type ActivityKind string
+
+// kinds of activity, named after the record changed.
+const (
+	ActivityScountCreated     ActivityKind = "scount.created"
+	ActivityScountUpdated     ActivityKind = "scount.updated" // renamed or handed over
+	ActivityScountDeleted     ActivityKind = "scount.deleted" // moved to the trash
+	ActivityScountRestored    ActivityKind = "scount.restored"
+	ActivityMemberAdded       ActivityKind = "member.added"
+	ActivityMemberUpdated     ActivityKind = "member.updated"
+	ActivityMemberRemoved     ActivityKind = "member.removed"
+	ActivityExpenseAdded      ActivityKind = "expense.added"
+	ActivityExpenseEdited     ActivityKind = "expense.edited"
+	ActivityExpenseDeleted    ActivityKind = "expense.deleted" // moved to the trash
+	ActivityExpenseRestored   ActivityKind = "expense.restored"
+	ActivitySettlementAdded   ActivityKind = "settlement.recorded"
+	ActivitySettlementDeleted ActivityKind = "settlement.deleted"
+)
+
+// Activity depicts an entry of the activity feed of a scount, for
+// interactions with the activities datastore. Before and After are the
+// JSON values of the changed record (Target) either side of the change,
+// nil if none. Activities are append-only.
+type Activity struct {
+	Aid    string // id
+	Sid    string // scount of the change
+	Actor  string // user who made the change
+	Kind   ActivityKind
+	Target string    // id of the changed record within the scount
+	Time   time.Time // time of the change
+	Before json.RawMessage
+	After  json.RawMessage
+}
+
+// ActivityId is the 'id' type for activity collection. Both sid and aid
+// determine an activity uniquely.
+type ActivityId struct {
+	Sid string
+	Aid string
+}
+
+// ActivityFilter provides fields for filtering the activities.
+type ActivityFilter struct {
+	Sid    string
+	Aid    string
+	Actor  string
+	Kind   ActivityKind
+	Target string
+}
+
+// ActivityUpdater provides fields necessary for update operation for
+// activity record, none since activities are append-only.
+type ActivityUpdater struct{}
+
+// ActivityAllowedCols is a list of columns allowed for sorting.
+var ActivityAllowedCols = []Column{"aid", "actor", "kind", "time"}
+
+// ActivityKeyCols is a list of columns that identify an activity uniquely.
+var ActivityKeyCols = []Column{"aid"}
+
+// Key implements Keyed on Activity.
+func (a Activity) Key(c Column) any {
+	switch c {
+	case "aid":
+		return a.Aid
+	case "actor":
+		return a.Actor
+	case "kind":
+		return string(a.Kind)
+	case "time":
+		return a.Time
+	}
+	return nil
+}
@@ -0,0 +1,761 @@
+// Package dbtest provides a conformance suite for implementations of
+// db.Store, so that every datastore behaves the same towards the api.
+package dbtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/manojnakp/scount/db"
+	"github.com/manojnakp/scount/money"
+)
+
+// Opener opens an empty store for a single test.
+type Opener func(t *testing.T) *db.Store
+
+// Run runs the conformance suite on the stores opened by open.
+func Run(t *testing.T, open Opener) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store *db.Store)
+	}{
+		{"Users", testUsers},
+		{"Scounts", testScounts},
+		{"Members", testMembers},
+		{"Expenses", testExpenses},
+		{"Settlements", testSettlements},
+		{"Invites", testInvites},
+		{"Activities", testActivities},
+		{"Paging", testPaging},
+		{"Tx", testTx},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, open(t))
+		})
+	}
+}
+
+// check fails t unless err matches target, nil target for success.
+func check(t *testing.T, what string, err, target error) {
+	t.Helper()
+	if target == nil && err != nil {
+		t.Fatalf("%s: unexpected error: %v", what, err)
+	}
+	if target != nil && !errors.Is(err, target) {
+		t.Fatalf("%s: got error %v, want %v", what, err, target)
+	}
+}
+
+// collect consumes list, giving the items and total.
+func collect[T any](t *testing.T, what string, list *db.Iterable[T], err error) ([]T, int) {
+	t.Helper()
+	check(t, what, err, nil)
+	items := make([]T, 0)
+	list.Iterator(func(item T) bool {
+		items = append(items, item)
+		return true
+	})
+	check(t, what, list.Err(), nil)
+	return items, list.Total()
+}
+
+// keys gives the values of column c of items.
+func keys[T db.Keyed](items []T, c db.Column) []any {
+	values := make([]any, len(items))
+	for i, item := range items {
+		values[i] = item.Key(c)
+	}
+	return values
+}
+
+// sharers gives the uids of shares.
+func sharers(shares []db.Share) []any {
+	uids := make([]any, len(shares))
+	for i, share := range shares {
+		uids[i] = share.Uid
+	}
+	return uids
+}
+
+// equal fails t unless got equals want.
+func equal(t *testing.T, what string, got, want []any) {
+	t.Helper()
+	if !slices.Equal(got, want) {
+		t.Fatalf("%s: got %v, want %v", what, got, want)
+	}
+}
+
+// seed inserts users u1, u2, u3 and scount s1 owned by u1 with u2 as a
+// member.
+func seed(t *testing.T, store *db.Store) context.Context {
+	t.Helper()
+	ctx := context.Background()
+	err := store.Users.Insert(ctx,
+		db.User{Uid: "u1", Email: "u1@example.com", Username: "Alice", Password: []byte("p1")},
+		db.User{Uid: "u2", Email: "u2@example.com", Username: "Bob", Password: []byte("p2")},
+		db.User{Uid: "u3", Email: "u3@example.com", Username: "Carol", Password: []byte("p3")},
+	)
+	check(t, "insert users", err, nil)
+	err = store.Scounts.Insert(ctx, db.Scount{Sid: "s1", Owner: "u1", Title: "Trip", Currency: "EUR"})
+	check(t, "insert scount", err, nil)
+	err = store.Members.Insert(ctx, db.Member{Sid: "s1", Uid: "u2"})
+	check(t, "insert member", err, nil)
+	return ctx
+}
+
+// euros gives the amount of minor euros.
+func euros(minor int64) money.Amount {
+	return money.New(minor, "EUR")
+}
+
+// expense gives an expense in euros paid by payer, equally shared by
+// the sharers (minor assumed to be divisible).
+func expense(sid, eid, payer, title string, minor int64, sharers ...string) db.Expense {
+	shares := make([]db.Share, len(sharers))
+	for i, uid := range sharers {
+		portion := euros(minor / int64(len(sharers)))
+		shares[i] = db.Share{Uid: uid, Weight: 1, Amount: portion, Base: portion}
+	}
+	return db.Expense{
+		Sid:    sid,
+		Eid:    eid,
+		Payer:  payer,
+		Title:  title,
+		Amount: euros(minor),
+		Rate:   money.Identity("EUR"),
+		Base:   euros(minor),
+		Mode:   db.SplitEqual,
+		Shares: shares,
+	}
+}
+
+// settlement gives a settlement in euros from payer to payee.
+func settlement(sid, stid, payer, payee string, minor int64) db.Settlement {
+	return db.Settlement{
+		Sid:    sid,
+		Stid:   stid,
+		Payer:  payer,
+		Payee:  payee,
+		Amount: euros(minor),
+		Rate:   money.Identity("EUR"),
+		Base:   euros(minor),
+	}
+}
+
+func testUsers(t *testing.T, store *db.Store) {
+	ctx := seed(t, store)
+	users := store.Users
+	check(t, "insert none", users.Insert(ctx), db.ErrNoRows)
+	err := users.Insert(ctx, db.User{Uid: "u4", Email: "u1@example.com", Username: "Eve"})
+	check(t, "insert duplicate email", err, db.ErrConflict)
+	err = users.Insert(ctx, db.User{Uid: "u1", Email: "u4@example.com", Username: "Eve"})
+	check(t, "insert duplicate uid", err, db.ErrConflict)
+	// all or none
+	err = users.Insert(ctx,
+		db.User{Uid: "u5", Email: "u5@example.com", Username: "Eve"},
+		db.User{Uid: "u6", Email: "u1@example.com", Username: "Eve"},
+	)
+	check(t, "insert partly duplicate", err, db.ErrConflict)
+	_, err = users.FindOne(ctx, &db.UserId{Uid: "u5"})
+	check(t, "find rolled back", err, db.ErrNoRows)
+	// lookups
+	u, err := users.FindOne(ctx, &db.UserId{Uid: "u2"})
+	check(t, "find", err, nil)
+	if u.Email != "u2@example.com" || u.Username != "Bob" || string(u.Password) != "p2" {
+		t.Fatalf("find: got %+v", u)
+	}
+	_, err = users.FindOne(ctx, nil)
+	check(t, "find nil", err, db.ErrNil)
+	u, err = users.FindByEmail(ctx, "u3@example.com")
+	check(t, "find by email", err, nil)
+	if u.Uid != "u3" {
+		t.Fatalf("find by email: got %+v", u)
+	}
+	_, err = users.FindByEmail(ctx, "nobody@example.com")
+	check(t, "find by missing email", err, db.ErrNoRows)
+	// updates
+	err = users.UpdateOne(ctx, &db.UserId{Uid: "u2"}, &db.UserUpdater{Username: "Robert"})
+	check(t, "update", err, nil)
+	err = users.UpdateOne(ctx, &db.UserId{Uid: "u9"}, &db.UserUpdater{Username: "Robert"})
+	check(t, "update missing", err, db.ErrNoRows)
+	err = users.UpdatePassword(ctx, &db.PasswordUpdater{Uid: "u2", Old: []byte("wrong"), New: []byte("x")})
+	check(t, "update password with wrong old", err, db.ErrNoRows)
+	err = users.UpdatePassword(ctx, &db.PasswordUpdater{Uid: "u2", Old: []byte("p2"), New: []byte("x")})
+	check(t, "update password", err, nil)
+	u, err = users.FindOne(ctx, &db.UserId{Uid: "u2"})
+	check(t, "find updated", err, nil)
+	if u.Username != "Robert" || string(u.Password) != "x" {
+		t.Fatalf("find updated: got %+v", u)
+	}
+	// filtering
+	userList, err := users.Find(ctx, &db.UserFilter{Username: "%o%"}, nil)
+	found, _ := collect(t, "find by username", userList, err)
+	equal(t, "find by username", keys(found, "uid"), []any{"u2", "u3"})
+	// deletion
+	check(t, "delete nil", users.DeleteOne(ctx, nil), db.ErrNil)
+	check(t, "delete owner", users.DeleteOne(ctx, &db.UserId{Uid: "u1"}), db.ErrOwnsScounts)
+	err = store.Members.Insert(ctx, db.Member{Sid: "s1", Uid: "u3"})
+	check(t, "insert member", err, nil)
+	err = store.Expenses.Insert(ctx, expense("s1", "e1", "u2", "Fuel", 2000, "u2", "u3"))
+	check(t, "insert expense", err, nil)
+	check(t, "delete with open balance", users.DeleteOne(ctx, &db.UserId{Uid: "u3"}), db.ErrOpenBalance)
+	err = store.Settlements.Insert(ctx, settlement("s1", "t1", "u3", "u2", 1000))
+	check(t, "insert settlement", err, nil)
+	err = store.Invites.Insert(ctx, db.Invite{Sid: "s1", Iid: "i1", Creator: "u2", Expires: time.Now().Add(time.Hour)})
+	check(t, "insert invite", err, nil)
+	check(t, "delete settled", users.DeleteOne(ctx, &db.UserId{Uid: "u2"}), nil)
+	m, err := store.Members.FindOne(ctx, &db.MemberId{Sid: "s1", Uid: "u2"})
+	check(t, "find former member", err, nil)
+	if !m.Guest || m.Name != db.FormerMember || m.Role != db.RoleMember {
+		t.Fatalf("find former member: got %+v", m)
+	}
+	_, err = store.Invites.FindOne(ctx, &db.InviteId{Iid: "i1"})
+	check(t, "find revoked invite", err, db.ErrNoRows)
+	check(t, "delete", users.DeleteOne(ctx, &db.UserId{Uid: "u3"}), nil)
+	check(t, "delete again", users.DeleteOne(ctx, &db.UserId{Uid: "u3"}), db.ErrNoRows)
+	check(t, "trash scount", store.Scounts.DeleteOne(ctx, &db.ScountId{Sid: "s1"}), nil)
+	check(t, "delete owner of trash", users.DeleteOne(ctx, &db.UserId{Uid: "u1"}), nil)
+	check(t, "restore purged", store.Scounts.Restore(ctx, &db.ScountId{Sid: "s1"}), db.ErrNoRows)
+}
+
+func testScounts(t *testing.T, store *db.Store) {
+	ctx := seed(t, store)
+	scounts := store.Scounts
+	err := scounts.Insert(ctx, db.Scount{Sid: "s2", Owner: "u9", Title: "Flat", Currency: "EUR"})
+	check(t, "insert with missing owner", err, db.ErrConflict)
+	err = scounts.Insert(ctx, db.Scount{Sid: "s1", Owner: "u2", Title: "Flat", Currency: "EUR"})
+	check(t, "insert duplicate", err, db.ErrConflict)
+	err = scounts.Insert(ctx, db.Scount{Sid: "s2", Owner: "u2", Title: "Flat", Currency: "euro"})
+	check(t, "insert with invalid currency", err, db.ErrConflict)
+	err = scounts.Insert(ctx, db.Scount{Sid: "s2", Owner: "u2", Title: "Flat", Currency: "USD"})
+	check(t, "insert", err, nil)
+	// owner is a member
+	m, err := store.Members.FindOne(ctx, &db.MemberId{Sid: "s2", Uid: "u2"})
+	check(t, "find owner", err, nil)
+	if m.Role != db.RoleOwner {
+		t.Fatalf("find owner: got role %q", m.Role)
+	}
+	// filtering
+	scountList, err := scounts.Find(ctx, &db.ScountFilter{Member: "u2"}, nil)
+	found, _ := collect(t, "find by member", scountList, err)
+	equal(t, "find by member", keys(found, "sid"), []any{"s1", "s2"})
+	scountList, err = scounts.Find(ctx, &db.ScountFilter{Uid: "u1"}, nil)
+	found, _ = collect(t, "find by uid", scountList, err)
+	equal(t, "find by uid", keys(found, "sid"), []any{"s1"})
+	scountList, err = scounts.Find(ctx, &db.ScountFilter{Title: "fl%"}, nil)
+	found, _ = collect(t, "find by title", scountList, err)
+	equal(t, "find by title", keys(found, "sid"), []any{"s2"})
+	// ownership
+	err = scounts.UpdateOne(ctx, &db.ScountId{Sid: "s1"}, &db.ScountUpdater{Owner: "u3"})
+	check(t, "transfer to non member", err, db.ErrConflict)
+	s, err := scounts.FindOne(ctx, &db.ScountId{Sid: "s1"})
+	check(t, "find", err, nil)
+	if s.Owner != "u1" {
+		t.Fatalf("transfer to non member: owner changed to %q", s.Owner)
+	}
+	err = scounts.UpdateOne(ctx, &db.ScountId{Sid: "s1"}, &db.ScountUpdater{Owner: "u2", Title: "Road trip"})
+	check(t, "transfer", err, nil)
+	s, err = scounts.FindOne(ctx, &db.ScountId{Sid: "s1"})
+	check(t, "find transferred", err, nil)
+	if s.Owner != "u2" || s.Title != "Road trip" {
+		t.Fatalf("find transferred: got %+v", s)
+	}
+	memberList, err := store.Members.Find(ctx, &db.MemberFilter{Sid: "s1"}, nil)
+	owners, _ := collect(t, "find roles", memberList, err)
+	equal(t, "find roles", keys(owners, "role"), []any{"admin", "owner"})
+	err = scounts.UpdateOne(ctx, &db.ScountId{Sid: "s9"}, &db.ScountUpdater{Title: "Nothing"})
+	check(t, "update missing", err, db.ErrNoRows)
+	// deletion
+	err = store.Expenses.Insert(ctx, expense("s1", "e1", "u1", "Fuel", 2000, "u1", "u2"))
+	check(t, "insert expense", err, nil)
+	err = store.Settlements.Insert(ctx, settlement("s1", "t1", "u2", "u1", 1000))
+	check(t, "insert settlement", err, nil)
+	err = store.Invites.Insert(ctx, db.Invite{Sid: "s1", Iid: "i1", Creator: "u2", Expires: time.Now().Add(time.Hour)})
+	check(t, "insert invite", err, nil)
+	check(t, "trash", scounts.DeleteOne(ctx, &db.ScountId{Sid: "s1"}), nil)
+	check(t, "trash again", scounts.DeleteOne(ctx, &db.ScountId{Sid: "s1"}), db.ErrNoRows)
+	_, err = scounts.FindOne(ctx, &db.ScountId{Sid: "s1"})
+	check(t, "find trashed", err, db.ErrNoRows)
+	err = scounts.UpdateOne(ctx, &db.ScountId{Sid: "s1"}, &db.ScountUpdater{Title: "Nothing"})
+	check(t, "update trashed", err, db.ErrNoRows)
+	_, err = scounts.Balances(ctx, "s1")
+	check(t, "balances of trashed", err, db.ErrNoRows)
+	scountList, err = scounts.Find(ctx, &db.ScountFilter{Member: "u2"}, nil)
+	found, _ = collect(t, "find live", scountList, err)
+	equal(t, "find live", keys(found, "sid"), []any{"s2"})
+	scountList, err = scounts.Find(ctx, &db.ScountFilter{Member: "u2", Trash: true}, nil)
+	found, _ = collect(t, "find in trash", scountList, err)
+	equal(t, "find in trash", keys(found, "sid"), []any{"s1"})
+	if found[0].Deleted.IsZero() {
+		t.Fatalf("find in trash: got %+v", found[0])
+	}
+	check(t, "restore", scounts.Restore(ctx, &db.ScountId{Sid: "s1"}), nil)
+	check(t, "restore again", scounts.Restore(ctx, &db.ScountId{Sid: "s1"}), db.ErrNoRows)
+	_, err = scounts.FindOne(ctx, &db.ScountId{Sid: "s1"})
+	check(t, "find restored", err, nil)
+	check(t, "trash", scounts.DeleteOne(ctx, &db.ScountId{Sid: "s1"}), nil)
+	n, err := scounts.Purge(ctx, time.Now().Add(-time.Hour))
+	check(t, "purge early", err, nil)
+	if n != 0 {
+		t.Fatalf("purge early: purged %d", n)
+	}
+	n, err = scounts.Purge(ctx, time.Now().Add(time.Second))
+	check(t, "purge", err, nil)
+	if n != 1 {
+		t.Fatalf("purge: purged %d", n)
+	}
+	_, err = store.Members.FindOne(ctx, &db.MemberId{Sid: "s1", Uid: "u2"})
+	check(t, "find deleted member", err, db.ErrNoRows)
+	_, err = store.Expenses.FindOne(ctx, &db.ExpenseId{Sid: "s1", Eid: "e1"})
+	check(t, "find deleted expense", err, db.ErrNoRows)
+	_, err = store.Settlements.FindOne(ctx, &db.SettlementId{Sid: "s1", Stid: "t1"})
+	check(t, "find deleted settlement", err, db.ErrNoRows)
+	_, err = store.Invites.FindOne(ctx, &db.InviteId{Iid: "i1"})
+	check(t, "find deleted invite", err, db.ErrNoRows)
+	check(t, "restore purged", scounts.Restore(ctx, &db.ScountId{Sid: "s1"}), db.ErrNoRows)
+}
+
+func testMembers(t *testing.T, store *db.Store) {
+	ctx := seed(t, store)
+	members := store.Members
+	err := members.Insert(ctx, db.Member{Sid: "s1", Uid: "u2"})
+	check(t, "insert duplicate", err, db.ErrConflict)
+	err = members.Insert(ctx, db.Member{Sid: "s9", Uid: "u3"})
+	check(t, "insert into missing scount", err, db.ErrConflict)
+	err = members.Insert(ctx, db.Member{Sid: "s1", Uid: "u3", Role: db.RoleOwner})
+	check(t, "insert second owner", err, db.ErrConflict)
+	err = members.Insert(ctx, db.Member{Sid: "s1", Uid: "g1", Guest: true})
+	check(t, "insert guest without name", err, db.ErrConflict)
+	err = members.Insert(ctx,
+		db.Member{Sid: "s1", Uid: "u3", Role: db.RoleViewer},
+		db.Member{Sid: "s1", Uid: "g1", Name: "Dave", Guest: true},
+	)
+	check(t, "insert", err, nil)
+	m, err := members.FindOne(ctx, &db.MemberId{Sid: "s1", Uid: "u2"})
+	check(t, "find", err, nil)
+	if m.Role != db.RoleMember || m.Guest {
+		t.Fatalf("find: got %+v", m)
+	}
+	memberList, err := members.Find(ctx, &db.MemberFilter{Sid: "s1", Role: db.RoleViewer}, nil)
+	found, _ := collect(t, "find by role", memberList, err)
+	equal(t, "find by role", keys(found, "uid"), []any{"u3"})
+	// roles
+	err = members.UpdateOne(ctx, &db.MemberId{Sid: "s1", Uid: "u3"}, &db.MemberUpdater{Role: db.RoleAdmin})
+	check(t, "update", err, nil)
+	err = members.UpdateOne(ctx, &db.MemberId{Sid: "s1", Uid: "u3"}, &db.MemberUpdater{Role: db.RoleOwner})
+	check(t, "update to second owner", err, db.ErrConflict)
+	err = members.UpdateOne(ctx, &db.MemberId{Sid: "s1", Uid: "u9"}, &db.MemberUpdater{Role: db.RoleAdmin})
+	check(t, "update missing", err, db.ErrNoRows)
+	// claiming a guest moves over expenses and settlements
+	err = store.Expenses.Insert(ctx, expense("s1", "e1", "g1", "Dinner", 3000, "g1", "u1", "u2"))
+	check(t, "insert expense", err, nil)
+	err = store.Settlements.Insert(ctx, settlement("s1", "t1", "u2", "g1", 1000))
+	check(t, "insert settlement", err, nil)
+	check(t, "delete referred", members.DeleteOne(ctx, &db.MemberId{Sid: "s1", Uid: "g1"}), db.ErrConflict)
+	err = members.Claim(ctx, &db.MemberId{Sid: "s1", Uid: "u2"}, "u3")
+	check(t, "claim non guest", err, db.ErrNoRows)
+	err = members.Claim(ctx, &db.MemberId{Sid: "s1", Uid: "g1"}, "u2")
+	check(t, "claim by member", err, db.ErrConflict)
+	err = store.Users.Insert(ctx, db.User{Uid: "u4", Email: "u4@example.com", Username: "Dave"})
+	check(t, "insert user", err, nil)
+	err = members.Claim(ctx, &db.MemberId{Sid: "s1", Uid: "g1"}, "u4")
+	check(t, "claim", err, nil)
+	_, err = members.FindOne(ctx, &db.MemberId{Sid: "s1", Uid: "g1"})
+	check(t, "find claimed guest", err, db.ErrNoRows)
+	e, err := store.Expenses.FindOne(ctx, &db.ExpenseId{Sid: "s1", Eid: "e1"})
+	check(t, "find claimed expense", err, nil)
+	if e.Payer != "u4" {
+		t.Fatalf("find claimed expense: payer %q", e.Payer)
+	}
+	equal(t, "find claimed shares", sharers(e.Shares), []any{"u1", "u2", "u4"})
+	st, err := store.Settlements.FindOne(ctx, &db.SettlementId{Sid: "s1", Stid: "t1"})
+	check(t, "find claimed settlement", err, nil)
+	if st.Payee != "u4" {
+		t.Fatalf("find claimed settlement: payee %q", st.Payee)
+	}
+	// leaving with history leaves a former member in place
+	check(t, "leave", members.Leave(ctx, &db.MemberId{Sid: "s1", Uid: "u4"}, "g2"), nil)
+	_, err = members.FindOne(ctx, &db.MemberId{Sid: "s1", Uid: "u4"})
+	check(t, "find left member", err, db.ErrNoRows)
+	m, err = members.FindOne(ctx, &db.MemberId{Sid: "s1", Uid: "g2"})
+	check(t, "find former member", err, nil)
+	if !m.Guest || m.Name != db.FormerMember || m.Role != db.RoleMember {
+		t.Fatalf("find former member: got %+v", m)
+	}
+	e, err = store.Expenses.FindOne(ctx, &db.ExpenseId{Sid: "s1", Eid: "e1"})
+	check(t, "find expense of former member", err, nil)
+	if e.Payer != "g2" {
+		t.Fatalf("find expense of former member: payer %q", e.Payer)
+	}
+	equal(t, "find shares of former member", sharers(e.Shares), []any{"g2", "u1", "u2"})
+	st, err = store.Settlements.FindOne(ctx, &db.SettlementId{Sid: "s1", Stid: "t1"})
+	check(t, "find settlement of former member", err, nil)
+	if st.Payee != "g2" {
+		t.Fatalf("find settlement of former member: payee %q", st.Payee)
+	}
+	check(t, "leave as guest with history", members.Leave(ctx, &db.MemberId{Sid: "s1", Uid: "g2"}, "g3"), db.ErrConflict)
+	check(t, "leave missing", members.Leave(ctx, &db.MemberId{Sid: "s1", Uid: "u4"}, "g3"), db.ErrNoRows)
+	check(t, "leave without history", members.Leave(ctx, &db.MemberId{Sid: "s1", Uid: "u3"}, "g3"), nil)
+	_, err = members.FindOne(ctx, &db.MemberId{Sid: "s1", Uid: "g3"})
+	check(t, "find no former member", err, db.ErrNoRows)
+	// deletion
+	err = members.Insert(ctx, db.Member{Sid: "s1", Uid: "u3"})
+	check(t, "insert again", err, nil)
+	check(t, "delete", members.DeleteOne(ctx, &db.MemberId{Sid: "s1", Uid: "u3"}), nil)
+	check(t, "delete again", members.DeleteOne(ctx, &db.MemberId{Sid: "s1", Uid: "u3"}), db.ErrNoRows)
+}
+
+func testExpenses(t *testing.T, store *db.Store) {
+	ctx := seed(t, store)
+	expenses := store.Expenses
+	err := expenses.Insert(ctx, expense("s1", "e1", "u3", "Dinner", 3000, "u1", "u2"))
+	check(t, "insert with non member payer", err, db.ErrConflict)
+	err = expenses.Insert(ctx, expense("s1", "e1", "u1", "Dinner", 3000, "u1", "u3"))
+	check(t, "insert with non member share", err, db.ErrConflict)
+	err = expenses.Insert(ctx, expense("s1", "e1", "u1", "Dinner", 0, "u1", "u2"))
+	check(t, "insert zero amount", err, db.ErrConflict)
+	err = expenses.Insert(ctx,
+		expense("s1", "e1", "u1", "Dinner", 3000, "u2", "u1"),
+		expense("s1", "e2", "u2", "Taxi", 1000, "u1", "u2"),
+	)
+	check(t, "insert", err, nil)
+	e, err := expenses.FindOne(ctx, &db.ExpenseId{Sid: "s1", Eid: "e1"})
+	check(t, "find", err, nil)
+	if e.Payer != "u1" || e.Amount != euros(3000) || e.Base != euros(3000) || e.Mode != db.SplitEqual {
+		t.Fatalf("find: got %+v", e)
+	}
+	if e.Rate.From != "EUR" || e.Rate.To != "EUR" || e.Rate.Decimal() != "1" {
+		t.Fatalf("find: got rate %s", e.Rate)
+	}
+	equal(t, "find shares", sharers(e.Shares), []any{"u1", "u2"})
+	if e.Shares[0].Amount != euros(1500) || e.Shares[0].Base != euros(1500) {
+		t.Fatalf("find: got share %+v", e.Shares[0])
+	}
+	expenseList, err := expenses.Find(ctx, &db.ExpenseFilter{Sid: "s1", Payer: "u2"}, nil)
+	found, _ := collect(t, "find by payer", expenseList, err)
+	equal(t, "find by payer", keys(found, "eid"), []any{"e2"})
+	expenseList, err = expenses.Find(ctx, &db.ExpenseFilter{Title: "%INN%"}, nil)
+	found, _ = collect(t, "find by title", expenseList, err)
+	equal(t, "find by title", keys(found, "eid"), []any{"e1"})
+	// updates
+	shares := []db.Share{{Uid: "u2", Weight: 1, Amount: euros(3000), Base: euros(3000)}}
+	err = expenses.UpdateOne(ctx, &db.ExpenseId{Sid: "s1", Eid: "e1"}, &db.ExpenseUpdater{Title: "Lunch", Shares: shares})
+	check(t, "update", err, nil)
+	e, err = expenses.FindOne(ctx, &db.ExpenseId{Sid: "s1", Eid: "e1"})
+	check(t, "find updated", err, nil)
+	if e.Title != "Lunch" || len(e.Shares) != 1 || e.Shares[0].Uid != "u2" {
+		t.Fatalf("find updated: got %+v", e)
+	}
+	err = expenses.UpdateOne(ctx, &db.ExpenseId{Sid: "s1", Eid: "e1"}, &db.ExpenseUpdater{Payer: "u3"})
+	check(t, "update with non member payer", err, db.ErrConflict)
+	err = expenses.UpdateOne(ctx, &db.ExpenseId{Sid: "s1", Eid: "e9"}, &db.ExpenseUpdater{Title: "Lunch"})
+	check(t, "update missing", err, db.ErrNoRows)
+	// balances
+	balances, err := store.Scounts.Balances(ctx, "s1")
+	check(t, "balances", err, nil)
+	if len(balances) != 2 {
+		t.Fatalf("balances: got %+v", balances)
+	}
+	if b := balances[0]; b.Uid != "u1" || b.Paid != euros(3000) || b.Owed != euros(500) {
+		t.Fatalf("balances: got %+v", b)
+	}
+	if b := balances[1]; b.Uid != "u2" || b.Paid != euros(1000) || b.Owed != euros(3500) {
+		t.Fatalf("balances: got %+v", b)
+	}
+	_, err = store.Scounts.Balances(ctx, "s9")
+	check(t, "balances of missing scount", err, db.ErrNoRows)
+	// deletion
+	check(t, "trash", expenses.DeleteOne(ctx, &db.ExpenseId{Sid: "s1", Eid: "e1"}), nil)
+	check(t, "trash again", expenses.DeleteOne(ctx, &db.ExpenseId{Sid: "s1", Eid: "e1"}), db.ErrNoRows)
+	_, err = expenses.FindOne(ctx, &db.ExpenseId{Sid: "s1", Eid: "e1"})
+	check(t, "find trashed", err, db.ErrNoRows)
+	err = expenses.UpdateOne(ctx, &db.ExpenseId{Sid: "s1", Eid: "e1"}, &db.ExpenseUpdater{Title: "Lunch"})
+	check(t, "update trashed", err, db.ErrNoRows)
+	expenseList, err = expenses.Find(ctx, &db.ExpenseFilter{Sid: "s1", Trash: true}, nil)
+	found, _ = collect(t, "find in trash", expenseList, err)
+	equal(t, "find in trash", keys(found, "eid"), []any{"e1"})
+	balances, err = store.Scounts.Balances(ctx, "s1")
+	check(t, "balances without trash", err, nil)
+	if b := balances[1]; b.Uid != "u2" || b.Paid != euros(1000) || b.Owed != euros(500) {
+		t.Fatalf("balances without trash: got %+v", b)
+	}
+	check(t, "restore", expenses.Restore(ctx, &db.ExpenseId{Sid: "s1", Eid: "e1"}), nil)
+	check(t, "restore again", expenses.Restore(ctx, &db.ExpenseId{Sid: "s1", Eid: "e1"}), db.ErrNoRows)
+	_, err = expenses.FindOne(ctx, &db.ExpenseId{Sid: "s1", Eid: "e1"})
+	check(t, "find restored", err, nil)
+	check(t, "trash", expenses.DeleteOne(ctx, &db.ExpenseId{Sid: "s1", Eid: "e1"}), nil)
+	n, err := expenses.Purge(ctx, time.Now().Add(time.Second))
+	check(t, "purge", err, nil)
+	if n != 1 {
+		t.Fatalf("purge: purged %d", n)
+	}
+	check(t, "restore purged", expenses.Restore(ctx, &db.ExpenseId{Sid: "s1", Eid: "e1"}), db.ErrNoRows)
+}
+
+func testSettlements(t *testing.T, store *db.Store) {
+	ctx := seed(t, store)
+	settlements := store.Settlements
+	err := settlements.Insert(ctx, settlement("s1", "t1", "u1", "u1", 1000))
+	check(t, "insert to self", err, db.ErrConflict)
+	err = settlements.Insert(ctx, settlement("s1", "t1", "u1", "u3", 1000))
+	check(t, "insert to non member", err, db.ErrConflict)
+	err = settlements.Insert(ctx,
+		settlement("s1", "t1", "u1", "u2", 1000),
+		settlement("s1", "t2", "u2", "u1", 500),
+	)
+	check(t, "insert", err, nil)
+	err = settlements.Insert(ctx, settlement("s1", "t1", "u1", "u2", 1000))
+	check(t, "insert duplicate", err, db.ErrConflict)
+	s, err := settlements.FindOne(ctx, &db.SettlementId{Sid: "s1", Stid: "t2"})
+	check(t, "find", err, nil)
+	if s.Payer != "u2" || s.Payee != "u1" || s.Amount != euros(500) || s.Rate.Decimal() != "1" {
+		t.Fatalf("find: got %+v", s)
+	}
+	settlementList, err := settlements.Find(ctx, &db.SettlementFilter{Payee: "u2"}, nil)
+	found, _ := collect(t, "find by payee", settlementList, err)
+	equal(t, "find by payee", keys(found, "stid"), []any{"t1"})
+	settlementList, err = settlements.Find(ctx, &db.SettlementFilter{Member: "u2"}, nil)
+	found, _ = collect(t, "find by member", settlementList, err)
+	equal(t, "find by member", keys(found, "stid"), []any{"t1", "t2"})
+	err = settlements.UpdateOne(ctx, &db.SettlementId{Sid: "s1", Stid: "t1"}, &db.SettlementUpdater{})
+	check(t, "update", err, errors.ErrUnsupported)
+	check(t, "delete", settlements.DeleteOne(ctx, &db.SettlementId{Sid: "s1", Stid: "t1"}), nil)
+	check(t, "delete again", settlements.DeleteOne(ctx, &db.SettlementId{Sid: "s1", Stid: "t1"}), db.ErrNoRows)
+}
+
+func testInvites(t *testing.T, store *db.Store) {
+	ctx := seed(t, store)
+	invites := store.Invites
+	later := time.Now().Add(time.Hour).Truncate(time.Second)
+	err := store.Members.Insert(ctx, db.Member{Sid: "s1", Uid: "g1", Name: "Dave", Guest: true})
+	check(t, "insert guest", err, nil)
+	err = invites.Insert(ctx, db.Invite{Iid: "i1", Sid: "s1", Creator: "u1", Role: db.RoleOwner, Expires: later})
+	check(t, "insert owner invite", err, db.ErrConflict)
+	err = invites.Insert(ctx, db.Invite{Iid: "i1", Sid: "s1", Creator: "u1", Guest: "g1", Expires: later})
+	check(t, "insert guest invite for many", err, db.ErrConflict)
+	err = invites.Insert(ctx,
+		db.Invite{Iid: "i1", Sid: "s1", Creator: "u1", Expires: later},
+		db.Invite{Iid: "i2", Sid: "s1", Creator: "u2", Guest: "g1", Expires: later, SingleUse: true},
+		db.Invite{Iid: "i3", Sid: "s1", Creator: "u1", Expires: time.Now().Add(-time.Hour)},
+	)
+	check(t, "insert", err, nil)
+	i, err := invites.FindOne(ctx, &db.InviteId{Iid: "i1"})
+	check(t, "find", err, nil)
+	if i.Role != db.RoleMember || !i.Expires.Equal(later) || i.Uses != 0 {
+		t.Fatalf("find: got %+v", i)
+	}
+	_, err = invites.FindOne(ctx, &db.InviteId{Sid: "s2", Iid: "i1"})
+	check(t, "find in other scount", err, db.ErrNoRows)
+	inviteList, err := invites.Find(ctx, &db.InviteFilter{Sid: "s1", Creator: "u1"}, nil)
+	found, _ := collect(t, "find by creator", inviteList, err)
+	equal(t, "find by creator", keys(found, "iid"), []any{"i1", "i3"})
+	// uses
+	check(t, "use", invites.Use(ctx, &db.InviteId{Iid: "i1"}), nil)
+	check(t, "use again", invites.Use(ctx, &db.InviteId{Iid: "i1"}), nil)
+	check(t, "use single", invites.Use(ctx, &db.InviteId{Iid: "i2"}), nil)
+	check(t, "use single again", invites.Use(ctx, &db.InviteId{Iid: "i2"}), db.ErrConflict)
+	check(t, "use expired", invites.Use(ctx, &db.InviteId{Iid: "i3"}), db.ErrConflict)
+	check(t, "use missing", invites.Use(ctx, &db.InviteId{Iid: "i9"}), db.ErrNoRows)
+	i, err = invites.FindOne(ctx, &db.InviteId{Iid: "i1"})
+	check(t, "find used", err, nil)
+	if i.Uses != 2 {
+		t.Fatalf("find used: got %d uses", i.Uses)
+	}
+	// deletion
+	check(t, "delete in other scount", invites.DeleteOne(ctx, &db.InviteId{Sid: "s2", Iid: "i1"}), db.ErrNoRows)
+	check(t, "delete", invites.DeleteOne(ctx, &db.InviteId{Sid: "s1", Iid: "i1"}), nil)
+	check(t, "delete again", invites.DeleteOne(ctx, &db.InviteId{Iid: "i1"}), db.ErrNoRows)
+	// invites for claiming a guest go along with it
+	check(t, "delete guest", store.Members.DeleteOne(ctx, &db.MemberId{Sid: "s1", Uid: "g1"}), nil)
+	_, err = invites.FindOne(ctx, &db.InviteId{Iid: "i2"})
+	check(t, "find guest invite", err, db.ErrNoRows)
+}
+
+func testActivities(t *testing.T, store *db.Store) {
+	ctx := seed(t, store)
+	activities := store.Activities
+	now := time.Now().Truncate(time.Second)
+	err := activities.Insert(ctx, db.Activity{Aid: "a1", Sid: "s9", Actor: "u1", Kind: db.ActivityScountCreated, Time: now})
+	check(t, "insert into missing scount", err, db.ErrConflict)
+	err = activities.Insert(ctx,
+		db.Activity{
+			Aid: "a1", Sid: "s1", Actor: "u1", Kind: db.ActivityScountCreated, Target: "s1",
+			Time: now, After: json.RawMessage(`{"title":"Trip"}`),
+		},
+		db.Activity{
+			Aid: "a2", Sid: "s1", Actor: "u1", Kind: db.ActivityScountUpdated, Target: "s1",
+			Time:   now.Add(time.Second),
+			Before: json.RawMessage(`{"title":"Trip"}`), After: json.RawMessage(`{"title":"Road trip"}`),
+		},
+		db.Activity{Aid: "a3", Sid: "s1", Actor: "u2", Kind: db.ActivityMemberRemoved, Target: "u2", Time: now.Add(2 * time.Second)},
+	)
+	check(t, "insert", err, nil)
+	err = activities.Insert(ctx, db.Activity{Aid: "a1", Sid: "s1", Actor: "u1", Kind: db.ActivityScountCreated, Time: now})
+	check(t, "insert duplicate", err, db.ErrConflict)
+	a, err := activities.FindOne(ctx, &db.ActivityId{Sid: "s1", Aid: "a2"})
+	check(t, "find", err, nil)
+	if a.Kind != db.ActivityScountUpdated || !a.Time.Equal(now.Add(time.Second)) ||
+		compact(a.Before) != `{"title":"Trip"}` || compact(a.After) != `{"title":"Road trip"}` {
+		t.Fatalf("find: got %+v", a)
+	}
+	a, err = activities.FindOne(ctx, &db.ActivityId{Sid: "s1", Aid: "a3"})
+	check(t, "find without values", err, nil)
+	if a.Before != nil || a.After != nil {
+		t.Fatalf("find without values: got %+v", a)
+	}
+	_, err = activities.FindOne(ctx, &db.ActivityId{Sid: "s2", Aid: "a1"})
+	check(t, "find in other scount", err, db.ErrNoRows)
+	// newest first, paged by keyset
+	order := []db.Sorter{{Column: "time", Desc: true}}
+	activityList, err := activities.Find(ctx, &db.ActivityFilter{Sid: "s1"}, &db.Projector{Order: order})
+	found, _ := collect(t, "find newest first", activityList, err)
+	equal(t, "find newest first", keys(found, "aid"), []any{"a3", "a2", "a1"})
+	after := db.KeysetOf(found[0], db.KeysetOrder(order, db.ActivityKeyCols))
+	activityList, err = activities.Find(ctx, &db.ActivityFilter{Sid: "s1"}, &db.Projector{
+		Order:  order,
+		Paging: &db.Paging{Limit: 1, After: after},
+	})
+	found, _ = collect(t, "find after", activityList, err)
+	equal(t, "find after", keys(found, "aid"), []any{"a2"})
+	activityList, err = activities.Find(ctx, &db.ActivityFilter{Sid: "s1", Actor: "u1", Kind: db.ActivityScountCreated}, nil)
+	found, _ = collect(t, "find by actor and kind", activityList, err)
+	equal(t, "find by actor and kind", keys(found, "aid"), []any{"a1"})
+	// append-only
+	err = activities.UpdateOne(ctx, &db.ActivityId{Sid: "s1", Aid: "a1"}, &db.ActivityUpdater{})
+	check(t, "update", err, errors.ErrUnsupported)
+	check(t, "delete", activities.DeleteOne(ctx, &db.ActivityId{Sid: "s1", Aid: "a1"}), errors.ErrUnsupported)
+	// activities go along with the scount
+	check(t, "trash scount", store.Scounts.DeleteOne(ctx, &db.ScountId{Sid: "s1"}), nil)
+	_, err = store.Scounts.Purge(ctx, time.Now().Add(time.Second))
+	check(t, "purge scount", err, nil)
+	_, err = activities.FindOne(ctx, &db.ActivityId{Sid: "s1", Aid: "a1"})
+	check(t, "find purged", err, db.ErrNoRows)
+}
+
+// compact gives value as compact JSON text, since stores may keep JSON
+// in a form of their own.
+func compact(value json.RawMessage) string {
+	var buffer bytes.Buffer
+	if json.Compact(&buffer, value) != nil {
+		return string(value)
+	}
+	return buffer.String()
+}
+
+func testPaging(t *testing.T, store *db.Store) {
+	ctx := seed(t, store)
+	expenses := store.Expenses
+	err := expenses.Insert(ctx,
+		expense("s1", "e1", "u1", "A", 300, "u1"),
+		expense("s1", "e2", "u1", "B", 100, "u1"),
+		expense("s1", "e3", "u1", "C", 300, "u1"),
+		expense("s1", "e4", "u1", "D", 200, "u1"),
+		expense("s1", "e5", "u1", "E", 500, "u1"),
+	)
+	check(t, "insert", err, nil)
+	filter := &db.ExpenseFilter{Sid: "s1"}
+	// amount descending, ties broken by the key columns
+	order := []db.Sorter{{Column: "amount", Desc: true}}
+	all := []any{"e5", "e1", "e3", "e4", "e2"}
+	expenseList, err := expenses.Find(ctx, filter, &db.Projector{Order: order})
+	found, total := collect(t, "find sorted", expenseList, err)
+	equal(t, "find sorted", keys(found, "eid"), all)
+	if total != -1 {
+		t.Fatalf("find sorted: got total %d, want -1", total)
+	}
+	// offset
+	expenseList, err = expenses.Find(ctx, filter, &db.Projector{
+		Order:  order,
+		Paging: &db.Paging{Limit: 2, Offset: 2},
+		Count:  true,
+	})
+	found, total = collect(t, "find by offset", expenseList, err)
+	equal(t, "find by offset", keys(found, "eid"), all[2:4])
+	if total != 5 {
+		t.Fatalf("find by offset: got total %d, want 5", total)
+	}
+	// keysets
+	keyed := db.KeysetOrder(order, db.ExpenseKeyCols)
+	after := db.KeysetOf(expense("s1", "e1", "u1", "A", 300), keyed)
+	expenseList, err = expenses.Find(ctx, filter, &db.Projector{
+		Order:  order,
+		Paging: &db.Paging{Limit: 2, After: after},
+	})
+	found, _ = collect(t, "find after", expenseList, err)
+	equal(t, "find after", keys(found, "eid"), all[2:4])
+	before := db.KeysetOf(expense("s1", "e4", "u1", "D", 200), keyed)
+	expenseList, err = expenses.Find(ctx, filter, &db.Projector{
+		Order:  order,
+		Paging: &db.Paging{Limit: 2, Before: before},
+	})
+	found, _ = collect(t, "find before", expenseList, err)
+	equal(t, "find before", keys(found, "eid"), all[1:3])
+	// invalid projections
+	_, err = expenses.Find(ctx, filter, &db.Projector{Order: []db.Sorter{{Column: "rate"}}})
+	check(t, "find sorted on invalid column", err, db.ErrInvalidColumn)
+	_, err = expenses.Find(ctx, filter, &db.Projector{
+		Order:  order,
+		Paging: &db.Paging{Limit: 2, After: db.Keyset{int64(300)}},
+	})
+	check(t, "find after partial keyset", err, db.ErrInvalidData)
+}
+
+func testTx(t *testing.T, store *db.Store) {
+	ctx := seed(t, store)
+	// commit
+	err := store.WithTx(ctx, func(tx *db.Store) error {
+		err := tx.Scounts.Insert(ctx, db.Scount{Sid: "s2", Owner: "u2", Title: "Flat", Currency: "EUR"})
+		if err != nil {
+			return err
+		}
+		err = tx.Members.Insert(ctx, db.Member{Sid: "s2", Uid: "u3"})
+		if err != nil {
+			return err
+		}
+		return tx.Expenses.Insert(ctx, expense("s2", "e1", "u3", "Rent", 2000, "u2", "u3"))
+	})
+	check(t, "commit", err, nil)
+	_, err = store.Expenses.FindOne(ctx, &db.ExpenseId{Sid: "s2", Eid: "e1"})
+	check(t, "find committed", err, nil)
+	// rollback
+	errAbort := errors.New("abort")
+	err = store.WithTx(ctx, func(tx *db.Store) error {
+		err := tx.Scounts.Insert(ctx, db.Scount{Sid: "s3", Owner: "u3", Title: "Gym", Currency: "EUR"})
+		if err != nil {
+			return err
+		}
+		_, err = tx.Scounts.FindOne(ctx, &db.ScountId{Sid: "s3"})
+		if err != nil {
+			return err
+		}
+		return errAbort
+	})
+	check(t, "rollback", err, errAbort)
+	_, err = store.Scounts.FindOne(ctx, &db.ScountId{Sid: "s3"})
+	check(t, "find rolled back", err, db.ErrNoRows)
+	_, err = store.Members.FindOne(ctx, &db.MemberId{Sid: "s3", Uid: "u3"})
+	check(t, "find rolled back owner", err, db.ErrNoRows)
+	// nested rollback
+	err = store.WithTx(ctx, func(tx *db.Store) error {
+		err := tx.WithTx(ctx, func(tx *db.Store) error {
+			err := tx.Members.Insert(ctx, db.Member{Sid: "s1", Uid: "u3"})
+			if err != nil {
+				return err
+			}
+			return tx.Members.Insert(ctx, db.Member{Sid: "s1", Uid: "u2"})
+		})
+		check(t, "nested conflict", err, db.ErrConflict)
+		return tx.Settlements.Insert(ctx, settlement("s1", "t1", "u2", "u1", 500))
+	})
+	check(t, "commit after nested rollback", err, nil)
+	_, err = store.Members.FindOne(ctx, &db.MemberId{Sid: "s1", Uid: "u3"})
+	check(t, "find nested rolled back", err, db.ErrNoRows)
+	_, err = store.Settlements.FindOne(ctx, &db.SettlementId{Sid: "s1", Stid: "t1"})
+	check(t, "find committed after nested", err, nil)
+}
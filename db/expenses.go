@@ -0,0 +1,100 @@
+package db
+
+import (
+	"time"
+
+	"github.com/manojnakp/scount/money"
+)
+
+// SplitMode defines how the amount of an expense is shared among members.
+type SplitMode string
+
+// Supported split modes for expenses.
+const (
+	SplitEqual   SplitMode = "equal"   // equally among chosen members
+	SplitExact   SplitMode = "exact"   // exact amounts per member
+	SplitPercent SplitMode = "percent" // percentages per member
+	SplitShares  SplitMode = "shares"  // weighted shares per member
+)
+
+// Expense depicts the expense object for interactions with the expenses datastore.
+// Base is the Amount converted into the currency of the scount at Rate,
+// both recorded when the expense is added so that balances stay
+// reproducible. Deleted is the time the expense was moved to the trash,
+// zero if not.
+type Expense struct {
+	Eid     string // id
+	Sid     string // scount to which expense belongs
+	Payer   string // member who paid
+	Title   string
+	Amount  money.Amount
+	Rate    money.Rate
+	Base    money.Amount
+	Mode    SplitMode
+	Shares  []Share // sorted by uid
+	Deleted time.Time
+}
+
+// Share is the portion of an expense owed by a member. Weight is the
+// requested value as per the split mode (minor units in exact mode),
+// whereas Amount is the resolved amount owed in currency of the expense.
+// Base is the portion of the Base of the expense owed by the member.
+type Share struct {
+	Uid    string
+	Weight int64
+	Amount money.Amount
+	Base   money.Amount
+}
+
+// ExpenseId is the 'id' type for expense collection. Both sid and eid
+// determine an expense uniquely.
+type ExpenseId struct {
+	Sid string
+	Eid string
+}
+
+// ExpenseFilter provides fields for filtering the expenses. Expenses in
+// the trash are matched only if Trash, and the others only if not.
+type ExpenseFilter struct {
+	Sid   string
+	Eid   string
+	Payer string
+	Title string
+	Trash bool
+}
+
+// ExpenseUpdater provides fields for updating expenses. Shares are
+// replaced altogether when non-nil. Zero Amount is left untouched,
+// otherwise Rate and Base are updated along with it.
+type ExpenseUpdater struct {
+	Payer  string
+	Title  string
+	Amount money.Amount
+	Rate   money.Rate
+	Base   money.Amount
+	Mode   SplitMode
+	Shares []Share
+}
+
+// ExpenseAllowedCols is a list of columns allowed for sorting.
+var ExpenseAllowedCols = []Column{"sid", "eid", "payer", "title", "amount"}
+
+// ExpenseKeyCols is a list of columns that identify an expense uniquely.
+var ExpenseKeyCols = []Column{"sid", "eid"}
+
+// Key implements Keyed on Expense.
+func (e Expense) Key(c Column) any {
+	switch c {
+	case "sid":
+		return e.Sid
+	case "eid":
+		return e.Eid
+	case "payer":
+		return e.Payer
+	case "title":
+		return e.Title
+	case "amount":
+		return e.Amount.Minor
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package db
+
+import "time"
+
+// Invite depicts the invitation object for interactions with the invites
+// datastore. An invite lets any user join scount Sid with Role until it
+// expires. Single use invites cannot be used more than once. Invites for
+// a Guest member let the user claim the guest, and are single use.
+type Invite struct {
+	Iid       string    // id
+	Sid       string    // scount to join
+	Creator   string    // member who created the invite
+	Role      Role      // role of the joining member
+	Guest     string    // guest member to be claimed, if any
+	Expires   time.Time // invite not usable after
+	SingleUse bool      // usable only once
+	Uses      int       // number of times used
+}
+
+// Usable reports whether the invite can still be used at time t.
+func (i Invite) Usable(t time.Time) bool {
+	return t.Before(i.Expires) && !(i.SingleUse && i.Uses > 0)
+}
+
+// InviteId is the 'id' type for invite collection. Iid determines an
+// invite uniquely, Sid (if non-empty) restricts it to the scount.
+type InviteId struct {
+	Sid string
+	Iid string
+}
+
+// InviteFilter provides fields for filtering the invites.
+type InviteFilter struct {
+	Sid     string
+	Iid     string
+	Creator string
+}
+
+// InviteUpdater provides fields necessary for update operation for
+// invite record.
+type InviteUpdater struct{}
+
+// InviteAllowedCols is a list of columns allowed for sorting.
+var InviteAllowedCols = []Column{"iid", "creator", "expires"}
+
+// InviteKeyCols is a list of columns that identify an invite uniquely.
+var InviteKeyCols = []Column{"iid"}
+
+// Key implements Keyed on Invite.
+func (i Invite) Key(c Column) any {
+	switch c {
+	case "iid":
+		return i.Iid
+	case "creator":
+		return i.Creator
+	case "expires":
+		return i.Expires
+	}
+	return nil
+}
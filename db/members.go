@@ -1,21 +1,71 @@
 package db
 
+// Role is the role of a member within a scount.
+type Role string
+
+// Supported member roles, from the most to the least privileged.
+const (
+	RoleOwner  Role = "owner"  // exactly one per scount
+	RoleAdmin  Role = "admin"  // manages members and the scount
+	RoleMember Role = "member" // adds expenses
+	RoleViewer Role = "viewer" // read-only
+)
+
+// Valid reports whether r is one of the supported roles.
+func (r Role) Valid() bool {
+	switch r {
+	case RoleOwner, RoleAdmin, RoleMember, RoleViewer:
+		return true
+	}
+	return false
+}
+
 // Member depicts the member object for interactions with the members datastore.
+// Guest members are placeholders without a user account, Uid being an id
+// of their own and Name their display name. A guest cannot be the owner.
 type Member struct {
-	Sid string
-	Uid string
+	Sid   string
+	Uid   string
+	Role  Role
+	Name  string // display name of guest
+	Guest bool   // no user account
 }
 
 // MemberId is the 'id' type for member collection. Both sid and uid determine
 // a member uniquely.
-type MemberId Member
+type MemberId struct {
+	Sid string
+	Uid string
+}
 
 // MemberFilter provides fields for filtering the members.
-type MemberFilter Member
+type MemberFilter struct {
+	Sid  string
+	Uid  string
+	Role Role
+}
 
 // MemberUpdater provides fields necessary for update operation for
 // member record.
-type MemberUpdater struct{}
+type MemberUpdater struct {
+	Role Role
+}
 
 // MemberAllowedCols is a list of columns allowed for sorting.
-var MemberAllowedCols = []Column{"sid", "uid"}
+var MemberAllowedCols = []Column{"sid", "uid", "role"}
+
+// MemberKeyCols is a list of columns that identify a member uniquely.
+var MemberKeyCols = []Column{"sid", "uid"}
+
+// Key implements Keyed on Member.
+func (m Member) Key(c Column) any {
+	switch c {
+	case "sid":
+		return m.Sid
+	case "uid":
+		return m.Uid
+	case "role":
+		return string(m.Role)
+	}
+	return nil
+}
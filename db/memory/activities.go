@@ -0,0 +1,121 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+
+	"github.com/manojnakp/scount/db"
+)
+
+// ActivityCollection provides a convenient way to interact with
+// activities in the in-memory database.
+type ActivityCollection struct {
+	DB *Database
+}
+
+// Insert adds one or more activities to colln. db.ErrNoRows if no
+// activities to insert. Activities are inserted all or none.
+func (colln ActivityCollection) Insert(_ context.Context, activities ...db.Activity) error {
+	if len(activities) == 0 {
+		return db.ErrNoRows
+	}
+	colln.DB.mu.Lock()
+	defer colln.DB.mu.Unlock()
+	for i, a := range activities {
+		err := colln.check(a)
+		if err != nil {
+			// rollback
+			for _, a := range activities[:i] {
+				delete(colln.DB.activities, a.Aid)
+			}
+			return err
+		}
+		colln.DB.activities[a.Aid] = copyActivity(a)
+	}
+	return nil
+}
+
+// check checks the constraints on inserting a, with DB locked.
+func (colln ActivityCollection) check(a db.Activity) error {
+	if _, ok := colln.DB.activities[a.Aid]; ok {
+		return conflict("duplicate activity %q", a.Aid)
+	}
+	if _, ok := colln.DB.scounts[a.Sid]; !ok {
+		return conflict("scount %q not found", a.Sid)
+	}
+	for _, value := range []json.RawMessage{a.Before, a.After} {
+		if len(value) != 0 && !json.Valid(value) {
+			return conflict("invalid json %q", value)
+		}
+	}
+	return nil
+}
+
+// copyActivity gives a deep copy of a, empty values as nil.
+func copyActivity(a db.Activity) db.Activity {
+	for _, value := range []*json.RawMessage{&a.Before, &a.After} {
+		if len(*value) == 0 {
+			*value = nil
+			continue
+		}
+		*value = slices.Clone(*value)
+	}
+	return a
+}
+
+// DeleteOne is not supported on activities.
+func (colln ActivityCollection) DeleteOne(context.Context, *db.ActivityId) error {
+	return errors.ErrUnsupported
+}
+
+// UpdateOne is not supported on activities.
+func (colln ActivityCollection) UpdateOne(context.Context, *db.ActivityId, *db.ActivityUpdater) error {
+	return errors.ErrUnsupported
+}
+
+// FindOne fetches activity from colln by id.
+func (colln ActivityCollection) FindOne(_ context.Context, id *db.ActivityId) (db.Activity, error) {
+	if id == nil {
+		return db.Activity{}, db.ErrNil
+	}
+	colln.DB.mu.RLock()
+	defer colln.DB.mu.RUnlock()
+	a, ok := colln.DB.activities[id.Aid]
+	if !ok || a.Sid != id.Sid {
+		return db.Activity{}, db.ErrNoRows
+	}
+	return copyActivity(a), nil
+}
+
+// Find fetches all the activities from colln subject to filter and
+// projection options specified.
+func (colln ActivityCollection) Find(
+	_ context.Context,
+	filter *db.ActivityFilter,
+	projector *db.Projector,
+) (*db.Iterable[db.Activity], error) {
+	if filter == nil {
+		filter = new(db.ActivityFilter)
+	}
+	return find(colln.DB, colln.rows, func(a db.Activity) bool {
+		return (filter.Sid == "" || a.Sid == filter.Sid) &&
+			(filter.Aid == "" || a.Aid == filter.Aid) &&
+			(filter.Actor == "" || a.Actor == filter.Actor) &&
+			(filter.Kind == "" || a.Kind == filter.Kind) &&
+			(filter.Target == "" || a.Target == filter.Target)
+	}, projector, db.ActivityAllowedCols, db.ActivityKeyCols)
+}
+
+// rows gives copies of all the activities, with DB locked.
+func (colln ActivityCollection) rows() []db.Activity {
+	activities := make([]db.Activity, 0, len(colln.DB.activities))
+	for _, a := range colln.DB.activities {
+		activities = append(activities, copyActivity(a))
+	}
+	return activities
+}
+
+// compile-time assertion
+var _ db.Collection[db.Activity, db.ActivityFilter, db.ActivityUpdater, db.ActivityId] = ActivityCollection{}
@@ -0,0 +1,251 @@
+package memory
+
+import (
+	"context"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/manojnakp/scount/db"
+)
+
+// ExpenseCollection provides a convenient way to interact with expenses
+// in the in-memory database.
+type ExpenseCollection struct {
+	DB *Database
+}
+
+// Insert adds one or more expenses along with their shares to colln.
+// db.ErrNoRows if no expenses to insert. Expenses are inserted all or none.
+func (colln ExpenseCollection) Insert(_ context.Context, expenses ...db.Expense) error {
+	if len(expenses) == 0 {
+		return db.ErrNoRows
+	}
+	colln.DB.mu.Lock()
+	defer colln.DB.mu.Unlock()
+	for i, e := range expenses {
+		err := colln.check(e)
+		if err != nil {
+			// rollback
+			for _, e := range expenses[:i] {
+				delete(colln.DB.expenses, db.ExpenseId{Sid: e.Sid, Eid: e.Eid})
+			}
+			return err
+		}
+		e.Deleted = time.Time{}
+		colln.DB.expenses[db.ExpenseId{Sid: e.Sid, Eid: e.Eid}] = copyExpense(e)
+	}
+	return nil
+}
+
+// check checks the constraints on inserting e, with DB locked.
+func (colln ExpenseCollection) check(e db.Expense) error {
+	if _, ok := colln.DB.scounts[e.Sid]; !ok {
+		return conflict("scount %q not found", e.Sid)
+	}
+	if _, ok := colln.DB.expenses[db.ExpenseId{Sid: e.Sid, Eid: e.Eid}]; ok {
+		return conflict("duplicate expense %q of scount %q", e.Eid, e.Sid)
+	}
+	return colln.checkFields(e)
+}
+
+// checkFields checks the constraints on the fields of e, with DB locked.
+func (colln ExpenseCollection) checkFields(e db.Expense) error {
+	if _, ok := colln.DB.members[db.MemberId{Sid: e.Sid, Uid: e.Payer}]; !ok {
+		return conflict("payer %q not a member", e.Payer)
+	}
+	if e.Amount.Minor <= 0 || e.Base.Minor < 0 {
+		return conflict("invalid amount %s", e.Amount)
+	}
+	for _, err := range []error{
+		checkCurrency(e.Amount.Currency),
+		checkCurrency(e.Base.Currency),
+		checkRate(e.Rate),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	switch e.Mode {
+	case db.SplitEqual, db.SplitExact, db.SplitPercent, db.SplitShares:
+	default:
+		return conflict("invalid split mode %q", e.Mode)
+	}
+	seen := make(map[string]bool, len(e.Shares))
+	for _, s := range e.Shares {
+		if _, ok := colln.DB.members[db.MemberId{Sid: e.Sid, Uid: s.Uid}]; !ok {
+			return conflict("share of %q not a member", s.Uid)
+		}
+		if seen[s.Uid] {
+			return conflict("duplicate share of %q", s.Uid)
+		}
+		seen[s.Uid] = true
+		if s.Weight < 0 || s.Amount.Minor < 0 || s.Base.Minor < 0 {
+			return conflict("negative share of %q", s.Uid)
+		}
+	}
+	return nil
+}
+
+// copyExpense gives a deep copy of e, shares sorted by uid and rate
+// between the currencies of amount and base.
+func copyExpense(e db.Expense) db.Expense {
+	e.Shares = slices.Clone(e.Shares)
+	if e.Shares == nil {
+		e.Shares = make([]db.Share, 0)
+	}
+	slices.SortFunc(e.Shares, func(a, b db.Share) int {
+		return strings.Compare(a.Uid, b.Uid)
+	})
+	for i := range e.Shares {
+		e.Shares[i].Amount.Currency = e.Amount.Currency
+		e.Shares[i].Base.Currency = e.Base.Currency
+	}
+	if e.Rate.Ratio != nil {
+		e.Rate.Ratio = new(big.Rat).Set(e.Rate.Ratio)
+	}
+	e.Rate.From = e.Amount.Currency
+	e.Rate.To = e.Base.Currency
+	return e
+}
+
+// DeleteOne moves exactly 1 expense from colln to the trash based on id.
+func (colln ExpenseCollection) DeleteOne(_ context.Context, id *db.ExpenseId) error {
+	if id == nil {
+		return db.ErrNil
+	}
+	colln.DB.mu.Lock()
+	defer colln.DB.mu.Unlock()
+	e, ok := colln.DB.expenses[*id]
+	if !ok || !e.Deleted.IsZero() {
+		return db.ErrNoRows
+	}
+	e.Deleted = time.Now()
+	colln.DB.expenses[*id] = e
+	return nil
+}
+
+// Restore moves exactly 1 expense from the trash back to colln based on
+// id.
+func (colln ExpenseCollection) Restore(_ context.Context, id *db.ExpenseId) error {
+	if id == nil {
+		return db.ErrNil
+	}
+	colln.DB.mu.Lock()
+	defer colln.DB.mu.Unlock()
+	e, ok := colln.DB.expenses[*id]
+	if !ok || e.Deleted.IsZero() {
+		return db.ErrNoRows
+	}
+	e.Deleted = time.Time{}
+	colln.DB.expenses[*id] = e
+	return nil
+}
+
+// Purge removes the expenses moved to the trash before the given time
+// for good, along with their shares.
+func (colln ExpenseCollection) Purge(_ context.Context, before time.Time) (int, error) {
+	colln.DB.mu.Lock()
+	defer colln.DB.mu.Unlock()
+	count := 0
+	for eid, e := range colln.DB.expenses {
+		if !e.Deleted.IsZero() && e.Deleted.Before(before) {
+			delete(colln.DB.expenses, eid)
+			count++
+		}
+	}
+	return count, nil
+}
+
+// UpdateOne modifies exactly 1 expense from colln. Shares are replaced
+// altogether when non-nil.
+func (colln ExpenseCollection) UpdateOne(
+	_ context.Context,
+	id *db.ExpenseId,
+	setter *db.ExpenseUpdater,
+) error {
+	if id == nil {
+		return db.ErrNil
+	}
+	if setter == nil {
+		setter = new(db.ExpenseUpdater)
+	}
+	colln.DB.mu.Lock()
+	defer colln.DB.mu.Unlock()
+	e, ok := colln.DB.expenses[*id]
+	if !ok || !e.Deleted.IsZero() {
+		return db.ErrNoRows
+	}
+	if setter.Payer != "" {
+		e.Payer = setter.Payer
+	}
+	if setter.Title != "" {
+		e.Title = setter.Title
+	}
+	if !setter.Amount.IsZero() {
+		e.Amount = setter.Amount
+		e.Rate = setter.Rate
+		e.Base = setter.Base
+	}
+	if setter.Mode != "" {
+		e.Mode = setter.Mode
+	}
+	if setter.Shares != nil {
+		e.Shares = setter.Shares
+	}
+	err := colln.checkFields(e)
+	if err != nil {
+		return err
+	}
+	colln.DB.expenses[*id] = copyExpense(e)
+	return nil
+}
+
+// FindOne fetches expense along with its shares from colln by id.
+func (colln ExpenseCollection) FindOne(_ context.Context, id *db.ExpenseId) (db.Expense, error) {
+	if id == nil {
+		return db.Expense{}, db.ErrNil
+	}
+	colln.DB.mu.RLock()
+	defer colln.DB.mu.RUnlock()
+	e, ok := colln.DB.expenses[*id]
+	if !ok || !e.Deleted.IsZero() {
+		return db.Expense{}, db.ErrNoRows
+	}
+	return copyExpense(e), nil
+}
+
+// Find fetches all the expenses along with their shares from colln
+// subject to filter and projector options specified.
+func (colln ExpenseCollection) Find(
+	_ context.Context,
+	filter *db.ExpenseFilter,
+	projector *db.Projector,
+) (*db.Iterable[db.Expense], error) {
+	if filter == nil {
+		filter = new(db.ExpenseFilter)
+	}
+	return find(colln.DB, colln.rows, func(e db.Expense) bool {
+		return (filter.Sid == "" || e.Sid == filter.Sid) &&
+			(filter.Eid == "" || e.Eid == filter.Eid) &&
+			(filter.Payer == "" || e.Payer == filter.Payer) &&
+			(filter.Title == "" || like(filter.Title, e.Title)) &&
+			!e.Deleted.IsZero() == filter.Trash
+	}, projector, db.ExpenseAllowedCols, db.ExpenseKeyCols)
+}
+
+// rows gives copies of all the expenses, with DB locked.
+func (colln ExpenseCollection) rows() []db.Expense {
+	expenses := make([]db.Expense, 0, len(colln.DB.expenses))
+	for _, e := range colln.DB.expenses {
+		expenses = append(expenses, copyExpense(e))
+	}
+	return expenses
+}
+
+// compile-time assertion
+var _ interface {
+	db.Collection[db.Expense, db.ExpenseFilter, db.ExpenseUpdater, db.ExpenseId]
+	db.Trash[db.ExpenseId]
+} = ExpenseCollection{}
@@ -0,0 +1,162 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/manojnakp/scount/db"
+)
+
+// InviteCollection provides a convenient way to interact with invites in
+// the in-memory database.
+type InviteCollection struct {
+	DB *Database
+}
+
+// Insert adds one or more invites to colln, role defaults to member.
+// db.ErrNoRows if no invites to insert. Invites are inserted all or none.
+func (colln InviteCollection) Insert(_ context.Context, invites ...db.Invite) error {
+	if len(invites) == 0 {
+		return db.ErrNoRows
+	}
+	colln.DB.mu.Lock()
+	defer colln.DB.mu.Unlock()
+	for i, invite := range invites {
+		if invite.Role == "" {
+			invite.Role = db.RoleMember
+		}
+		err := colln.check(invite)
+		if err != nil {
+			// rollback
+			for _, invite := range invites[:i] {
+				delete(colln.DB.invites, invite.Iid)
+			}
+			return err
+		}
+		colln.DB.invites[invite.Iid] = invite
+	}
+	return nil
+}
+
+// check checks the constraints on inserting invite, with DB locked.
+func (colln InviteCollection) check(invite db.Invite) error {
+	if _, ok := colln.DB.invites[invite.Iid]; ok {
+		return conflict("duplicate invite %q", invite.Iid)
+	}
+	if _, ok := colln.DB.scounts[invite.Sid]; !ok {
+		return conflict("scount %q not found", invite.Sid)
+	}
+	if _, ok := colln.DB.users[invite.Creator]; !ok {
+		return conflict("creator %q not a user", invite.Creator)
+	}
+	if invite.Guest != "" {
+		if _, ok := colln.DB.members[db.MemberId{Sid: invite.Sid, Uid: invite.Guest}]; !ok {
+			return conflict("guest %q not a member", invite.Guest)
+		}
+		if !invite.SingleUse {
+			return conflict("invite for guest %q not single use", invite.Guest)
+		}
+	}
+	if !invite.Role.Valid() || invite.Role == db.RoleOwner {
+		return conflict("invalid role %q", invite.Role)
+	}
+	if invite.Uses < 0 {
+		return conflict("negative uses %d", invite.Uses)
+	}
+	return nil
+}
+
+// lookup gives the invite by id, with DB locked.
+func (colln InviteCollection) lookup(id *db.InviteId) (db.Invite, bool) {
+	invite, ok := colln.DB.invites[id.Iid]
+	if !ok || (id.Sid != "" && invite.Sid != id.Sid) {
+		return db.Invite{}, false
+	}
+	return invite, true
+}
+
+// DeleteOne removes exactly 1 invite from colln based on matching id.
+func (colln InviteCollection) DeleteOne(_ context.Context, id *db.InviteId) error {
+	if id == nil {
+		return db.ErrNil
+	}
+	colln.DB.mu.Lock()
+	defer colln.DB.mu.Unlock()
+	if _, ok := colln.lookup(id); !ok {
+		return db.ErrNoRows
+	}
+	delete(colln.DB.invites, id.Iid)
+	return nil
+}
+
+// UpdateOne is not supported on invites.
+func (colln InviteCollection) UpdateOne(context.Context, *db.InviteId, *db.InviteUpdater) error {
+	return errors.ErrUnsupported
+}
+
+// Use records a single use of the invite by id in colln. If not found,
+// then db.ErrNoRows. If expired or used up, then db.ErrConflict.
+func (colln InviteCollection) Use(_ context.Context, id *db.InviteId) error {
+	if id == nil {
+		return db.ErrNil
+	}
+	colln.DB.mu.Lock()
+	defer colln.DB.mu.Unlock()
+	invite, ok := colln.lookup(id)
+	if !ok {
+		return db.ErrNoRows
+	}
+	if !invite.Usable(time.Now()) {
+		return db.ErrConflict
+	}
+	invite.Uses++
+	colln.DB.invites[invite.Iid] = invite
+	return nil
+}
+
+// FindOne fetches invite from colln by id.
+func (colln InviteCollection) FindOne(_ context.Context, id *db.InviteId) (db.Invite, error) {
+	if id == nil {
+		return db.Invite{}, db.ErrNil
+	}
+	colln.DB.mu.RLock()
+	defer colln.DB.mu.RUnlock()
+	invite, ok := colln.lookup(id)
+	if !ok {
+		return db.Invite{}, db.ErrNoRows
+	}
+	return invite, nil
+}
+
+// Find fetches all the invites from colln subject to filter and
+// projection options specified.
+func (colln InviteCollection) Find(
+	_ context.Context,
+	filter *db.InviteFilter,
+	projector *db.Projector,
+) (*db.Iterable[db.Invite], error) {
+	if filter == nil {
+		filter = new(db.InviteFilter)
+	}
+	return find(colln.DB, colln.rows, func(i db.Invite) bool {
+		return (filter.Sid == "" || i.Sid == filter.Sid) &&
+			(filter.Iid == "" || i.Iid == filter.Iid) &&
+			(filter.Creator == "" || i.Creator == filter.Creator)
+	}, projector, db.InviteAllowedCols, db.InviteKeyCols)
+}
+
+// rows gives copies of all the invites, with DB locked.
+func (colln InviteCollection) rows() []db.Invite {
+	invites := make([]db.Invite, 0, len(colln.DB.invites))
+	for _, i := range colln.DB.invites {
+		invites = append(invites, i)
+	}
+	return invites
+}
+
+// compile-time assertion
+var _ interface {
+	db.Collection[db.Invite, db.InviteFilter, db.InviteUpdater, db.InviteId]
+	Use(ctx context.Context, id *db.InviteId) error
+} = InviteCollection{}
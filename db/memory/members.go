@@ -0,0 +1,291 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/manojnakp/scount/db"
+)
+
+// MemberCollection provides a convenient way to interact with members in
+// the in-memory database.
+type MemberCollection struct {
+	DB *Database
+}
+
+// Insert adds one or more members to colln, role defaults to member.
+// db.ErrNoRows if no members to insert. Members are inserted all or none.
+func (colln MemberCollection) Insert(_ context.Context, members ...db.Member) error {
+	if len(members) == 0 {
+		return db.ErrNoRows
+	}
+	colln.DB.mu.Lock()
+	defer colln.DB.mu.Unlock()
+	for i, m := range members {
+		if m.Role == "" {
+			m.Role = db.RoleMember
+		}
+		err := colln.check(m)
+		if err != nil {
+			// rollback
+			for _, m := range members[:i] {
+				delete(colln.DB.members, db.MemberId{Sid: m.Sid, Uid: m.Uid})
+			}
+			return err
+		}
+		colln.DB.members[db.MemberId{Sid: m.Sid, Uid: m.Uid}] = m
+	}
+	return nil
+}
+
+// check checks the constraints on inserting m, with DB locked.
+func (colln MemberCollection) check(m db.Member) error {
+	if _, ok := colln.DB.scounts[m.Sid]; !ok {
+		return conflict("scount %q not found", m.Sid)
+	}
+	if _, ok := colln.DB.members[db.MemberId{Sid: m.Sid, Uid: m.Uid}]; ok {
+		return conflict("duplicate member %q of scount %q", m.Uid, m.Sid)
+	}
+	return colln.checkRole(m)
+}
+
+// checkRole checks the constraints on the role of m, with DB locked.
+func (colln MemberCollection) checkRole(m db.Member) error {
+	if !m.Role.Valid() {
+		return conflict("invalid role %q", m.Role)
+	}
+	if m.Guest && m.Name == "" {
+		return conflict("guest %q without name", m.Uid)
+	}
+	if m.Role != db.RoleOwner {
+		return nil
+	}
+	if m.Guest {
+		return conflict("guest %q cannot be owner", m.Uid)
+	}
+	for mid, other := range colln.DB.members {
+		if mid.Sid == m.Sid && mid.Uid != m.Uid && other.Role == db.RoleOwner {
+			return conflict("scount %q already has an owner", m.Sid)
+		}
+	}
+	return nil
+}
+
+// DeleteOne removes exactly 1 member from colln based on id, along with
+// invites for claiming the member. If the member paid or shares in any
+// expense or settlement, then db.ErrConflict.
+func (colln MemberCollection) DeleteOne(_ context.Context, id *db.MemberId) error {
+	if id == nil {
+		return db.ErrNil
+	}
+	colln.DB.mu.Lock()
+	defer colln.DB.mu.Unlock()
+	if _, ok := colln.DB.members[*id]; !ok {
+		return db.ErrNoRows
+	}
+	if colln.referred(*id) {
+		return conflict("member %q of scount %q has expenses or settlements", id.Uid, id.Sid)
+	}
+	colln.delete(*id)
+	return nil
+}
+
+// referred reports whether member id is referred to by any expense,
+// share or settlement, with DB locked.
+func (colln MemberCollection) referred(id db.MemberId) bool {
+	for eid, e := range colln.DB.expenses {
+		if eid.Sid != id.Sid {
+			continue
+		}
+		if e.Payer == id.Uid {
+			return true
+		}
+		for _, share := range e.Shares {
+			if share.Uid == id.Uid {
+				return true
+			}
+		}
+	}
+	for stid, st := range colln.DB.settlements {
+		if stid.Sid == id.Sid && (st.Payer == id.Uid || st.Payee == id.Uid) {
+			return true
+		}
+	}
+	return false
+}
+
+// delete removes member id along with invites for claiming it, with DB
+// locked.
+func (colln MemberCollection) delete(id db.MemberId) {
+	for iid, i := range colln.DB.invites {
+		if i.Sid == id.Sid && i.Guest == id.Uid {
+			delete(colln.DB.invites, iid)
+		}
+	}
+	delete(colln.DB.members, id)
+}
+
+// UpdateOne modifies exactly 1 member from colln.
+func (colln MemberCollection) UpdateOne(
+	_ context.Context,
+	id *db.MemberId,
+	setter *db.MemberUpdater,
+) error {
+	if id == nil {
+		return db.ErrNil
+	}
+	if setter == nil {
+		setter = new(db.MemberUpdater)
+	}
+	colln.DB.mu.Lock()
+	defer colln.DB.mu.Unlock()
+	m, ok := colln.DB.members[*id]
+	if !ok {
+		return db.ErrNoRows
+	}
+	if setter.Role == "" {
+		return nil
+	}
+	m.Role = setter.Role
+	err := colln.checkRole(m)
+	if err != nil {
+		return err
+	}
+	colln.DB.members[*id] = m
+	return nil
+}
+
+// Claim hands over the place of guest member id to the user uid, with
+// the same role. Expenses, shares and settlements of the guest are moved
+// over to the user and the guest is removed.
+func (colln MemberCollection) Claim(_ context.Context, id *db.MemberId, uid string) error {
+	if id == nil {
+		return db.ErrNil
+	}
+	colln.DB.mu.Lock()
+	defer colln.DB.mu.Unlock()
+	guest, ok := colln.DB.members[*id]
+	if !ok || !guest.Guest {
+		return db.ErrNoRows
+	}
+	member := db.MemberId{Sid: id.Sid, Uid: uid}
+	if _, ok = colln.DB.members[member]; ok {
+		return conflict("duplicate member %q of scount %q", uid, id.Sid)
+	}
+	colln.DB.members[member] = db.Member{Sid: id.Sid, Uid: uid, Role: guest.Role}
+	colln.move(id.Sid, id.Uid, uid)
+	colln.delete(*id)
+	return nil
+}
+
+// Leave removes member id, leaving the guest member guest named
+// db.FormerMember in its place along with its expenses, shares and
+// settlements if it has any. If the member is a guest with history,
+// then db.ErrConflict.
+func (colln MemberCollection) Leave(_ context.Context, id *db.MemberId, guest string) error {
+	if id == nil {
+		return db.ErrNil
+	}
+	colln.DB.mu.Lock()
+	defer colln.DB.mu.Unlock()
+	m, ok := colln.DB.members[*id]
+	if !ok {
+		return db.ErrNoRows
+	}
+	if colln.referred(*id) {
+		if m.Guest {
+			return conflict("guest %q of scount %q has expenses or settlements", id.Uid, id.Sid)
+		}
+		former := db.MemberId{Sid: id.Sid, Uid: guest}
+		if _, ok = colln.DB.members[former]; ok {
+			return conflict("duplicate member %q of scount %q", guest, id.Sid)
+		}
+		colln.DB.members[former] = db.Member{
+			Sid:   id.Sid,
+			Uid:   guest,
+			Role:  db.RoleMember,
+			Name:  db.FormerMember,
+			Guest: true,
+		}
+		colln.move(id.Sid, id.Uid, guest)
+	}
+	colln.delete(*id)
+	return nil
+}
+
+// move moves the expenses, shares and settlements of member from of
+// scount sid over to member to, with DB locked.
+func (colln MemberCollection) move(sid, from, to string) {
+	for eid, e := range colln.DB.expenses {
+		if eid.Sid != sid {
+			continue
+		}
+		if e.Payer == from {
+			e.Payer = to
+		}
+		e = copyExpense(e)
+		for i := range e.Shares {
+			if e.Shares[i].Uid == from {
+				e.Shares[i].Uid = to
+			}
+		}
+		colln.DB.expenses[eid] = copyExpense(e)
+	}
+	for stid, st := range colln.DB.settlements {
+		if stid.Sid != sid {
+			continue
+		}
+		if st.Payer == from {
+			st.Payer = to
+		}
+		if st.Payee == from {
+			st.Payee = to
+		}
+		colln.DB.settlements[stid] = st
+	}
+}
+
+// FindOne fetches member from colln by id.
+func (colln MemberCollection) FindOne(_ context.Context, id *db.MemberId) (db.Member, error) {
+	if id == nil {
+		return db.Member{}, db.ErrNil
+	}
+	colln.DB.mu.RLock()
+	defer colln.DB.mu.RUnlock()
+	m, ok := colln.DB.members[*id]
+	if !ok {
+		return db.Member{}, db.ErrNoRows
+	}
+	return m, nil
+}
+
+// Find fetches all the members from colln subject to filter and
+// projector options specified.
+func (colln MemberCollection) Find(
+	_ context.Context,
+	filter *db.MemberFilter,
+	projector *db.Projector,
+) (*db.Iterable[db.Member], error) {
+	if filter == nil {
+		filter = new(db.MemberFilter)
+	}
+	return find(colln.DB, colln.rows, func(m db.Member) bool {
+		return (filter.Sid == "" || m.Sid == filter.Sid) &&
+			(filter.Uid == "" || m.Uid == filter.Uid) &&
+			(filter.Role == "" || m.Role == filter.Role)
+	}, projector, db.MemberAllowedCols, db.MemberKeyCols)
+}
+
+// rows gives copies of all the members, with DB locked.
+func (colln MemberCollection) rows() []db.Member {
+	members := make([]db.Member, 0, len(colln.DB.members))
+	for _, m := range colln.DB.members {
+		members = append(members, m)
+	}
+	return members
+}
+
+// compile-time assertion
+var _ interface {
+	db.Collection[db.Member, db.MemberFilter, db.MemberUpdater, db.MemberId]
+	Claim(ctx context.Context, id *db.MemberId, uid string) error
+} = MemberCollection{}
@@ -0,0 +1,290 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/manojnakp/scount/db"
+	"github.com/manojnakp/scount/money"
+)
+
+// ScountCollection provides a convenient way to interact with scounts in
+// the in-memory database.
+type ScountCollection struct {
+	DB *Database
+}
+
+// Insert adds one or more scounts into colln, along with their owners as
+// members. db.ErrNoRows if empty scounts. Scounts are inserted all or none.
+func (colln ScountCollection) Insert(_ context.Context, scounts ...db.Scount) error {
+	if len(scounts) == 0 {
+		return db.ErrNoRows
+	}
+	colln.DB.mu.Lock()
+	defer colln.DB.mu.Unlock()
+	for i, s := range scounts {
+		err := colln.check(s)
+		if err != nil {
+			// rollback
+			for _, s := range scounts[:i] {
+				delete(colln.DB.scounts, s.Sid)
+				delete(colln.DB.members, db.MemberId{Sid: s.Sid, Uid: s.Owner})
+			}
+			return err
+		}
+		s.Deleted = time.Time{}
+		colln.DB.scounts[s.Sid] = s
+		colln.DB.members[db.MemberId{Sid: s.Sid, Uid: s.Owner}] = db.Member{
+			Sid:  s.Sid,
+			Uid:  s.Owner,
+			Role: db.RoleOwner,
+		}
+	}
+	return nil
+}
+
+// check checks the constraints on inserting s, with DB locked.
+func (colln ScountCollection) check(s db.Scount) error {
+	if _, ok := colln.DB.scounts[s.Sid]; ok {
+		return conflict("duplicate scount %q", s.Sid)
+	}
+	if _, ok := colln.DB.users[s.Owner]; !ok {
+		return conflict("owner %q not a user", s.Owner)
+	}
+	return checkCurrency(s.Currency)
+}
+
+// DeleteOne moves exactly 1 scount from colln to the trash based on sid.
+func (colln ScountCollection) DeleteOne(_ context.Context, id *db.ScountId) error {
+	if id == nil {
+		return db.ErrNil
+	}
+	colln.DB.mu.Lock()
+	defer colln.DB.mu.Unlock()
+	s, ok := colln.DB.scounts[id.Sid]
+	if !ok || !s.Deleted.IsZero() {
+		return db.ErrNoRows
+	}
+	s.Deleted = time.Now()
+	colln.DB.scounts[s.Sid] = s
+	return nil
+}
+
+// Restore moves exactly 1 scount from the trash back to colln based on
+// sid.
+func (colln ScountCollection) Restore(_ context.Context, id *db.ScountId) error {
+	if id == nil {
+		return db.ErrNil
+	}
+	colln.DB.mu.Lock()
+	defer colln.DB.mu.Unlock()
+	s, ok := colln.DB.scounts[id.Sid]
+	if !ok || s.Deleted.IsZero() {
+		return db.ErrNoRows
+	}
+	s.Deleted = time.Time{}
+	colln.DB.scounts[s.Sid] = s
+	return nil
+}
+
+// Purge removes the scounts moved to the trash before the given time
+// for good, along with their members, expenses, settlements and invites.
+func (colln ScountCollection) Purge(_ context.Context, before time.Time) (int, error) {
+	colln.DB.mu.Lock()
+	defer colln.DB.mu.Unlock()
+	return colln.purge(func(s db.Scount) bool {
+		return !s.Deleted.IsZero() && s.Deleted.Before(before)
+	}), nil
+}
+
+// purge removes the scounts that match for good, along with everything
+// of them, with DB locked.
+func (colln ScountCollection) purge(match func(db.Scount) bool) int {
+	count := 0
+	for sid, s := range colln.DB.scounts {
+		if !match(s) {
+			continue
+		}
+		for aid, a := range colln.DB.activities {
+			if a.Sid == sid {
+				delete(colln.DB.activities, aid)
+			}
+		}
+		for iid, i := range colln.DB.invites {
+			if i.Sid == sid {
+				delete(colln.DB.invites, iid)
+			}
+		}
+		for stid := range colln.DB.settlements {
+			if stid.Sid == sid {
+				delete(colln.DB.settlements, stid)
+			}
+		}
+		for eid := range colln.DB.expenses {
+			if eid.Sid == sid {
+				delete(colln.DB.expenses, eid)
+			}
+		}
+		for mid := range colln.DB.members {
+			if mid.Sid == sid {
+				delete(colln.DB.members, mid)
+			}
+		}
+		delete(colln.DB.scounts, sid)
+		count++
+	}
+	return count
+}
+
+// UpdateOne modifies exactly 1 scount from colln. Change of owner
+// promotes the new owner and demotes the old owner to an admin. If the
+// new owner is not a member of the scount, then db.ErrConflict.
+func (colln ScountCollection) UpdateOne(
+	_ context.Context,
+	id *db.ScountId,
+	setter *db.ScountUpdater,
+) error {
+	if id == nil {
+		return db.ErrNil
+	}
+	if setter == nil {
+		setter = new(db.ScountUpdater)
+	}
+	colln.DB.mu.Lock()
+	defer colln.DB.mu.Unlock()
+	s, ok := colln.DB.scounts[id.Sid]
+	if !ok || !s.Deleted.IsZero() {
+		return db.ErrNoRows
+	}
+	if setter.Owner != "" {
+		if _, ok = colln.DB.users[setter.Owner]; !ok {
+			return conflict("owner %q not a user", setter.Owner)
+		}
+		owner, ok := colln.DB.members[db.MemberId{Sid: s.Sid, Uid: setter.Owner}]
+		if !ok || owner.Guest {
+			return conflict("owner %q not a member", setter.Owner)
+		}
+		// transfer ownership
+		for mid, m := range colln.DB.members {
+			if mid.Sid == s.Sid && m.Role == db.RoleOwner {
+				m.Role = db.RoleAdmin
+				colln.DB.members[mid] = m
+			}
+		}
+		owner.Role = db.RoleOwner
+		colln.DB.members[db.MemberId{Sid: owner.Sid, Uid: owner.Uid}] = owner
+		s.Owner = setter.Owner
+	}
+	if setter.Title != "" {
+		s.Title = setter.Title
+	}
+	colln.DB.scounts[s.Sid] = s
+	return nil
+}
+
+// FindOne fetches scount from colln by id.
+func (colln ScountCollection) FindOne(_ context.Context, id *db.ScountId) (db.Scount, error) {
+	if id == nil {
+		return db.Scount{}, db.ErrNil
+	}
+	colln.DB.mu.RLock()
+	defer colln.DB.mu.RUnlock()
+	s, ok := colln.DB.scounts[id.Sid]
+	if !ok || !s.Deleted.IsZero() {
+		return db.Scount{}, db.ErrNoRows
+	}
+	return s, nil
+}
+
+// Find fetches all the scounts from colln subject to filter and projector
+// options specified.
+func (colln ScountCollection) Find(
+	_ context.Context,
+	filter *db.ScountFilter,
+	projector *db.Projector,
+) (*db.Iterable[db.Scount], error) {
+	if filter == nil {
+		filter = new(db.ScountFilter)
+	}
+	// membership is looked up among the rows read together
+	var members map[db.MemberId]db.Member
+	rows := func() []db.Scount {
+		members = make(map[db.MemberId]db.Member, len(colln.DB.members))
+		for mid, m := range colln.DB.members {
+			members[mid] = m
+		}
+		scounts := make([]db.Scount, 0, len(colln.DB.scounts))
+		for _, s := range colln.DB.scounts {
+			scounts = append(scounts, s)
+		}
+		return scounts
+	}
+	isMember := func(sid, uid string) bool {
+		_, ok := members[db.MemberId{Sid: sid, Uid: uid}]
+		return ok
+	}
+	return find(colln.DB, rows, func(s db.Scount) bool {
+		return (filter.Sid == "" || s.Sid == filter.Sid) &&
+			(filter.Uid == "" || isMember(s.Sid, filter.Uid)) &&
+			(filter.Owner == "" || s.Owner == filter.Owner) &&
+			(filter.Title == "" || like(filter.Title, s.Title)) &&
+			(filter.Member == "" || isMember(s.Sid, filter.Member)) &&
+			!s.Deleted.IsZero() == filter.Trash
+	}, projector, db.ScountAllowedCols, db.ScountKeyCols)
+}
+
+// Balances computes the balance of every member of scount by sid, sorted
+// by uid. If no such scount exists, then db.ErrNoRows.
+func (colln ScountCollection) Balances(_ context.Context, sid string) ([]db.Balance, error) {
+	colln.DB.mu.RLock()
+	defer colln.DB.mu.RUnlock()
+	s, ok := colln.DB.scounts[sid]
+	if !ok || !s.Deleted.IsZero() {
+		return nil, db.ErrNoRows
+	}
+	zero := money.New(0, s.Currency)
+	index := make(map[string]*db.Balance)
+	balances := make([]*db.Balance, 0)
+	for mid := range colln.DB.members {
+		if mid.Sid != sid {
+			continue
+		}
+		b := &db.Balance{Uid: mid.Uid, Paid: zero, Owed: zero, Sent: zero, Received: zero}
+		index[mid.Uid] = b
+		balances = append(balances, b)
+	}
+	// members referred to are guaranteed to exist
+	for eid, e := range colln.DB.expenses {
+		if eid.Sid != sid || !e.Deleted.IsZero() {
+			continue
+		}
+		index[e.Payer].Paid.Minor += e.Base.Minor
+		for _, share := range e.Shares {
+			index[share.Uid].Owed.Minor += share.Base.Minor
+		}
+	}
+	for stid, st := range colln.DB.settlements {
+		if stid.Sid != sid {
+			continue
+		}
+		index[st.Payer].Sent.Minor += st.Base.Minor
+		index[st.Payee].Received.Minor += st.Base.Minor
+	}
+	slices.SortFunc(balances, func(a, b *db.Balance) int {
+		return strings.Compare(a.Uid, b.Uid)
+	})
+	result := make([]db.Balance, len(balances))
+	for i, b := range balances {
+		result[i] = *b
+	}
+	return result, nil
+}
+
+// compile-time assertion
+var _ interface {
+	db.Collection[db.Scount, db.ScountFilter, db.ScountUpdater, db.ScountId]
+	db.Trash[db.ScountId]
+	Balances(ctx context.Context, sid string) ([]db.Balance, error)
+} = ScountCollection{}
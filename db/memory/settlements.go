@@ -0,0 +1,143 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"math/big"
+
+	"github.com/manojnakp/scount/db"
+)
+
+// SettlementCollection provides a convenient way to interact with
+// settlements in the in-memory database.
+type SettlementCollection struct {
+	DB *Database
+}
+
+// Insert adds one or more settlements to colln. db.ErrNoRows if no
+// settlements to insert. Settlements are inserted all or none.
+func (colln SettlementCollection) Insert(_ context.Context, settlements ...db.Settlement) error {
+	if len(settlements) == 0 {
+		return db.ErrNoRows
+	}
+	colln.DB.mu.Lock()
+	defer colln.DB.mu.Unlock()
+	for i, s := range settlements {
+		err := colln.check(s)
+		if err != nil {
+			// rollback
+			for _, s := range settlements[:i] {
+				delete(colln.DB.settlements, db.SettlementId{Sid: s.Sid, Stid: s.Stid})
+			}
+			return err
+		}
+		colln.DB.settlements[db.SettlementId{Sid: s.Sid, Stid: s.Stid}] = copySettlement(s)
+	}
+	return nil
+}
+
+// check checks the constraints on inserting s, with DB locked.
+func (colln SettlementCollection) check(s db.Settlement) error {
+	if _, ok := colln.DB.scounts[s.Sid]; !ok {
+		return conflict("scount %q not found", s.Sid)
+	}
+	if _, ok := colln.DB.settlements[db.SettlementId{Sid: s.Sid, Stid: s.Stid}]; ok {
+		return conflict("duplicate settlement %q of scount %q", s.Stid, s.Sid)
+	}
+	for _, uid := range []string{s.Payer, s.Payee} {
+		if _, ok := colln.DB.members[db.MemberId{Sid: s.Sid, Uid: uid}]; !ok {
+			return conflict("%q not a member", uid)
+		}
+	}
+	if s.Payer == s.Payee {
+		return conflict("payer %q is the payee", s.Payer)
+	}
+	if s.Amount.Minor <= 0 || s.Base.Minor < 0 {
+		return conflict("invalid amount %s", s.Amount)
+	}
+	for _, err := range []error{
+		checkCurrency(s.Amount.Currency),
+		checkCurrency(s.Base.Currency),
+		checkRate(s.Rate),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copySettlement gives a deep copy of s, rate between the currencies of
+// amount and base.
+func copySettlement(s db.Settlement) db.Settlement {
+	if s.Rate.Ratio != nil {
+		s.Rate.Ratio = new(big.Rat).Set(s.Rate.Ratio)
+	}
+	s.Rate.From = s.Amount.Currency
+	s.Rate.To = s.Base.Currency
+	return s
+}
+
+// DeleteOne removes exactly 1 settlement from colln based on matching id.
+func (colln SettlementCollection) DeleteOne(_ context.Context, id *db.SettlementId) error {
+	if id == nil {
+		return db.ErrNil
+	}
+	colln.DB.mu.Lock()
+	defer colln.DB.mu.Unlock()
+	if _, ok := colln.DB.settlements[*id]; !ok {
+		return db.ErrNoRows
+	}
+	delete(colln.DB.settlements, *id)
+	return nil
+}
+
+// UpdateOne is not supported on settlements.
+func (colln SettlementCollection) UpdateOne(context.Context, *db.SettlementId, *db.SettlementUpdater) error {
+	return errors.ErrUnsupported
+}
+
+// FindOne fetches settlement from colln by id.
+func (colln SettlementCollection) FindOne(_ context.Context, id *db.SettlementId) (db.Settlement, error) {
+	if id == nil {
+		return db.Settlement{}, db.ErrNil
+	}
+	colln.DB.mu.RLock()
+	defer colln.DB.mu.RUnlock()
+	s, ok := colln.DB.settlements[*id]
+	if !ok {
+		return db.Settlement{}, db.ErrNoRows
+	}
+	return copySettlement(s), nil
+}
+
+// Find fetches all the settlements from colln subject to filter and
+// projector options specified.
+func (colln SettlementCollection) Find(
+	_ context.Context,
+	filter *db.SettlementFilter,
+	projector *db.Projector,
+) (*db.Iterable[db.Settlement], error) {
+	if filter == nil {
+		filter = new(db.SettlementFilter)
+	}
+	return find(colln.DB, colln.rows, func(s db.Settlement) bool {
+		return (filter.Sid == "" || s.Sid == filter.Sid) &&
+			(filter.Stid == "" || s.Stid == filter.Stid) &&
+			(filter.Payer == "" || s.Payer == filter.Payer) &&
+			(filter.Payee == "" || s.Payee == filter.Payee) &&
+			(filter.Member == "" || s.Payer == filter.Member || s.Payee == filter.Member)
+	}, projector, db.SettlementAllowedCols, db.SettlementKeyCols)
+}
+
+// rows gives copies of all the settlements, with DB locked.
+func (colln SettlementCollection) rows() []db.Settlement {
+	settlements := make([]db.Settlement, 0, len(colln.DB.settlements))
+	for _, s := range colln.DB.settlements {
+		settlements = append(settlements, copySettlement(s))
+	}
+	return settlements
+}
+
+// compile-time assertion
+var _ db.Collection[db.Settlement, db.SettlementFilter, db.SettlementUpdater, db.SettlementId] = SettlementCollection{}
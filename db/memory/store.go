@@ -0,0 +1,327 @@
+// Package memory implements the datastore of scount in memory, with the
+// same semantics as the postgres store but nothing persisted. It is meant
+// for tests and demos.
+package memory
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/manojnakp/scount/db"
+	"github.com/manojnakp/scount/money"
+)
+
+// NewStore constructs a [db.Store] over the in-memory database DB.
+func NewStore(DB *Database) *db.Store {
+	return &db.Store{
+		Users:       UserCollection{DB},
+		Scounts:     ScountCollection{DB},
+		Members:     MemberCollection{DB},
+		Expenses:    ExpenseCollection{DB},
+		Settlements: SettlementCollection{DB},
+		Invites:     InviteCollection{DB},
+		Activities:  ActivityCollection{DB},
+		Transact:    DB.transact,
+	}
+}
+
+// Database holds the records of every collection in memory, guarded by
+// a single lock so that operations spanning collections are atomic. It
+// enforces the same constraints as the postgres schema. The zero value
+// is not usable, see NewDatabase.
+type Database struct {
+	mu          sync.RWMutex
+	users       map[string]db.User
+	scounts     map[string]db.Scount
+	members     map[db.MemberId]db.Member
+	expenses    map[db.ExpenseId]db.Expense
+	settlements map[db.SettlementId]db.Settlement
+	invites     map[string]db.Invite
+	activities  map[string]db.Activity
+}
+
+// NewDatabase constructs an empty in-memory database.
+func NewDatabase() *Database {
+	return &Database{
+		users:       make(map[string]db.User),
+		scounts:     make(map[string]db.Scount),
+		members:     make(map[db.MemberId]db.Member),
+		expenses:    make(map[db.ExpenseId]db.Expense),
+		settlements: make(map[db.SettlementId]db.Settlement),
+		invites:     make(map[string]db.Invite),
+		activities:  make(map[string]db.Activity),
+	}
+}
+
+// transact implements db.Store.Transact on DB. Callback runs on a copy
+// of DB, swapped in on success, with DB locked meanwhile so that units
+// of work are serializable.
+func (DB *Database) transact(_ context.Context, callback func(*db.Store) error) error {
+	DB.mu.Lock()
+	defer DB.mu.Unlock()
+	// records are never modified in place, shallow copies suffice
+	tx := &Database{
+		users:       maps.Clone(DB.users),
+		scounts:     maps.Clone(DB.scounts),
+		members:     maps.Clone(DB.members),
+		expenses:    maps.Clone(DB.expenses),
+		settlements: maps.Clone(DB.settlements),
+		invites:     maps.Clone(DB.invites),
+		activities:  maps.Clone(DB.activities),
+	}
+	err := callback(NewStore(tx))
+	if err != nil {
+		return err
+	}
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	DB.users, DB.scounts, DB.members = tx.users, tx.scounts, tx.members
+	DB.expenses, DB.settlements, DB.invites = tx.expenses, tx.settlements, tx.invites
+	DB.activities = tx.activities
+	return nil
+}
+
+// currencyPattern is the check on currency codes in the schema.
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// conflict reports a violation of constraint, like the postgres errors
+// of class 23 (integrity constraint violation).
+func conflict(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", db.ErrConflict, fmt.Sprintf(format, args...))
+}
+
+// checkCurrency checks c against the currency code constraint.
+func checkCurrency(c money.Currency) error {
+	if !currencyPattern.MatchString(string(c)) {
+		return conflict("invalid currency %q", c)
+	}
+	return nil
+}
+
+// checkRate checks that r has a positive ratio.
+func checkRate(r money.Rate) error {
+	if r.Ratio == nil || r.Ratio.Sign() <= 0 {
+		return conflict("non-positive rate %s", r)
+	}
+	return nil
+}
+
+// like reports whether s matches the pattern in the way of ILIKE, that
+// is case-insensitive with `%` matching any sequence of characters and
+// `_` any single character, escaped by a backslash.
+func like(pattern, s string) bool {
+	pattern, s = strings.ToLower(pattern), strings.ToLower(s)
+	for pattern != "" {
+		r, size := utf8.DecodeRuneInString(pattern)
+		pattern = pattern[size:]
+		switch r {
+		case '%':
+			for i := 0; i <= len(s); i++ {
+				if like(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '_':
+			if s == "" {
+				return false
+			}
+			_, size = utf8.DecodeRuneInString(s)
+			s = s[size:]
+			continue
+		case '\\':
+			if pattern != "" {
+				r, size = utf8.DecodeRuneInString(pattern)
+				pattern = pattern[size:]
+			}
+		}
+		c, size := utf8.DecodeRuneInString(s)
+		if s == "" || c != r {
+			return false
+		}
+		s = s[size:]
+	}
+	return s == ""
+}
+
+// compareKey compares the column value a of a record with b, which is
+// either the value of the same column of another record or a keyset
+// value decoded from elsewhere (like times as RFC 3339 strings). If not
+// comparable, then db.ErrInvalidData.
+func compareKey(a, b any) (int, error) {
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b), nil
+		}
+	case int64:
+		switch b := b.(type) {
+		case int64:
+			return cmp.Compare(a, b), nil
+		case int:
+			return cmp.Compare(a, int64(b)), nil
+		case float64:
+			return cmp.Compare(float64(a), b), nil
+		case json.Number:
+			n, err := b.Int64()
+			if err == nil {
+				return cmp.Compare(a, n), nil
+			}
+		}
+	case time.Time:
+		switch b := b.(type) {
+		case time.Time:
+			return a.Compare(b), nil
+		case string:
+			t, err := time.Parse(time.RFC3339Nano, b)
+			if err == nil {
+				return a.Compare(t), nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("%w: cannot compare %T with %T", db.ErrInvalidData, a, b)
+}
+
+// compareKeyset compares the keysets a and b as per order.
+func compareKeyset(a, b db.Keyset, order []db.Sorter) (int, error) {
+	for i, sorter := range order {
+		c, err := compareKey(a[i], b[i])
+		if err != nil {
+			return 0, err
+		}
+		if sorter.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c, nil
+		}
+	}
+	return 0, nil
+}
+
+// query is the find query over records of a collection.
+type query[T db.Keyed] struct {
+	DB        *Database
+	rows      func() []T    // copies of all the records, with DB locked
+	match     func(T) bool  // filter on records
+	projector *db.Projector // not nil
+	order     []db.Sorter   // total order of records
+}
+
+// find constructs the list of records given by rows that match, as per
+// projector. Order of projector is checked against allowed columns and
+// extended with keys, see db.KeysetOrder. Records are read only upon
+// iterating over the list.
+func find[T db.Keyed](
+	DB *Database,
+	rows func() []T,
+	match func(T) bool,
+	projector *db.Projector,
+	allowed, keys []db.Column,
+) (*db.Iterable[T], error) {
+	if projector == nil {
+		projector = new(db.Projector)
+	}
+	for _, sorter := range projector.Order {
+		if !slices.Contains(allowed, sorter.Column) {
+			return nil, fmt.Errorf("%w: %q", db.ErrInvalidColumn, sorter.Column)
+		}
+	}
+	order := db.KeysetOrder(projector.Order, keys)
+	if paging := projector.Paging; paging != nil {
+		for _, keyset := range []db.Keyset{paging.After, paging.Before} {
+			if keyset != nil && len(keyset) != len(order) {
+				return nil, fmt.Errorf(
+					"%w: keyset of %d for %d columns",
+					db.ErrInvalidData, len(keyset), len(order),
+				)
+			}
+		}
+	}
+	q := query[T]{
+		DB:        DB,
+		rows:      rows,
+		match:     match,
+		projector: projector,
+		order:     order,
+	}
+	return db.NewIterable(q.iterator), nil
+}
+
+// iterator is the iterator function for constructing [db.Iterable].
+// Total is -1 if not counted.
+func (q query[T]) iterator(yield func(T) bool) (int, error) {
+	q.DB.mu.RLock()
+	all := q.rows()
+	q.DB.mu.RUnlock()
+	// filter
+	records := make([]T, 0, len(all))
+	for _, record := range all {
+		if q.match(record) {
+			records = append(records, record)
+		}
+	}
+	total := -1
+	if q.projector.Count {
+		total = len(records)
+	}
+	// sort
+	slices.SortFunc(records, func(a, b T) int {
+		c, _ := compareKeyset(db.KeysetOf(a, q.order), db.KeysetOf(b, q.order), q.order)
+		return c
+	})
+	records, err := q.page(records)
+	if err != nil {
+		return total, err
+	}
+	for _, record := range records {
+		if !yield(record) {
+			break
+		}
+	}
+	return total, nil
+}
+
+// page picks the records (sorted) of the page as per the paging options.
+// Records before the keyset are counted backwards from it.
+func (q query[T]) page(records []T) ([]T, error) {
+	paging := q.projector.Paging
+	if paging == nil {
+		return records, nil
+	}
+	keyset, before := paging.After, false
+	if keyset == nil && paging.Before != nil {
+		keyset, before = paging.Before, true
+	}
+	if keyset != nil {
+		picked := make([]T, 0, len(records))
+		for _, record := range records {
+			c, err := compareKeyset(db.KeysetOf(record, q.order), keyset, q.order)
+			if err != nil {
+				return nil, err
+			}
+			if (before && c < 0) || (!before && c > 0) {
+				picked = append(picked, record)
+			}
+		}
+		records = picked
+	}
+	if before {
+		slices.Reverse(records)
+	}
+	records = records[min(paging.Offset, len(records)):]
+	records = records[:min(paging.Limit, len(records))]
+	if before {
+		slices.Reverse(records)
+	}
+	return records, nil
+}
@@ -0,0 +1,15 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/manojnakp/scount/db"
+	"github.com/manojnakp/scount/db/dbtest"
+	"github.com/manojnakp/scount/db/memory"
+)
+
+func TestStore(t *testing.T) {
+	dbtest.Run(t, func(*testing.T) *db.Store {
+		return memory.NewStore(memory.NewDatabase())
+	})
+}
@@ -0,0 +1,235 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/manojnakp/scount/db"
+)
+
+// UserCollection provides a convenient way to interact with users in
+// the in-memory database.
+type UserCollection struct {
+	DB *Database
+}
+
+// Insert adds one or more users to colln. db.ErrNoRows if no users to insert.
+// Users are inserted all or none.
+func (colln UserCollection) Insert(_ context.Context, users ...db.User) error {
+	if len(users) == 0 {
+		return db.ErrNoRows
+	}
+	colln.DB.mu.Lock()
+	defer colln.DB.mu.Unlock()
+	for i, u := range users {
+		err := colln.check(u)
+		if err != nil {
+			// rollback
+			for _, u := range users[:i] {
+				delete(colln.DB.users, u.Uid)
+			}
+			return err
+		}
+		u.Password = bytes.Clone(u.Password)
+		colln.DB.users[u.Uid] = u
+	}
+	return nil
+}
+
+// check checks the constraints on inserting u, with DB locked.
+func (colln UserCollection) check(u db.User) error {
+	if _, ok := colln.DB.users[u.Uid]; ok {
+		return conflict("duplicate user %q", u.Uid)
+	}
+	for _, other := range colln.DB.users {
+		if other.Email == u.Email {
+			return conflict("duplicate email %q", u.Email)
+		}
+	}
+	return nil
+}
+
+// DeleteOne removes exactly 1 user from colln based on id. If the user
+// owns scounts, then db.ErrOwnsScounts. If the user has an open balance,
+// then db.ErrOpenBalance. Scounts of the user in the trash are purged and
+// memberships with history are left as guests, see db.Store.
+func (colln UserCollection) DeleteOne(_ context.Context, id *db.UserId) error {
+	if id == nil {
+		return db.ErrNil
+	}
+	colln.DB.mu.Lock()
+	defer colln.DB.mu.Unlock()
+	if _, ok := colln.DB.users[id.Uid]; !ok {
+		return db.ErrNoRows
+	}
+	for _, s := range colln.DB.scounts {
+		if s.Owner == id.Uid && s.Deleted.IsZero() {
+			return db.ErrOwnsScounts
+		}
+	}
+	// scounts left owned are in the trash, to be purged
+	owned := func(sid string) bool {
+		return colln.DB.scounts[sid].Owner == id.Uid
+	}
+	members := MemberCollection{colln.DB}
+	for mid := range colln.DB.members {
+		if mid.Uid == id.Uid && !owned(mid.Sid) && colln.net(mid) != 0 {
+			return db.ErrOpenBalance
+		}
+	}
+	ScountCollection{colln.DB}.purge(func(s db.Scount) bool {
+		return s.Owner == id.Uid
+	})
+	for mid, m := range colln.DB.members {
+		if mid.Uid != id.Uid {
+			continue
+		}
+		if !members.referred(mid) {
+			members.delete(mid)
+			continue
+		}
+		m.Guest, m.Name, m.Role = true, db.FormerMember, db.RoleMember
+		colln.DB.members[mid] = m
+	}
+	for iid, i := range colln.DB.invites {
+		if i.Creator == id.Uid {
+			delete(colln.DB.invites, iid)
+		}
+	}
+	delete(colln.DB.users, id.Uid)
+	return nil
+}
+
+// net gives the net balance of member id in minor units of the scount
+// currency, with DB locked. See db.Balance.
+func (colln UserCollection) net(id db.MemberId) int64 {
+	var net int64
+	for eid, e := range colln.DB.expenses {
+		if eid.Sid != id.Sid || !e.Deleted.IsZero() {
+			continue
+		}
+		if e.Payer == id.Uid {
+			net += e.Base.Minor
+		}
+		for _, share := range e.Shares {
+			if share.Uid == id.Uid {
+				net -= share.Base.Minor
+			}
+		}
+	}
+	for stid, st := range colln.DB.settlements {
+		if stid.Sid != id.Sid {
+			continue
+		}
+		if st.Payer == id.Uid {
+			net += st.Base.Minor
+		}
+		if st.Payee == id.Uid {
+			net -= st.Base.Minor
+		}
+	}
+	return net
+}
+
+// UpdatePassword modifies the password of the matching user record as specified.
+func (colln UserCollection) UpdatePassword(_ context.Context, updater *db.PasswordUpdater) error {
+	if updater == nil {
+		return db.ErrNil
+	}
+	colln.DB.mu.Lock()
+	defer colln.DB.mu.Unlock()
+	u, ok := colln.DB.users[updater.Uid]
+	if !ok || !bytes.Equal(u.Password, updater.Old) {
+		return db.ErrNoRows
+	}
+	u.Password = bytes.Clone(updater.New)
+	colln.DB.users[u.Uid] = u
+	return nil
+}
+
+// UpdateOne modifies exactly 1 user from colln.
+func (colln UserCollection) UpdateOne(
+	_ context.Context,
+	id *db.UserId,
+	setter *db.UserUpdater,
+) error {
+	if id == nil {
+		return db.ErrNil
+	}
+	if setter == nil {
+		setter = new(db.UserUpdater)
+	}
+	colln.DB.mu.Lock()
+	defer colln.DB.mu.Unlock()
+	u, ok := colln.DB.users[id.Uid]
+	if !ok {
+		return db.ErrNoRows
+	}
+	if setter.Username != "" {
+		u.Username = setter.Username
+	}
+	colln.DB.users[u.Uid] = u
+	return nil
+}
+
+// FindOne fetches user from colln by id.
+func (colln UserCollection) FindOne(_ context.Context, id *db.UserId) (db.User, error) {
+	if id == nil {
+		return db.User{}, db.ErrNil
+	}
+	colln.DB.mu.RLock()
+	defer colln.DB.mu.RUnlock()
+	u, ok := colln.DB.users[id.Uid]
+	if !ok {
+		return db.User{}, db.ErrNoRows
+	}
+	u.Password = bytes.Clone(u.Password)
+	return u, nil
+}
+
+// FindByEmail fetches user from colln by email.
+func (colln UserCollection) FindByEmail(_ context.Context, email string) (db.User, error) {
+	colln.DB.mu.RLock()
+	defer colln.DB.mu.RUnlock()
+	for _, u := range colln.DB.users {
+		if u.Email == email {
+			u.Password = bytes.Clone(u.Password)
+			return u, nil
+		}
+	}
+	return db.User{}, db.ErrNoRows
+}
+
+// Find fetches all the users from colln subject to filter and projector
+// options specified.
+func (colln UserCollection) Find(
+	_ context.Context,
+	filter *db.UserFilter,
+	projector *db.Projector,
+) (*db.Iterable[db.User], error) {
+	if filter == nil {
+		filter = new(db.UserFilter)
+	}
+	return find(colln.DB, colln.rows, func(u db.User) bool {
+		return (filter.Uid == "" || u.Uid == filter.Uid) &&
+			(filter.Email == "" || u.Email == filter.Email) &&
+			(filter.Username == "" || like(filter.Username, u.Username))
+	}, projector, db.UserAllowedCols, db.UserKeyCols)
+}
+
+// rows gives copies of all the users, with DB locked.
+func (colln UserCollection) rows() []db.User {
+	users := make([]db.User, 0, len(colln.DB.users))
+	for _, u := range colln.DB.users {
+		u.Password = bytes.Clone(u.Password)
+		users = append(users, u)
+	}
+	return users
+}
+
+// compile-time assertion
+var _ interface {
+	db.Collection[db.User, db.UserFilter, db.UserUpdater, db.UserId]
+	FindByEmail(ctx context.Context, email string) (db.User, error)
+	UpdatePassword(ctx context.Context, updater *db.PasswordUpdater) error
+} = UserCollection{}
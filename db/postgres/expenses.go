@@ -0,0 +1,453 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"text/template"
+	"time"
+
+	"github.com/manojnakp/scount/db"
+	"github.com/manojnakp/scount/money"
+
+	"github.com/lib/pq"
+)
+
+// ExpenseInsertQuery is a query statement for adding a single expense.
+const ExpenseInsertQuery = `
+INSERT INTO expenses (sid, eid, payer, title, amount, currency,
+	rate, base_amount, base_currency, mode)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);`
+
+// ShareInsertQuery is a query statement for adding a single expense share.
+const ShareInsertQuery = `
+INSERT INTO expense_shares (sid, eid, uid, weight, amount, base_amount)
+VALUES ($1, $2, $3, $4, $5, $6);`
+
+// ShareDeleteQuery is a query statement for deleting all shares of an expense.
+const ShareDeleteQuery = `
+DELETE FROM expense_shares
+WHERE sid = $1 AND eid = $2;`
+
+// ShareSelectQuery is a query statement for fetching all shares of an expense.
+const ShareSelectQuery = `
+SELECT uid, weight, amount, base_amount
+FROM expense_shares
+WHERE sid = $1 AND eid = $2
+ORDER BY uid;`
+
+// ExpenseTrashQuery is a query statement for moving a single expense by
+// id to the trash at time $3.
+const ExpenseTrashQuery = `
+UPDATE expenses SET deleted_at = $3
+WHERE sid = $1 AND eid = $2 AND deleted_at IS NULL;`
+
+// ExpenseRestoreQuery is a query statement for moving a single expense
+// by id back from the trash.
+const ExpenseRestoreQuery = `
+UPDATE expenses SET deleted_at = NULL
+WHERE sid = $1 AND eid = $2 AND deleted_at IS NOT NULL;`
+
+// ExpensePurgeQuery is a query statement for deleting the expenses moved
+// to the trash before time $1.
+const ExpensePurgeQuery = `
+DELETE FROM expenses
+WHERE deleted_at < $1;`
+
+// ExpenseSelectQuery is a query statement for fetching a single expense by id.
+const ExpenseSelectQuery = `
+SELECT sid, eid, payer, title, amount, currency,
+	rate, base_amount, base_currency, mode
+FROM expenses
+WHERE sid = $1 AND eid = $2 AND deleted_at IS NULL;`
+
+// ExpenseUpdateTemplate is a query template for updating expenses from ExpenseCollection.
+var ExpenseUpdateTemplate = template.Must(template.New("expense-update").
+	Funcs(template.FuncMap{"add": Add}).
+	Parse(`
+UPDATE expenses SET
+{{ range $i, $col := . }}
+	{{ if $i }},{{ end }} {{ $col }} = {{ add $i 3 | printf "$%d" }}
+{{ end }}
+WHERE sid = $1 AND eid = $2 AND deleted_at IS NULL;
+`))
+
+// ExpenseSelectTemplate is a query template for finding expenses from ExpenseCollection.
+var ExpenseSelectTemplate = template.Must(template.New("expense-select").
+	Funcs(template.FuncMap{"join": JoinSorter}).
+	Parse(`
+{{ define "filter" }}
+	FROM expenses e
+	WHERE ($1 OR sid = $2)
+	AND ($3 OR eid = $4)
+	AND ($5 OR payer = $6)
+	AND (deleted_at IS NOT NULL) = $9
+	AND ($7 OR title ILIKE $8)
+{{ end }}
+
+{{ define "find" }}
+	SELECT sid, eid, payer, title, amount, currency,
+		rate, base_amount, base_currency, mode, deleted_at,
+		array(SELECT s.uid FROM expense_shares s
+			WHERE s.sid = e.sid AND s.eid = e.eid ORDER BY s.uid),
+		array(SELECT s.weight FROM expense_shares s
+			WHERE s.sid = e.sid AND s.eid = e.eid ORDER BY s.uid),
+		array(SELECT s.amount FROM expense_shares s
+			WHERE s.sid = e.sid AND s.eid = e.eid ORDER BY s.uid),
+		array(SELECT s.base_amount FROM expense_shares s
+			WHERE s.sid = e.sid AND s.eid = e.eid ORDER BY s.uid)
+	{{ template "filter" }}
+	{{ with .Where }}AND {{ . }}{{ end }}
+	ORDER BY {{ join .Order "eid" }}
+	{{ with .Paging }}
+		LIMIT {{ .Limit }}
+		OFFSET {{ .Offset }}
+	{{ end }};
+{{ end }}
+
+{{ define "count" }}
+	SELECT count(*) AS total
+	{{ template "filter" }};
+{{ end }}
+`))
+
+// ExpenseCollection provides a convenient way to interact with `expenses` table.
+type ExpenseCollection struct {
+	DB Querier
+}
+
+// Insert adds one or more expenses into colln. db.ErrNoRows if empty expenses.
+func (colln ExpenseCollection) Insert(ctx context.Context, expenses ...db.Expense) error {
+	if len(expenses) == 0 {
+		return db.ErrNoRows
+	}
+	_, err := Tx[struct{}](ctx, colln.DB, func(tx Querier) (struct{}, error) {
+		var zero struct{}
+		// prepare insert query
+		stmt, err := tx.PrepareContext(ctx, ExpenseInsertQuery)
+		if err != nil {
+			log.Println("invalid stmt to prepare: ", err)
+			return zero, err
+		}
+		defer stmt.Close()
+		// insert every expense along with its shares
+		for _, e := range expenses {
+			_, err := stmt.ExecContext(
+				ctx, e.Sid, e.Eid, e.Payer, e.Title,
+				e.Amount, e.Amount.Currency,
+				e.Rate, e.Base, e.Base.Currency, e.Mode,
+			)
+			if err != nil {
+				return zero, Error(err)
+			}
+			err = colln.insertShares(ctx, tx, e.Sid, e.Eid, e.Shares)
+			if err != nil {
+				return zero, err
+			}
+		}
+		return zero, nil
+	})
+	return err
+}
+
+// insertShares adds shares of an expense identified by sid and eid within tx.
+func (colln ExpenseCollection) insertShares(
+	ctx context.Context,
+	tx Querier,
+	sid, eid string,
+	shares []db.Share,
+) error {
+	stmt, err := tx.PrepareContext(ctx, ShareInsertQuery)
+	if err != nil {
+		log.Println("invalid stmt to prepare: ", err)
+		return err
+	}
+	defer stmt.Close()
+	for _, s := range shares {
+		_, err = stmt.ExecContext(ctx, sid, eid, s.Uid, s.Weight, s.Amount, s.Base)
+		if err != nil {
+			return Error(err)
+		}
+	}
+	return nil
+}
+
+// DeleteOne moves exactly 1 expense from `expenses` collection to the
+// trash based on id.
+func (colln ExpenseCollection) DeleteOne(ctx context.Context, id *db.ExpenseId) error {
+	if id == nil {
+		return db.ErrNil
+	}
+	return colln.exec(ctx, ExpenseTrashQuery, id.Sid, id.Eid, time.Now())
+}
+
+// Restore moves exactly 1 expense from the trash back to `expenses`
+// collection based on id.
+func (colln ExpenseCollection) Restore(ctx context.Context, id *db.ExpenseId) error {
+	if id == nil {
+		return db.ErrNil
+	}
+	return colln.exec(ctx, ExpenseRestoreQuery, id.Sid, id.Eid)
+}
+
+// exec executes query with args, expecting some rows to be affected,
+// otherwise db.ErrNoRows.
+func (colln ExpenseCollection) exec(ctx context.Context, query string, args ...any) error {
+	res, err := colln.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return Error(err)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return db.ErrNoRows
+	}
+	return nil
+}
+
+// Purge removes the expenses moved to the trash before the given time
+// for good, along with their shares.
+func (colln ExpenseCollection) Purge(ctx context.Context, before time.Time) (int, error) {
+	res, err := colln.DB.ExecContext(ctx, ExpensePurgeQuery, before)
+	if err != nil {
+		return 0, Error(err)
+	}
+	count, err := res.RowsAffected()
+	return int(count), err
+}
+
+// UpdateOne modifies exactly 1 expense from `expenses` collection.
+func (colln ExpenseCollection) UpdateOne(
+	ctx context.Context,
+	id *db.ExpenseId,
+	setter *db.ExpenseUpdater,
+) error {
+	// pointer validity check
+	if id == nil {
+		return db.ErrNil
+	}
+	if setter == nil {
+		setter = new(db.ExpenseUpdater)
+	}
+	// construct query from template
+	query, args, err := colln.buildUpdateQuery(id, setter)
+	if err != nil {
+		return err
+	}
+	_, err = Tx[struct{}](ctx, colln.DB, func(tx Querier) (struct{}, error) {
+		var zero struct{}
+		// execute query
+		res, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return zero, Error(err)
+		}
+		// expect at least 1 row to be updated
+		count, err := res.RowsAffected()
+		if err != nil {
+			return zero, err
+		}
+		if count == 0 {
+			return zero, db.ErrNoRows
+		}
+		// shares left untouched
+		if setter.Shares == nil {
+			return zero, nil
+		}
+		// replace shares altogether
+		_, err = tx.ExecContext(ctx, ShareDeleteQuery, id.Sid, id.Eid)
+		if err != nil {
+			return zero, Error(err)
+		}
+		return zero, colln.insertShares(ctx, tx, id.Sid, id.Eid, setter.Shares)
+	})
+	// all good
+	return err
+}
+
+// buildUpdateQuery constructs an expense update query using provided id,
+// setter and ExpenseUpdateTemplate. id and setter are not nil.
+func (colln ExpenseCollection) buildUpdateQuery(
+	id *db.ExpenseId, setter *db.ExpenseUpdater,
+) (string, []any, error) {
+	// dollar arguments in the SQL query
+	args := []any{id.Sid, id.Eid}
+	// cols for template arguments
+	cols := make([]string, 0)
+	if setter.Payer != "" {
+		cols = append(cols, "payer")
+		args = append(args, setter.Payer)
+	}
+	if setter.Title != "" {
+		cols = append(cols, "title")
+		args = append(args, setter.Title)
+	}
+	if !setter.Amount.IsZero() {
+		cols = append(cols, "amount", "currency", "rate", "base_amount", "base_currency")
+		args = append(
+			args, setter.Amount, setter.Amount.Currency,
+			setter.Rate, setter.Base, setter.Base.Currency,
+		)
+	}
+	if setter.Mode != "" {
+		cols = append(cols, "mode")
+		args = append(args, setter.Mode)
+	}
+	// nothing to set: touch the row to report existence
+	if len(cols) == 0 {
+		cols = append(cols, "eid")
+		args = append(args, id.Eid)
+	}
+	// construct
+	buf := new(bytes.Buffer)
+	err := ExpenseUpdateTemplate.Execute(buf, cols)
+	if err != nil {
+		log.Println("tmpl exec expense-update: ", err)
+		return "", nil, err
+	}
+	return buf.String(), args, nil
+}
+
+// FindOne fetches expense from colln by id.
+func (colln ExpenseCollection) FindOne(
+	ctx context.Context,
+	id *db.ExpenseId,
+) (e db.Expense, err error) {
+	if id == nil {
+		err = db.ErrNil
+		return
+	}
+	return Tx[db.Expense](ctx, colln.DB, func(tx Querier) (e db.Expense, err error) {
+		var expense db.Expense
+		err = tx.QueryRowContext(ctx, ExpenseSelectQuery, id.Sid, id.Eid).Scan(
+			&expense.Sid, &expense.Eid, &expense.Payer,
+			&expense.Title, &expense.Amount, &expense.Amount.Currency,
+			&expense.Rate, &expense.Base, &expense.Base.Currency, &expense.Mode,
+		)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				err = db.ErrNoRows
+			}
+			return
+		}
+		expense.Rate.From = expense.Amount.Currency
+		expense.Rate.To = expense.Base.Currency
+		// fetch shares of the expense
+		rows, err := tx.QueryContext(ctx, ShareSelectQuery, id.Sid, id.Eid)
+		if err != nil {
+			return
+		}
+		defer rows.Close()
+		expense.Shares = make([]db.Share, 0)
+		for rows.Next() {
+			var share db.Share
+			err = rows.Scan(&share.Uid, &share.Weight, &share.Amount, &share.Base)
+			if err != nil {
+				return
+			}
+			share.Amount.Currency = expense.Amount.Currency
+			share.Base.Currency = expense.Base.Currency
+			expense.Shares = append(expense.Shares, share)
+		}
+		err = rows.Err()
+		if err != nil {
+			return
+		}
+		return expense, nil
+	})
+}
+
+// Find fetches all the expenses from colln subject to filter and projector
+// options specified.
+func (colln ExpenseCollection) Find(
+	ctx context.Context,
+	filter *db.ExpenseFilter,
+	projector *db.Projector,
+) (list *db.Iterable[db.Expense], err error) {
+	args := colln.buildArgs(filter)
+	query, err := colln.buildSelectQuery(projector, len(args))
+	if err != nil {
+		return
+	}
+	iterator := func(yield func(db.Expense) bool) (int, error) {
+		return Tx[int](ctx, colln.DB, func(tx Querier) (int, error) {
+			return queryData[db.Expense]{
+				context: ctx,
+				sqldb:   tx,
+				query:   query,
+				args:    args,
+				scanner: colln.scanOne,
+			}.iterator(yield)
+		})
+	}
+	return db.NewIterable[db.Expense](iterator), nil
+}
+
+// scanOne scans one expense from rows and returns associated data.
+func (colln ExpenseCollection) scanOne(rows *sql.Rows) (e db.Expense, err error) {
+	var (
+		expense db.Expense
+		uids    []string
+		weights []int64
+		amounts []int64
+		bases   []int64
+	)
+	err = rows.Scan(
+		&expense.Sid, &expense.Eid, &expense.Payer,
+		&expense.Title, &expense.Amount, &expense.Amount.Currency,
+		&expense.Rate, &expense.Base, &expense.Base.Currency, &expense.Mode,
+		(*nullTime)(&expense.Deleted),
+		pq.Array(&uids), pq.Array(&weights), pq.Array(&amounts), pq.Array(&bases),
+	)
+	if err != nil {
+		return
+	}
+	expense.Rate.From = expense.Amount.Currency
+	expense.Rate.To = expense.Base.Currency
+	// arrays are ordered alike by uid
+	if len(weights) != len(uids) || len(amounts) != len(uids) || len(bases) != len(uids) {
+		err = db.ErrEncoding
+		return
+	}
+	expense.Shares = make([]db.Share, len(uids))
+	for i := range uids {
+		expense.Shares[i] = db.Share{
+			Uid:    uids[i],
+			Weight: weights[i],
+			Amount: money.New(amounts[i], expense.Amount.Currency),
+			Base:   money.New(bases[i], expense.Base.Currency),
+		}
+	}
+	return expense, nil
+}
+
+// buildSelectQuery constructs expense select query using provided
+// projector and ExpenseSelectTemplate, following argc filter args. Sorting
+// on any column not in db.ExpenseAllowedCols gives db.ErrInvalidColumn.
+func (colln ExpenseCollection) buildSelectQuery(projector *db.Projector, argc int) (selectQuery, error) {
+	return buildSelect(ExpenseSelectTemplate, projector, db.ExpenseAllowedCols, db.ExpenseKeyCols, argc)
+}
+
+// buildArgs constructs sql dollar argument values for executing the query.
+func (colln ExpenseCollection) buildArgs(filter *db.ExpenseFilter) []any {
+	if filter == nil {
+		filter = new(db.ExpenseFilter)
+	}
+	args := make([]any, 0)
+	// WHERE clause
+	args = append(args, filter.Sid == "", filter.Sid)
+	args = append(args, filter.Eid == "", filter.Eid)
+	args = append(args, filter.Payer == "", filter.Payer)
+	args = append(args, filter.Title == "", filter.Title)
+	args = append(args, filter.Trash)
+	return args
+}
+
+// compile-time assertion
+var _ interface {
+	db.Collection[db.Expense, db.ExpenseFilter, db.ExpenseUpdater, db.ExpenseId]
+	db.Trash[db.ExpenseId]
+} = ExpenseCollection{}
@@ -0,0 +1,291 @@
+package postgres
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/manojnakp/scount/db"
+)
+
+// migrationFiles embeds the migration scripts, named like
+// `0001_init.up.sql` and `0001_init.down.sql`.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// ErrPendingMigrations is the error when the schema is behind the
+// migrations shipped with the store.
+var ErrPendingMigrations = errors.New("pending migrations")
+
+// MigrationLock is the key of the advisory lock held while migrating, so
+// that replicas starting together do not race.
+const MigrationLock int64 = 0x73636f756e74 // "scount"
+
+// MigrationTableQuery is a query statement for creating the table of
+// applied migrations.
+const MigrationTableQuery = `
+CREATE TABLE IF NOT EXISTS schema_migrations
+(
+    version    BIGINT      NOT NULL,
+    name       TEXT        NOT NULL,
+    applied_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (version)
+);`
+
+// MigrationExistsQuery is a query statement for checking whether the
+// table of applied migrations exists.
+const MigrationExistsQuery = `
+SELECT to_regclass('schema_migrations') IS NOT NULL;`
+
+// MigrationSelectQuery is a query statement for fetching versions of the
+// applied migrations.
+const MigrationSelectQuery = `
+SELECT version FROM schema_migrations;`
+
+// MigrationInsertQuery is a query statement for recording an applied
+// migration.
+const MigrationInsertQuery = `
+INSERT INTO schema_migrations (version, name)
+VALUES ($1, $2);`
+
+// MigrationDeleteQuery is a query statement for forgetting a rolled back
+// migration.
+const MigrationDeleteQuery = `
+DELETE FROM schema_migrations
+WHERE version = $1;`
+
+// MigrateMode tells Open what to do about pending migrations.
+type MigrateMode int
+
+const (
+	MigrateSkip  MigrateMode = iota // leave the schema as is
+	MigrateCheck                    // fail with ErrPendingMigrations
+	MigrateApply                    // apply pending migrations
+)
+
+// Migration is a versioned change to the schema, with the SQL scripts
+// to apply (up) and to roll it back (down).
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// String implements fmt.Stringer on Migration.
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// Migrations gives the embedded migrations ordered by version.
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[int64]*Migration)
+	for _, entry := range entries {
+		base, ok := strings.CutSuffix(entry.Name(), ".sql")
+		if !ok {
+			continue
+		}
+		base, direction := strings.TrimSuffix(base, path.Ext(base)), path.Ext(base)
+		prefix, name, _ := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration %q", entry.Name())
+		}
+		script, err := fs.ReadFile(migrationFiles, path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m := index[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: name}
+			index[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("migration %d named both %q and %q", version, m.Name, name)
+		}
+		switch direction {
+		case ".up":
+			m.Up = string(script)
+		case ".down":
+			m.Down = string(script)
+		default:
+			return nil, fmt.Errorf("invalid migration %q", entry.Name())
+		}
+	}
+	migrations := make([]Migration, 0, len(index))
+	for _, m := range index {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %s lacks up or down script", m)
+		}
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return migrations, nil
+}
+
+// Pending gives the migrations not yet applied to the database, ordered
+// by version.
+func Pending(ctx context.Context, DB *sql.DB) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedVersions(ctx, DB)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(migrations, func(m Migration) bool {
+		return applied[m.Version]
+	}), nil
+}
+
+// Migrate applies the pending migrations in order of version, each in a
+// transaction of its own, and gives the applied ones. It holds the
+// advisory MigrationLock meanwhile.
+func Migrate(ctx context.Context, DB *sql.DB) ([]Migration, error) {
+	var done []Migration
+	err := withMigrationLock(ctx, DB, func(conn *sql.Conn) error {
+		_, err := conn.ExecContext(ctx, MigrationTableQuery)
+		if err != nil {
+			return Error(err)
+		}
+		migrations, err := Migrations()
+		if err != nil {
+			return err
+		}
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			if applied[m.Version] {
+				continue
+			}
+			err = migrateOne(ctx, conn, m.Up, MigrationInsertQuery, m.Version, m.Name)
+			if err != nil {
+				return fmt.Errorf("migration %s: %w", m, err)
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Rollback rolls back the last steps applied migrations in reverse
+// order of version, each in a transaction of its own, and gives the
+// rolled back ones. It holds the advisory MigrationLock meanwhile.
+func Rollback(ctx context.Context, DB *sql.DB, steps int) ([]Migration, error) {
+	var done []Migration
+	err := withMigrationLock(ctx, DB, func(conn *sql.Conn) error {
+		migrations, err := Migrations()
+		if err != nil {
+			return err
+		}
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		slices.Reverse(migrations)
+		for _, m := range migrations {
+			if len(done) == steps {
+				break
+			}
+			if !applied[m.Version] {
+				continue
+			}
+			err = migrateOne(ctx, conn, m.Down, MigrationDeleteQuery, m.Version)
+			if err != nil {
+				return fmt.Errorf("migration %s: %w", m, err)
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// withMigrationLock runs callback on a single connection of DB holding
+// the advisory MigrationLock.
+func withMigrationLock(ctx context.Context, DB *sql.DB, callback func(*sql.Conn) error) error {
+	if DB == nil {
+		return db.ErrNil
+	}
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1);", MigrationLock)
+	if err != nil {
+		return Error(err)
+	}
+	// unlock even if ctx is done
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1);", MigrationLock)
+	return callback(conn)
+}
+
+// migrateOne runs script and then query with args (recording the
+// migration) in a transaction on conn.
+func migrateOne(ctx context.Context, conn *sql.Conn, script, query string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, script)
+	if err != nil {
+		return Error(err)
+	}
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return Error(err)
+	}
+	return tx.Commit()
+}
+
+// appliedVersions gives the set of versions of the applied migrations,
+// none if the table of applied migrations is missing.
+func appliedVersions(ctx context.Context, sqldb interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}) (map[int64]bool, error) {
+	applied := make(map[int64]bool)
+	var exists bool
+	err := sqldb.QueryRowContext(ctx, MigrationExistsQuery).Scan(&exists)
+	if err != nil {
+		return nil, Error(err)
+	}
+	if !exists {
+		return applied, nil
+	}
+	rows, err := sqldb.QueryContext(ctx, MigrationSelectQuery)
+	if err != nil {
+		return nil, Error(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int64
+		err = rows.Scan(&version)
+		if err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
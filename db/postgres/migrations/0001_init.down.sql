@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS members;
+
+DROP TABLE IF EXISTS scounts;
+
+DROP TABLE IF EXISTS users;
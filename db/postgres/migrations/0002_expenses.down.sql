@@ -0,0 +1,22 @@
+DROP TABLE IF EXISTS invites;
+
+DROP TABLE IF EXISTS settlements;
+
+DROP TABLE IF EXISTS expense_shares;
+
+DROP TABLE IF EXISTS expenses;
+
+DROP INDEX IF EXISTS members_owner_idx;
+
+-- guests cannot be kept under the foreign key on uid
+DELETE FROM members
+WHERE guest;
+
+ALTER TABLE members
+    DROP COLUMN IF EXISTS guest,
+    DROP COLUMN IF EXISTS name,
+    DROP COLUMN IF EXISTS role,
+    ADD CONSTRAINT members_uid_fkey FOREIGN KEY (uid) REFERENCES users (uid);
+
+ALTER TABLE scounts
+    DROP COLUMN IF EXISTS currency;
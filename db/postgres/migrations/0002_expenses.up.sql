@@ -0,0 +1,114 @@
+ALTER TABLE scounts
+    ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT 'EUR',
+    DROP CONSTRAINT IF EXISTS scounts_currency_check,
+    ADD CONSTRAINT scounts_currency_check CHECK (currency ~ '^[A-Z]{3}$');
+
+-- guest members have no row in users, hence no foreign key on uid
+ALTER TABLE members
+    DROP CONSTRAINT IF EXISTS members_uid_fkey,
+    ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'member',
+    ADD COLUMN IF NOT EXISTS name TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS guest BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- owners have always been members, now with the role of their own
+INSERT INTO members (sid, uid, role)
+SELECT sid, owner, 'owner'
+FROM scounts
+ON CONFLICT (sid, uid) DO UPDATE SET role = 'owner';
+
+ALTER TABLE members
+    DROP CONSTRAINT IF EXISTS members_role_check,
+    DROP CONSTRAINT IF EXISTS members_check,
+    DROP CONSTRAINT IF EXISTS members_check1,
+    ADD CONSTRAINT members_role_check CHECK (role IN ('owner', 'admin', 'member', 'viewer')),
+    ADD CONSTRAINT members_check CHECK (NOT guest OR name <> ''),
+    ADD CONSTRAINT members_check1 CHECK (NOT guest OR role <> 'owner');
+
+CREATE UNIQUE INDEX IF NOT EXISTS members_owner_idx ON members (sid) WHERE role = 'owner';
+
+CREATE TABLE IF NOT EXISTS expenses
+(
+    sid           TEXT    NOT NULL,
+    eid           TEXT    NOT NULL,
+    payer         TEXT    NOT NULL,
+    title         TEXT    NOT NULL,
+    amount        BIGINT  NOT NULL,
+    currency      TEXT    NOT NULL,
+    rate          NUMERIC NOT NULL DEFAULT 1,
+    base_amount   BIGINT  NOT NULL,
+    base_currency TEXT    NOT NULL,
+    mode          TEXT    NOT NULL DEFAULT 'equal',
+    FOREIGN KEY (sid) REFERENCES scounts (sid),
+    FOREIGN KEY (sid, payer) REFERENCES members (sid, uid),
+    PRIMARY KEY (sid, eid),
+    CHECK (amount > 0),
+    CHECK (currency ~ '^[A-Z]{3}$'),
+    CHECK (rate > 0),
+    CHECK (base_amount >= 0),
+    CHECK (base_currency ~ '^[A-Z]{3}$'),
+    CHECK (mode IN ('equal', 'exact', 'percent', 'shares'))
+);
+
+CREATE TABLE IF NOT EXISTS expense_shares
+(
+    sid         TEXT   NOT NULL,
+    eid         TEXT   NOT NULL,
+    uid         TEXT   NOT NULL,
+    weight      BIGINT NOT NULL,
+    amount      BIGINT NOT NULL,
+    base_amount BIGINT NOT NULL,
+    FOREIGN KEY (sid, eid) REFERENCES expenses (sid, eid) ON DELETE CASCADE,
+    FOREIGN KEY (sid, uid) REFERENCES members (sid, uid),
+    PRIMARY KEY (sid, eid, uid),
+    CHECK (weight >= 0),
+    CHECK (amount >= 0),
+    CHECK (base_amount >= 0)
+);
+
+CREATE INDEX IF NOT EXISTS expenses_payer_idx ON expenses (sid, payer);
+
+CREATE INDEX IF NOT EXISTS expense_shares_uid_idx ON expense_shares (sid, uid);
+
+CREATE TABLE IF NOT EXISTS settlements
+(
+    sid           TEXT    NOT NULL,
+    stid          TEXT    NOT NULL,
+    payer         TEXT    NOT NULL,
+    payee         TEXT    NOT NULL,
+    amount        BIGINT  NOT NULL,
+    currency      TEXT    NOT NULL,
+    rate          NUMERIC NOT NULL DEFAULT 1,
+    base_amount   BIGINT  NOT NULL,
+    base_currency TEXT    NOT NULL,
+    FOREIGN KEY (sid) REFERENCES scounts (sid),
+    FOREIGN KEY (sid, payer) REFERENCES members (sid, uid),
+    FOREIGN KEY (sid, payee) REFERENCES members (sid, uid),
+    PRIMARY KEY (sid, stid),
+    CHECK (amount > 0),
+    CHECK (currency ~ '^[A-Z]{3}$'),
+    CHECK (rate > 0),
+    CHECK (base_amount >= 0),
+    CHECK (base_currency ~ '^[A-Z]{3}$'),
+    CHECK (payer <> payee)
+);
+
+CREATE TABLE IF NOT EXISTS invites
+(
+    sid        TEXT        NOT NULL,
+    iid        TEXT        NOT NULL,
+    creator    TEXT        NOT NULL,
+    role       TEXT        NOT NULL DEFAULT 'member',
+    guest      TEXT,
+    expires    TIMESTAMPTZ NOT NULL,
+    single_use BOOLEAN     NOT NULL DEFAULT FALSE,
+    uses       INTEGER     NOT NULL DEFAULT 0,
+    FOREIGN KEY (sid) REFERENCES scounts (sid) ON DELETE CASCADE,
+    FOREIGN KEY (creator) REFERENCES users (uid),
+    FOREIGN KEY (sid, guest) REFERENCES members (sid, uid) ON DELETE CASCADE,
+    PRIMARY KEY (iid),
+    CHECK (role IN ('admin', 'member', 'viewer')),
+    CHECK (uses >= 0),
+    CHECK (guest IS NULL OR single_use)
+);
+
+CREATE INDEX IF NOT EXISTS invites_sid_idx ON invites (sid);
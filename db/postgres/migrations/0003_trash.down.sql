@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS expenses_deleted_idx;
+
+DROP INDEX IF EXISTS scounts_deleted_idx;
+
+ALTER TABLE expenses
+    DROP COLUMN IF EXISTS deleted_at;
+
+ALTER TABLE scounts
+    DROP COLUMN IF EXISTS deleted_at;
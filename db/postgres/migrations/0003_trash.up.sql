@@ -0,0 +1,9 @@
+ALTER TABLE scounts
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+ALTER TABLE expenses
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS scounts_deleted_idx ON scounts (deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS expenses_deleted_idx ON expenses (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,16 @@
+-- append-only, actors are kept as is once gone
+CREATE TABLE IF NOT EXISTS activities
+(
+    sid          TEXT        NOT NULL,
+    aid          TEXT        NOT NULL,
+    actor        TEXT        NOT NULL,
+    kind         TEXT        NOT NULL,
+    target       TEXT        NOT NULL DEFAULT '',
+    time         TIMESTAMPTZ NOT NULL DEFAULT now(),
+    before_value JSONB,
+    after_value  JSONB,
+    FOREIGN KEY (sid) REFERENCES scounts (sid),
+    PRIMARY KEY (aid)
+);
+
+CREATE INDEX IF NOT EXISTS activities_sid_idx ON activities (sid, time);
@@ -7,19 +7,21 @@ import (
 	"errors"
 	"log"
 	"text/template"
+	"time"
 
 	"github.com/manojnakp/scount/db"
+	"github.com/manojnakp/scount/money"
 )
 
 // ScountInsertQuery is a query statement for adding a single scount by id.
 const ScountInsertQuery = `
 WITH mcte AS (
-	INSERT INTO scounts (sid, owner, title, description)
-	VALUES ($1, $2, $3, $4)
+	INSERT INTO scounts (sid, owner, title, description, currency)
+	VALUES ($1, $2, $3, $4, $5)
 	RETURNING sid, owner
 )
-INSERT INTO members
-SELECT sid, owner FROM mcte;
+INSERT INTO members (sid, uid, role)
+SELECT sid, owner, 'owner' FROM mcte;
 `
 
 // ScountDeleteQuery is a query statement for deleting a single scount by sid.
@@ -27,11 +29,96 @@ const ScountDeleteQuery = `
 DELETE FROM scounts
 WHERE sid = $1;`
 
+// ScountTrashQuery is a query statement for moving a single scount by
+// sid to the trash at time $2.
+const ScountTrashQuery = `
+UPDATE scounts SET deleted_at = $2
+WHERE sid = $1 AND deleted_at IS NULL;`
+
+// ScountRestoreQuery is a query statement for moving a single scount by
+// sid back from the trash.
+const ScountRestoreQuery = `
+UPDATE scounts SET deleted_at = NULL
+WHERE sid = $1 AND deleted_at IS NOT NULL;`
+
+// ScountPurgeQuery is a query statement for fetching sids of the scounts
+// moved to the trash before time $1.
+const ScountPurgeQuery = `
+SELECT sid FROM scounts
+WHERE deleted_at < $1;`
+
+// ScountCascadeQueries are query statements for deleting everything of
+// a scount by sid, in order of dependence, before the scount itself.
+// Shares go along with expenses.
+var ScountCascadeQueries = []string{
+	`DELETE FROM activities WHERE sid = $1;`,
+	`DELETE FROM invites WHERE sid = $1;`,
+	`DELETE FROM settlements WHERE sid = $1;`,
+	`DELETE FROM expenses WHERE sid = $1;`,
+	`DELETE FROM members WHERE sid = $1;`,
+}
+
 // ScountSelectQuery is a query statement for fetching a single scount by sid.
 const ScountSelectQuery = `
-SELECT sid, owner, title, description
+SELECT sid, owner, title, description, currency
 FROM scounts
-WHERE sid = $1;`
+WHERE sid = $1 AND deleted_at IS NULL;`
+
+// ScountExistsQuery is a query statement for checking existence of a scount by sid.
+const ScountExistsQuery = `
+SELECT EXISTS (SELECT 1 FROM scounts WHERE sid = $1 AND deleted_at IS NULL);`
+
+// ScountBalanceQuery is a query statement for computing balances of
+// every member of a scount by sid, in the currency of the scount.
+// Expenses in the trash are left out.
+const ScountBalanceQuery = `
+WITH paid AS (
+	SELECT payer AS uid, sum(base_amount) AS total
+	FROM expenses
+	WHERE sid = $1 AND deleted_at IS NULL
+	GROUP BY payer
+), owed AS (
+	SELECT s.uid, sum(s.base_amount) AS total
+	FROM expense_shares s
+	JOIN expenses e USING (sid, eid)
+	WHERE s.sid = $1 AND e.deleted_at IS NULL
+	GROUP BY s.uid
+), sent AS (
+	SELECT payer AS uid, sum(base_amount) AS total
+	FROM settlements
+	WHERE sid = $1
+	GROUP BY payer
+), received AS (
+	SELECT payee AS uid, sum(base_amount) AS total
+	FROM settlements
+	WHERE sid = $1
+	GROUP BY payee
+)
+SELECT m.uid, s.currency,
+	COALESCE(paid.total, 0)::BIGINT AS paid,
+	COALESCE(owed.total, 0)::BIGINT AS owed,
+	COALESCE(sent.total, 0)::BIGINT AS sent,
+	COALESCE(received.total, 0)::BIGINT AS received
+FROM members m
+JOIN scounts s USING (sid)
+LEFT JOIN paid USING (uid)
+LEFT JOIN owed USING (uid)
+LEFT JOIN sent USING (uid)
+LEFT JOIN received USING (uid)
+WHERE m.sid = $1
+ORDER BY m.uid;`
+
+// ScountDemoteOwnerQuery is a query statement for demoting the owner of
+// a scount by sid to an admin.
+const ScountDemoteOwnerQuery = `
+UPDATE members SET role = 'admin'
+WHERE sid = $1 AND role = 'owner';`
+
+// ScountPromoteOwnerQuery is a query statement for promoting a member of
+// a scount by sid and uid to the owner.
+const ScountPromoteOwnerQuery = `
+UPDATE members SET role = 'owner'
+WHERE sid = $1 AND uid = $2;`
 
 // ScountUpdateTemplate is a query template for updating scounts from ScountCollection.
 var ScountUpdateTemplate = template.Must(template.New("scount-update").
@@ -39,9 +126,9 @@ var ScountUpdateTemplate = template.Must(template.New("scount-update").
 	Parse(`
 UPDATE scounts SET
 {{ range $i, $col := . }}
-	{{ $col }} = {{ add $i 2 | printf "$%d" }}
+	{{ if $i }},{{ end }} {{ $col }} = {{ add $i 2 | printf "$%d" }}
 {{ end }}
-WHERE sid = $1;
+WHERE sid = $1 AND deleted_at IS NULL;
 `))
 
 // ScountSelectTemplate is a query template for finding scounts from ScountCollection.
@@ -49,17 +136,20 @@ var ScountSelectTemplate = template.Must(template.New("scount-select").
 	Funcs(template.FuncMap{"join": JoinSorter}).
 	Parse(`
 {{ define "filter" }}
-	FROM scounts NATURAL JOIN members
+	FROM scounts s
 	WHERE ($1 OR sid = $2)
-	AND ($3 OR uid = $4)
+	AND ($3 OR EXISTS (SELECT 1 FROM members m WHERE m.sid = s.sid AND m.uid = $4))
 	AND ($5 OR owner = $6)
 	AND ($7 OR title ILIKE $8)
-	ORDER BY {{ join .Order "sid, uid" }}
+	AND ($9 OR EXISTS (SELECT 1 FROM members m WHERE m.sid = s.sid AND m.uid = $10))
+	AND (deleted_at IS NOT NULL) = $11
 {{ end }}
 
 {{ define "find" }}
-	SELECT DISTINCT sid, owner, title, description,
+	SELECT sid, owner, title, description, currency, deleted_at
 	{{ template "filter" }}
+	{{ with .Where }}AND {{ . }}{{ end }}
+	ORDER BY {{ join .Order "sid" }}
 	{{ with .Paging }}
 		LIMIT {{ .Limit }}
 		OFFSET {{ .Offset }}
@@ -74,15 +164,31 @@ var ScountSelectTemplate = template.Must(template.New("scount-select").
 
 // ScountCollection provides a convenient way to interact with `scounts` table.
 type ScountCollection struct {
-	DB *sql.DB
+	DB Querier
 }
 
-// DeleteOne removes exactly 1 scount from `scounts` collection based on sid.
+// DeleteOne moves exactly 1 scount from `scounts` collection to the
+// trash based on sid.
 func (colln ScountCollection) DeleteOne(ctx context.Context, id *db.ScountId) error {
 	if id == nil {
 		return db.ErrNil
 	}
-	res, err := colln.DB.ExecContext(ctx, ScountDeleteQuery, id.Sid)
+	return colln.exec(ctx, ScountTrashQuery, id.Sid, time.Now())
+}
+
+// Restore moves exactly 1 scount from the trash back to `scounts`
+// collection based on sid.
+func (colln ScountCollection) Restore(ctx context.Context, id *db.ScountId) error {
+	if id == nil {
+		return db.ErrNil
+	}
+	return colln.exec(ctx, ScountRestoreQuery, id.Sid)
+}
+
+// exec executes query with args, expecting some rows to be affected,
+// otherwise db.ErrNoRows.
+func (colln ScountCollection) exec(ctx context.Context, query string, args ...any) error {
+	res, err := colln.DB.ExecContext(ctx, query, args...)
 	if err != nil {
 		return Error(err)
 	}
@@ -96,7 +202,50 @@ func (colln ScountCollection) DeleteOne(ctx context.Context, id *db.ScountId) er
 	return nil
 }
 
-// UpdateOne modifies exactly 1 scount from `scounts` collection.
+// Purge removes the scounts moved to the trash before the given time
+// for good, along with their members, expenses, settlements and invites.
+func (colln ScountCollection) Purge(ctx context.Context, before time.Time) (int, error) {
+	return Tx[int](ctx, colln.DB, func(tx Querier) (int, error) {
+		return colln.purge(ctx, tx, ScountPurgeQuery, before)
+	})
+}
+
+// purge removes the scounts with sids fetched by query with args for
+// good, along with everything of them, within tx.
+func (colln ScountCollection) purge(ctx context.Context, tx Querier, query string, args ...any) (int, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, Error(err)
+	}
+	sids := make([]string, 0)
+	for rows.Next() {
+		var sid string
+		err = rows.Scan(&sid)
+		if err != nil {
+			_ = rows.Close()
+			return 0, err
+		}
+		sids = append(sids, sid)
+	}
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	for _, sid := range sids {
+		for _, query := range append(ScountCascadeQueries, ScountDeleteQuery) {
+			_, err = tx.ExecContext(ctx, query, sid)
+			if err != nil {
+				return 0, Error(err)
+			}
+		}
+	}
+	return len(sids), nil
+}
+
+// UpdateOne modifies exactly 1 scount from `scounts` collection. Change
+// of owner promotes the new owner and demotes the old owner to an admin
+// within the same transaction. If the new owner is not a member of the
+// scount, then db.ErrConflict.
 func (colln ScountCollection) UpdateOne(
 	ctx context.Context,
 	id *db.ScountId,
@@ -114,20 +263,50 @@ func (colln ScountCollection) UpdateOne(
 	if err != nil {
 		return err
 	}
-	// execute query
-	res, err := colln.DB.ExecContext(ctx, query, args...)
+	_, err = Tx[struct{}](ctx, colln.DB, func(tx Querier) (struct{}, error) {
+		var zero struct{}
+		// execute query
+		res, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return zero, Error(err)
+		}
+		// expect at least 1 row to be updated
+		count, err := res.RowsAffected()
+		if err != nil {
+			return zero, err
+		}
+		if count == 0 {
+			return zero, db.ErrNoRows
+		}
+		// owner unchanged
+		if setter.Owner == "" {
+			return zero, nil
+		}
+		return zero, colln.transferOwner(ctx, tx, id.Sid, setter.Owner)
+	})
+	// all good
+	return err
+}
+
+// transferOwner demotes the owner of scount sid to an admin and
+// promotes member uid to the owner within tx.
+func (colln ScountCollection) transferOwner(ctx context.Context, tx Querier, sid, uid string) error {
+	_, err := tx.ExecContext(ctx, ScountDemoteOwnerQuery, sid)
+	if err != nil {
+		return Error(err)
+	}
+	res, err := tx.ExecContext(ctx, ScountPromoteOwnerQuery, sid, uid)
 	if err != nil {
 		return Error(err)
 	}
-	// expect at least 1 row to be updated
 	count, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
+	// new owner not a member
 	if count == 0 {
-		return db.ErrNoRows
+		return db.ErrConflict
 	}
-	// all good
 	return nil
 }
 
@@ -148,6 +327,11 @@ func (colln ScountCollection) buildUpdateQuery(
 		cols = append(cols, "title")
 		args = append(args, setter.Title)
 	}
+	// nothing to set: touch the row to report existence
+	if len(cols) == 0 {
+		cols = append(cols, "sid")
+		args = append(args, id.Sid)
+	}
 	// construct
 	buf := new(bytes.Buffer)
 	err := ScountUpdateTemplate.Execute(buf, cols)
@@ -169,7 +353,7 @@ func (colln ScountCollection) FindOne(
 	}
 	var scount db.Scount
 	err = colln.DB.QueryRowContext(ctx, ScountSelectQuery, id.Sid).
-		Scan(&scount.Sid, &scount.Owner, &scount.Title, &scount.Description)
+		Scan(&scount.Sid, &scount.Owner, &scount.Title, &scount.Description, &scount.Currency)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			err = db.ErrNoRows
@@ -191,7 +375,7 @@ func (colln ScountCollection) Insert(ctx context.Context, scounts ...db.Scount)
 	if len(scounts) == 0 {
 		return db.ErrNoRows
 	}
-	_, err := Tx[struct{}](ctx, colln.DB, func(tx *sql.Tx) (struct{}, error) {
+	_, err := Tx[struct{}](ctx, colln.DB, func(tx Querier) (struct{}, error) {
 		var zero struct{}
 		// prepare insert query
 		stmt, err := tx.PrepareContext(ctx, ScountInsertQuery)
@@ -202,7 +386,7 @@ func (colln ScountCollection) Insert(ctx context.Context, scounts ...db.Scount)
 		defer stmt.Close()
 		// insert every scount
 		for _, s := range scounts {
-			res, err := stmt.ExecContext(ctx, s.Sid, s.Owner, s.Title, s.Description)
+			res, err := stmt.ExecContext(ctx, s.Sid, s.Owner, s.Title, s.Description, s.Currency)
 			if err != nil {
 				return zero, Error(err)
 			}
@@ -229,17 +413,16 @@ func (colln ScountCollection) Find(
 	projector *db.Projector,
 ) (list *db.Iterable[db.Scount], err error) {
 	args := colln.buildArgs(filter)
-	counter, finder, err := colln.buildSelectQuery(projector)
+	query, err := colln.buildSelectQuery(projector, len(args))
 	if err != nil {
 		return
 	}
 	iterator := func(yield func(db.Scount) bool) (int, error) {
-		return Tx[int](ctx, colln.DB, func(tx *sql.Tx) (int, error) {
+		return Tx[int](ctx, colln.DB, func(tx Querier) (int, error) {
 			return queryData[db.Scount]{
 				context: ctx,
 				sqldb:   tx,
-				counter: counter,
-				finder:  finder,
+				query:   query,
 				args:    args,
 				scanner: colln.scanOne,
 			}.iterator(yield)
@@ -251,36 +434,21 @@ func (colln ScountCollection) Find(
 // scanOne scans one scount from rows and returns associated data.
 func (colln ScountCollection) scanOne(rows *sql.Rows) (s db.Scount, err error) {
 	var scount db.Scount
-	err = rows.Scan(&scount.Sid, &scount.Owner, &scount.Title, &scount.Description)
+	err = rows.Scan(
+		&scount.Sid, &scount.Owner, &scount.Title, &scount.Description, &scount.Currency,
+		(*nullTime)(&scount.Deleted),
+	)
 	if err != nil {
 		return
 	}
 	return scount, nil
 }
 
-// buildSelectQuery constructs scount select query using
-// provided filter, projector and SCountSelectTemplate.
-func (colln ScountCollection) buildSelectQuery(projector *db.Projector) (string, string, error) {
-	// TODO: projector.Order[i] NOT IN db.ScountAllowedCols -> db.ErrInvalidColumn
-	if projector == nil {
-		projector = new(db.Projector)
-	}
-	// construct count query
-	buf := new(bytes.Buffer)
-	err := ScountSelectTemplate.ExecuteTemplate(buf, "count", projector)
-	if err != nil {
-		log.Println("tmpl exec scount-select: ", err)
-		return "", "", err
-	}
-	counter := buf.String()
-	// construct find query
-	buf.Reset()
-	err = ScountSelectTemplate.ExecuteTemplate(buf, "find", projector)
-	if err != nil {
-		return "", "", err
-	}
-	finder := buf.String()
-	return counter, finder, nil
+// buildSelectQuery constructs scount select query using provided
+// projector and ScountSelectTemplate, following argc filter args. Sorting
+// on any column not in db.ScountAllowedCols gives db.ErrInvalidColumn.
+func (colln ScountCollection) buildSelectQuery(projector *db.Projector, argc int) (selectQuery, error) {
+	return buildSelect(ScountSelectTemplate, projector, db.ScountAllowedCols, db.ScountKeyCols, argc)
 }
 
 // buildArgs constructs sql dollar argument values for executing the query.
@@ -294,8 +462,51 @@ func (colln ScountCollection) buildArgs(filter *db.ScountFilter) []any {
 	args = append(args, filter.Uid == "", filter.Uid)
 	args = append(args, filter.Owner == "", filter.Owner)
 	args = append(args, filter.Title == "", filter.Title)
+	args = append(args, filter.Member == "", filter.Member)
+	args = append(args, filter.Trash)
 	return args
 }
 
+// Balances computes the balance of every member of scount by sid. If no
+// such scount exists, then db.ErrNoRows.
+func (colln ScountCollection) Balances(ctx context.Context, sid string) ([]db.Balance, error) {
+	return Tx[[]db.Balance](ctx, colln.DB, func(tx Querier) ([]db.Balance, error) {
+		var exists bool
+		err := tx.QueryRowContext(ctx, ScountExistsQuery, sid).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, db.ErrNoRows
+		}
+		rows, err := tx.QueryContext(ctx, ScountBalanceQuery, sid)
+		if err != nil {
+			return nil, Error(err)
+		}
+		defer rows.Close()
+		balances := make([]db.Balance, 0)
+		for rows.Next() {
+			var (
+				b        db.Balance
+				currency money.Currency
+			)
+			err = rows.Scan(&b.Uid, &currency, &b.Paid, &b.Owed, &b.Sent, &b.Received)
+			if err != nil {
+				return nil, err
+			}
+			b.Paid.Currency = currency
+			b.Owed.Currency = currency
+			b.Sent.Currency = currency
+			b.Received.Currency = currency
+			balances = append(balances, b)
+		}
+		return balances, rows.Err()
+	})
+}
+
 // compile-time assertion
-var _ db.Collection[db.Scount, db.ScountFilter, db.ScountUpdater, db.ScountId] = ScountCollection{}
+var _ interface {
+	db.Collection[db.Scount, db.ScountFilter, db.ScountUpdater, db.ScountId]
+	db.Trash[db.ScountId]
+	Balances(ctx context.Context, sid string) ([]db.Balance, error)
+} = ScountCollection{}
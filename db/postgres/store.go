@@ -1,11 +1,16 @@
 package postgres
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"log"
+	"slices"
 	"strings"
+	"text/template"
+	"time"
 
 	"github.com/manojnakp/scount/db"
 	"github.com/manojnakp/scount/db/internal"
@@ -16,20 +21,46 @@ import (
 // NewStore constructs a [db.Store] from a SQL (postgres supported)
 // database connection handle.
 func NewStore(DB *sql.DB) *db.Store {
+	return newStore(DB)
+}
+
+// newStore constructs a [db.Store] over the database handle DB.
+func newStore(DB Querier) *db.Store {
 	return &db.Store{
-		Users:   UserCollection{DB},
-		Scounts: ScountCollection{DB},
-		Members: MemberCollection{DB},
+		Users:       UserCollection{DB},
+		Scounts:     ScountCollection{DB},
+		Members:     MemberCollection{DB},
+		Expenses:    ExpenseCollection{DB},
+		Settlements: SettlementCollection{DB},
+		Invites:     InviteCollection{DB},
+		Activities:  ActivityCollection{DB},
+		Transact:    transact(DB),
 	}
 }
 
 // Open dials an SQL connection using POSTGRES connection uri and
-// constructs a [db.Store]. Wraps over NewStore.
-func Open(uri string) (*db.Store, error) {
+// constructs a [db.Store], checking or applying pending migrations as
+// per mode. Wraps over NewStore.
+func Open(uri string, mode MigrateMode) (*db.Store, error) {
 	sqldb, err := sql.Open("postgres", uri)
 	if err != nil {
 		return nil, err
 	}
+	ctx := context.Background()
+	switch mode {
+	case MigrateCheck:
+		var pending []Migration
+		pending, err = Pending(ctx, sqldb)
+		if err == nil && len(pending) != 0 {
+			err = fmt.Errorf("%w: %d from %s", ErrPendingMigrations, len(pending), pending[0])
+		}
+	case MigrateApply:
+		_, err = Migrate(ctx, sqldb)
+	}
+	if err != nil {
+		_ = sqldb.Close()
+		return nil, err
+	}
 	return NewStore(sqldb), nil
 }
 
@@ -66,12 +97,42 @@ func Error(err error) error {
 	return err
 }
 
+// nullTime is a time that scans NULL as the zero time.
+type nullTime time.Time
+
+// Scan implements sql.Scanner on nullTime.
+func (t *nullTime) Scan(src any) error {
+	var nt sql.NullTime
+	err := nt.Scan(src)
+	if err != nil {
+		return err
+	}
+	*t = nullTime(nt.Time)
+	return nil
+}
+
 // Add defines addition behavior inside templates.
 func Add(x, y int) int {
 	return x + y
 }
 
-// JoinSorter defines `join` operation inside templates.
+// CheckOrder checks that projector sorts on the allowed columns only,
+// since columns are interpolated into queries. If not, then
+// db.ErrInvalidColumn.
+func CheckOrder(projector *db.Projector, allowed []db.Column) error {
+	if projector == nil {
+		return nil
+	}
+	for _, order := range projector.Order {
+		if !slices.Contains(allowed, order.Column) {
+			return fmt.Errorf("%w: %q", db.ErrInvalidColumn, order.Column)
+		}
+	}
+	return nil
+}
+
+// JoinSorter defines `join` operation inside templates. Columns are
+// quoted as identifiers, fallback is used as is.
 func JoinSorter(cols []db.Sorter, fallback string) string {
 	if len(cols) == 0 {
 		return fallback
@@ -80,13 +141,13 @@ func JoinSorter(cols []db.Sorter, fallback string) string {
 	const SEP string = ", "
 	order := cols[0]
 	var b strings.Builder
-	b.WriteString(order.Column.String())
+	b.WriteString(pq.QuoteIdentifier(order.Column.String()))
 	if order.Desc {
 		b.WriteString(DESC)
 	}
 	for _, order = range cols[1:] {
 		b.WriteString(SEP)
-		b.WriteString(order.Column.String())
+		b.WriteString(pq.QuoteIdentifier(order.Column.String()))
 		if order.Desc {
 			b.WriteString(DESC)
 		}
@@ -94,33 +155,196 @@ func JoinSorter(cols []db.Sorter, fallback string) string {
 	return b.String()
 }
 
-// Tx is a handy callback wrapper for executing transactions.
+// Querier is an SQL database handle, either *sql.DB or the *sql.Tx of a
+// unit of work (see db.Store.WithTx).
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Tx is a handy callback wrapper for executing transactions. Within the
+// transaction of a unit of work, callback runs in a savepoint instead.
 func Tx[T any](
 	ctx context.Context,
-	sqldb *sql.DB,
-	callback func(*sql.Tx) (T, error),
+	sqldb Querier,
+	callback func(Querier) (T, error),
 ) (t T, err error) {
-	if sqldb == nil {
-		err = db.ErrNil
-		return
+	switch sqldb := sqldb.(type) {
+	case *sql.DB:
+		if sqldb == nil {
+			break
+		}
+		tx, err := sqldb.BeginTx(ctx, nil)
+		if err != nil {
+			return t, err
+		}
+		defer tx.Rollback()
+		// execute callback
+		value, err := callback(tx)
+		if err != nil {
+			return t, err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return t, err
+		}
+		return value, nil
+	case *sql.Tx:
+		if sqldb == nil {
+			break
+		}
+		return savepoint(ctx, sqldb, callback)
 	}
-	tx, err := sqldb.BeginTx(ctx, nil)
+	err = db.ErrNil
+	return
+}
+
+// savepoint runs callback within a savepoint of tx, rolled back to if
+// callback fails, so that tx is still usable.
+func savepoint[T any](
+	ctx context.Context,
+	tx *sql.Tx,
+	callback func(Querier) (T, error),
+) (t T, err error) {
+	_, err = tx.ExecContext(ctx, "SAVEPOINT unit;")
 	if err != nil {
 		return
 	}
-	defer tx.Rollback()
-	// execute callback
 	value, err := callback(tx)
 	if err != nil {
+		_, _ = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT unit;")
+		_, _ = tx.ExecContext(ctx, "RELEASE SAVEPOINT unit;")
 		return
 	}
-	err = tx.Commit()
+	_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT unit;")
 	if err != nil {
 		return
 	}
 	return value, nil
 }
 
+// transact implements db.Store.Transact over sqldb.
+func transact(sqldb Querier) func(context.Context, func(*db.Store) error) error {
+	return func(ctx context.Context, callback func(*db.Store) error) error {
+		_, err := Tx[struct{}](ctx, sqldb, func(tx Querier) (struct{}, error) {
+			return struct{}{}, callback(newStore(tx))
+		})
+		return err
+	}
+}
+
+// selectQuery is a select query constructed from a projector, see
+// buildSelect.
+type selectQuery struct {
+	counter string // count query, empty if not counting
+	finder  string // find query
+	keyset  []any  // args of find query following the filter args
+	reverse bool   // rows found in reverse of the sort order
+}
+
+// buildSelect constructs select query using tmpl, which defines "count"
+// and "find" templates executed on selectData. Order of projector is
+// checked against allowed columns and extended with keys, see
+// db.KeysetOrder. The keyset (if any) is compared against the columns
+// of the order as dollar arguments following argc filter args.
+func buildSelect(
+	tmpl *template.Template,
+	projector *db.Projector,
+	allowed, keys []db.Column,
+	argc int,
+) (selectQuery, error) {
+	var query selectQuery
+	err := CheckOrder(projector, allowed)
+	if err != nil {
+		return query, err
+	}
+	if projector == nil {
+		projector = new(db.Projector)
+	}
+	data := selectData{
+		Order:  db.KeysetOrder(projector.Order, keys),
+		Paging: projector.Paging,
+	}
+	// keyset pagination
+	if paging := projector.Paging; paging != nil {
+		keyset, before := paging.After, false
+		if keyset == nil && paging.Before != nil {
+			keyset, before = paging.Before, true
+		}
+		if keyset != nil {
+			data.Where, err = keysetClause(data.Order, len(keyset), before, argc)
+			if err != nil {
+				return query, err
+			}
+			query.keyset = keyset
+			// fetch backwards from the keyset
+			if before {
+				data.Order = reverseOrder(data.Order)
+				query.reverse = true
+			}
+		}
+	}
+	// construct count query
+	buf := new(bytes.Buffer)
+	if projector.Count {
+		err = tmpl.ExecuteTemplate(buf, "count", data)
+		if err != nil {
+			return query, err
+		}
+		query.counter = buf.String()
+	}
+	// construct find query
+	buf.Reset()
+	err = tmpl.ExecuteTemplate(buf, "find", data)
+	if err != nil {
+		return query, err
+	}
+	query.finder = buf.String()
+	return query, nil
+}
+
+// selectData is the data for executing select query templates. Where is
+// the additional condition (if any) on the found rows.
+type selectData struct {
+	Order  []db.Sorter
+	Paging *db.Paging
+	Where  string
+}
+
+// keysetClause constructs the condition for rows strictly after (or
+// before) the keyset of n dollar arguments following argc args, in
+// order. Like `(a > $3 OR a = $3 AND b < $4)` for order `a, b DESC`.
+func keysetClause(order []db.Sorter, n int, before bool, argc int) (string, error) {
+	if n != len(order) {
+		return "", fmt.Errorf("%w: keyset of %d for %d columns", db.ErrInvalidData, n, len(order))
+	}
+	terms := make([]string, 0, len(order))
+	for i, sorter := range order {
+		var b strings.Builder
+		for j := 0; j < i; j++ {
+			fmt.Fprintf(&b, "%s = $%d AND ", pq.QuoteIdentifier(order[j].Column.String()), argc+j+1)
+		}
+		op := ">"
+		if sorter.Desc != before {
+			op = "<"
+		}
+		fmt.Fprintf(&b, "%s %s $%d", pq.QuoteIdentifier(sorter.Column.String()), op, argc+i+1)
+		terms = append(terms, b.String())
+	}
+	return "(" + strings.Join(terms, " OR ") + ")", nil
+}
+
+// reverseOrder gives the reverse of order.
+func reverseOrder(order []db.Sorter) []db.Sorter {
+	reverse := make([]db.Sorter, len(order))
+	for i, sorter := range order {
+		reverse[i] = db.Sorter{Column: sorter.Column, Desc: !sorter.Desc}
+	}
+	return reverse
+}
+
 // queryData is a convenience struct to capture context information
 // as an alternative to writing a closure.
 type queryData[T any] struct {
@@ -129,36 +353,52 @@ type queryData[T any] struct {
 		QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
 		QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
 	}
-	counter string
-	finder  string
+	query   selectQuery
 	args    []any
 	scanner func(*sql.Rows) (T, error)
 }
 
 // iterator is the iterator function for constructing [db.Iterable].
 // queryData struct is used to capture variables instead of writing
-// a closure (avoid callback hell).
+// a closure (avoid callback hell). Total is -1 if not counted.
 func (data queryData[T]) iterator(yield func(T) bool) (int, error) {
-	var total int
-	err := data.sqldb.QueryRowContext(data.context, data.counter, data.args...).
-		Scan(&total)
-	if err != nil {
-		return 0, err
+	total := -1
+	if data.query.counter != "" {
+		err := data.sqldb.QueryRowContext(data.context, data.query.counter, data.args...).
+			Scan(&total)
+		if err != nil {
+			return 0, err
+		}
 	}
-	rows, err := data.sqldb.QueryContext(data.context, data.finder, data.args...)
+	args := append(data.args[:len(data.args):len(data.args)], data.query.keyset...)
+	rows, err := data.sqldb.QueryContext(data.context, data.query.finder, args...)
 	if err != nil {
-		return 0, err
+		return total, Error(err)
 	}
 	defer rows.Close()
+	// rows in reverse are yielded once all are read
+	var buffer []T
 	for rows.Next() {
 		t, err := data.scanner(rows)
 		if err != nil {
 			return total, err
 		}
+		if data.query.reverse {
+			buffer = append(buffer, t)
+			continue
+		}
 		if !yield(t) {
 			break
 		}
 	}
 	err = rows.Err()
-	return total, err
+	if err != nil {
+		return total, err
+	}
+	for i := len(buffer) - 1; i >= 0; i-- {
+		if !yield(buffer[i]) {
+			break
+		}
+	}
+	return total, nil
 }
@@ -0,0 +1,64 @@
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/manojnakp/scount/db"
+	"github.com/manojnakp/scount/db/dbtest"
+	"github.com/manojnakp/scount/db/postgres"
+)
+
+// TestStore runs the conformance suite against the postgres database at
+// TEST_DB_URI, every test in a schema of its own.
+func TestStore(t *testing.T) {
+	uri := os.Getenv("TEST_DB_URI")
+	if uri == "" {
+		t.Skip("TEST_DB_URI not set")
+	}
+	admin, err := sql.Open("postgres", uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = admin.Close() })
+	count := 0
+	dbtest.Run(t, func(t *testing.T) *db.Store {
+		count++
+		schema := fmt.Sprintf("scount_test_%d_%d", os.Getpid(), count)
+		_, err := admin.Exec("CREATE SCHEMA " + schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _, _ = admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+		sqldb, err := sql.Open("postgres", searchPath(uri, schema))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = sqldb.Close() })
+		_, err = postgres.Migrate(context.Background(), sqldb)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return postgres.NewStore(sqldb)
+	})
+}
+
+// searchPath sets the search_path of connections by uri to schema.
+func searchPath(uri, schema string) string {
+	if !strings.Contains(uri, "://") {
+		return uri + " search_path=" + schema
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
@@ -6,8 +6,8 @@ import (
 	"database/sql"
 	"encoding/base64"
 	"errors"
-	"html/template"
 	"log"
+	"text/template"
 
 	"github.com/manojnakp/scount/db"
 	"github.com/manojnakp/scount/db/internal"
@@ -22,6 +22,58 @@ VALUES ($1, $2, $3, $4);`
 const UserDeleteQuery = `
 DELETE FROM users WHERE uid = $1;`
 
+// UserOwnsQuery is a query statement for checking whether the user by
+// uid owns any scount not in the trash.
+const UserOwnsQuery = `
+SELECT EXISTS (SELECT 1 FROM scounts WHERE owner = $1 AND deleted_at IS NULL);`
+
+// UserTrashQuery is a query statement for fetching sids of the scounts
+// in the trash owned by the user by uid.
+const UserTrashQuery = `
+SELECT sid FROM scounts
+WHERE owner = $1 AND deleted_at IS NOT NULL;`
+
+// UserOpenBalanceQuery is a query statement for checking whether the
+// user by uid has a non-zero balance in any scount, leaving out the
+// expenses in the trash.
+const UserOpenBalanceQuery = `
+SELECT EXISTS (
+	SELECT 1 FROM members m
+	WHERE m.uid = $1
+	AND (SELECT COALESCE(sum(base_amount), 0) FROM expenses e
+		WHERE e.sid = m.sid AND e.payer = m.uid AND e.deleted_at IS NULL)
+	+ (SELECT COALESCE(sum(base_amount), 0) FROM settlements st
+		WHERE st.sid = m.sid AND st.payer = m.uid)
+	- (SELECT COALESCE(sum(s.base_amount), 0) FROM expense_shares s
+		JOIN expenses e USING (sid, eid)
+		WHERE s.sid = m.sid AND s.uid = m.uid AND e.deleted_at IS NULL)
+	- (SELECT COALESCE(sum(base_amount), 0) FROM settlements st
+		WHERE st.sid = m.sid AND st.payee = m.uid) <> 0
+);`
+
+// UserAnonymizeQuery is a query statement for turning the memberships
+// of the user by uid with expenses or settlements into guests named $2.
+const UserAnonymizeQuery = `
+UPDATE members SET guest = TRUE, name = $2, role = 'member'
+WHERE uid = $1 AND (
+	EXISTS (SELECT 1 FROM expenses e
+		WHERE e.sid = members.sid AND e.payer = members.uid)
+	OR EXISTS (SELECT 1 FROM expense_shares s
+		WHERE s.sid = members.sid AND s.uid = members.uid)
+	OR EXISTS (SELECT 1 FROM settlements st
+		WHERE st.sid = members.sid AND members.uid IN (st.payer, st.payee))
+);`
+
+// UserLeaveQuery is a query statement for removing the remaining
+// memberships of the user by uid.
+const UserLeaveQuery = `
+DELETE FROM members WHERE uid = $1 AND NOT guest;`
+
+// UserRevokeQuery is a query statement for deleting the invites created
+// by the user by uid.
+const UserRevokeQuery = `
+DELETE FROM invites WHERE creator = $1;`
+
 // UserSelectQuery is a query statement for fetching single user by uid.
 const UserSelectQuery = `
 SELECT uid, email, username, password
@@ -69,7 +121,8 @@ var UserSelectTemplate = template.Must(template.New("user-select").
 {{ define "find" }}
 	SELECT DISTINCT uid, email, username, password
 	{{ template "filter" }}
-	{{ template "sort" }}
+	{{ with .Where }}AND {{ . }}{{ end }}
+	{{ template "sort" . }}
 	{{ with .Paging }}
 		LIMIT {{ .Limit }}
 		OFFSET {{ .Offset }}
@@ -78,15 +131,13 @@ var UserSelectTemplate = template.Must(template.New("user-select").
 
 {{ define "count" }}
 	SELECT count(*) AS total
-	{{ template "filter" }}
-	GROUP BY uid
-	{{ template "sort" }};
+	{{ template "filter" }};
 {{ end }}
 `))
 
 // UserCollection provides a convenient way to interact with `users` table.
 type UserCollection struct {
-	DB *sql.DB // underlying database handle
+	DB Querier // underlying database handle
 }
 
 // Insert adds one or more users to colln. db.ErrNoRows if no users to insert.
@@ -94,7 +145,7 @@ func (colln UserCollection) Insert(ctx context.Context, users ...db.User) error
 	if len(users) == 0 {
 		return db.ErrNoRows
 	}
-	_, err := Tx[struct{}](ctx, colln.DB, func(tx *sql.Tx) (struct{}, error) {
+	_, err := Tx[struct{}](ctx, colln.DB, func(tx Querier) (struct{}, error) {
 		var zero struct{}
 		// prepare insert query
 		stmt, err := tx.PrepareContext(ctx, UserInsertQuery)
@@ -126,22 +177,60 @@ func (colln UserCollection) Insert(ctx context.Context, users ...db.User) error
 }
 
 // DeleteOne removes exactly 1 user from `users` collection based on id.
+// If the user owns scounts, then db.ErrOwnsScounts. If the user has an
+// open balance, then db.ErrOpenBalance. Scounts of the user in the trash
+// are purged and memberships with history are left as guests, see
+// db.Store.
 func (colln UserCollection) DeleteOne(ctx context.Context, id *db.UserId) error {
 	if id == nil {
 		return db.ErrNil
 	}
-	res, err := colln.DB.ExecContext(ctx, UserDeleteQuery, id.Uid)
-	if err != nil {
-		return Error(err)
-	}
-	count, err := res.RowsAffected()
-	if err != nil {
-		return err
-	}
-	if count == 0 {
-		return db.ErrNoRows
-	}
-	return nil
+	_, err := Tx[struct{}](ctx, colln.DB, func(tx Querier) (struct{}, error) {
+		var zero struct{}
+		_, err := ScountCollection{tx}.purge(ctx, tx, UserTrashQuery, id.Uid)
+		if err != nil {
+			return zero, err
+		}
+		for _, check := range []struct {
+			query string
+			err   error
+		}{
+			{UserOwnsQuery, db.ErrOwnsScounts},
+			{UserOpenBalanceQuery, db.ErrOpenBalance},
+		} {
+			var refused bool
+			err := tx.QueryRowContext(ctx, check.query, id.Uid).Scan(&refused)
+			if err != nil {
+				return zero, Error(err)
+			}
+			if refused {
+				return zero, check.err
+			}
+		}
+		_, err = tx.ExecContext(ctx, UserAnonymizeQuery, id.Uid, db.FormerMember)
+		if err != nil {
+			return zero, Error(err)
+		}
+		for _, query := range []string{UserLeaveQuery, UserRevokeQuery} {
+			_, err = tx.ExecContext(ctx, query, id.Uid)
+			if err != nil {
+				return zero, Error(err)
+			}
+		}
+		res, err := tx.ExecContext(ctx, UserDeleteQuery, id.Uid)
+		if err != nil {
+			return zero, Error(err)
+		}
+		count, err := res.RowsAffected()
+		if err != nil {
+			return zero, err
+		}
+		if count == 0 {
+			return zero, db.ErrNoRows
+		}
+		return zero, nil
+	})
+	return err
 }
 
 // UpdatePassword modifies the password of the matching user record as specified.
@@ -278,17 +367,16 @@ func (colln UserCollection) Find(
 	projector *db.Projector,
 ) (list *db.Iterable[db.User], err error) {
 	args := colln.buildArgs(filter)
-	counter, finder, err := colln.buildSelectQuery(projector)
+	query, err := colln.buildSelectQuery(projector, len(args))
 	if err != nil {
 		return
 	}
 	iterator := func(yield func(db.User) bool) (int, error) {
-		return Tx[int](ctx, colln.DB, func(tx *sql.Tx) (int, error) {
+		return Tx[int](ctx, colln.DB, func(tx Querier) (int, error) {
 			return queryData[db.User]{
 				context: ctx,
 				sqldb:   tx,
-				counter: counter,
-				finder:  finder,
+				query:   query,
 				args:    args,
 				scanner: colln.scanOne,
 			}.iterator(yield)
@@ -313,28 +401,11 @@ func (colln UserCollection) scanOne(rows *sql.Rows) (u db.User, err error) {
 	return user, err
 }
 
-// buildSelectQuery constructs user select query using
-// provided filter, projector and UserSelectTemplate.
-func (colln UserCollection) buildSelectQuery(projector *db.Projector) (string, string, error) {
-	// TODO: projector.Order[i] NOT IN db.UserAllowedCols -> db.ErrInvalidColumn
-	if projector == nil {
-		projector = new(db.Projector)
-	}
-	// construct count query
-	buf := new(bytes.Buffer)
-	err := UserSelectTemplate.ExecuteTemplate(buf, "count", projector)
-	if err != nil {
-		return "", "", err
-	}
-	counter := buf.String()
-	// construct find query
-	buf.Reset()
-	err = UserSelectTemplate.ExecuteTemplate(buf, "find", projector)
-	if err != nil {
-		return "", "", err
-	}
-	finder := buf.String()
-	return counter, finder, nil
+// buildSelectQuery constructs user select query using provided
+// projector and UserSelectTemplate, following argc filter args. Sorting
+// on any column not in db.UserAllowedCols gives db.ErrInvalidColumn.
+func (colln UserCollection) buildSelectQuery(projector *db.Projector, argc int) (selectQuery, error) {
+	return buildSelect(UserSelectTemplate, projector, db.UserAllowedCols, db.UserKeyCols, argc)
 }
 
 // buildArgs constructs sql dollar argument values for executing the query.
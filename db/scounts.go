@@ -1,11 +1,22 @@
 package db
 
+import (
+	"time"
+
+	"github.com/manojnakp/scount/money"
+)
+
 // Scount depicts the scount object for interaction with scounts datastore.
+// Currency is the default currency of the scount, into which amounts in
+// other currencies are converted. It is fixed once the scount is created.
+// Deleted is the time the scount was moved to the trash, zero if not.
 type Scount struct {
 	Sid         string
 	Owner       string
 	Title       string
 	Description string
+	Currency    money.Currency
+	Deleted     time.Time
 }
 
 // ScountId is the 'id' type for scount collection. Sid is the primary key
@@ -14,12 +25,17 @@ type ScountId struct {
 	Sid string
 }
 
-// ScountFilter provides fields for filtering the users.
+// ScountFilter provides fields for filtering the scounts. Both Uid and
+// Member match scounts having the user as a member, so that Member can
+// restrict the scounts to the ones visible to a user. Scounts in the
+// trash are matched only if Trash, and the others only if not.
 type ScountFilter struct {
-	Sid   string
-	Uid   string
-	Owner string
-	Title string
+	Sid    string
+	Uid    string
+	Owner  string
+	Title  string
+	Member string
+	Trash  bool
 }
 
 // ScountUpdater provides fields for updating scounts.
@@ -27,3 +43,44 @@ type ScountUpdater struct {
 	Owner string
 	Title string
 }
+
+// ScountAllowedCols is a list of columns allowed for sorting.
+var ScountAllowedCols = []Column{"sid", "owner", "title"}
+
+// ScountKeyCols is a list of columns that identify a scount uniquely.
+var ScountKeyCols = []Column{"sid"}
+
+// Key implements Keyed on Scount.
+func (s Scount) Key(c Column) any {
+	switch c {
+	case "sid":
+		return s.Sid
+	case "owner":
+		return s.Owner
+	case "title":
+		return s.Title
+	}
+	return nil
+}
+
+// Balance is the net position of a member within a scount. Paid is the
+// total of expenses paid by the member and Owed is the total of shares
+// of expenses owed by the member. Sent and Received are the totals of
+// settlements paid and received by the member. All of them are in the
+// currency of the scount, converted at the rates recorded on every
+// expense and settlement.
+type Balance struct {
+	Uid      string
+	Paid     money.Amount
+	Owed     money.Amount
+	Sent     money.Amount
+	Received money.Amount
+}
+
+// Net gives the net position of the member, that is paid minus owed
+// accounting for settlements. Positive means the member is owed money
+// by others.
+func (b Balance) Net() money.Amount {
+	net := b.Paid.Minor + b.Sent.Minor - b.Owed.Minor - b.Received.Minor
+	return money.New(net, b.Paid.Currency)
+}
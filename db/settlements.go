@@ -0,0 +1,60 @@
+package db
+
+import "github.com/manojnakp/scount/money"
+
+// Settlement depicts the settlement (payment between members) object for
+// interactions with the settlements datastore. Base is the Amount
+// converted into the currency of the scount at Rate.
+type Settlement struct {
+	Stid   string // id
+	Sid    string // scount to which settlement belongs
+	Payer  string // member who paid
+	Payee  string // member who received
+	Amount money.Amount
+	Rate   money.Rate
+	Base   money.Amount
+}
+
+// SettlementId is the 'id' type for settlement collection. Both sid and
+// stid determine a settlement uniquely.
+type SettlementId struct {
+	Sid  string
+	Stid string
+}
+
+// SettlementFilter provides fields for filtering the settlements. Member
+// matches either the payer or the payee.
+type SettlementFilter struct {
+	Sid    string
+	Stid   string
+	Payer  string
+	Payee  string
+	Member string
+}
+
+// SettlementUpdater provides fields necessary for update operation for
+// settlement record.
+type SettlementUpdater struct{}
+
+// SettlementAllowedCols is a list of columns allowed for sorting.
+var SettlementAllowedCols = []Column{"sid", "stid", "payer", "payee", "amount"}
+
+// SettlementKeyCols is a list of columns that identify a settlement uniquely.
+var SettlementKeyCols = []Column{"sid", "stid"}
+
+// Key implements Keyed on Settlement.
+func (s Settlement) Key(c Column) any {
+	switch c {
+	case "sid":
+		return s.Sid
+	case "stid":
+		return s.Stid
+	case "payer":
+		return s.Payer
+	case "payee":
+		return s.Payee
+	case "amount":
+		return s.Amount.Minor
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"text/template"
+
+	"github.com/manojnakp/scount/db"
+)
+
+// ActivityInsertQuery is query statement for inserting single activity.
+// Empty values are stored as NULL.
+const ActivityInsertQuery = `
+INSERT INTO activities (sid, aid, actor, kind, target, time, before_value, after_value)
+VALUES (?1, ?2, ?3, ?4, ?5, ?6, NULLIF(?7, ''), NULLIF(?8, ''));`
+
+// ActivitySelectQuery is a query statement for fetching single activity by id.
+const ActivitySelectQuery = `
+SELECT sid, aid, actor, kind, target, time, before_value, after_value
+FROM activities
+WHERE sid = ?1 AND aid = ?2;`
+
+// NO UPDATE ALLOWED
+
+// ActivitySelectTemplate is a query template for finding matching
+// activities from ActivityCollection.
+var ActivitySelectTemplate = template.Must(template.New("activity-select").
+	Funcs(template.FuncMap{"join": JoinSorter}).
+	Parse(`
+{{ define "filter" }}
+	FROM activities
+	WHERE (?1 OR sid = ?2)
+	AND (?3 OR aid = ?4)
+	AND (?5 OR actor = ?6)
+	AND (?7 OR kind = ?8)
+	AND (?9 OR target = ?10)
+{{ end }}
+
+{{ define "find" }}
+	SELECT sid, aid, actor, kind, target, time, before_value, after_value
+	{{ template "filter" }}
+	{{ with .Where }}AND {{ . }}{{ end }}
+	ORDER BY {{ join .Order "aid" }}
+	{{ with .Paging }}
+		LIMIT {{ .Limit }}
+		OFFSET {{ .Offset }}
+	{{ end }};
+{{ end }}
+
+{{ define "count" }}
+	SELECT count(*) AS total
+	{{ template "filter" }};
+{{ end }}
+`))
+
+// ActivityCollection provides a convenient way to interact with
+// `activities` table.
+type ActivityCollection struct {
+	DB Querier
+}
+
+// Insert adds one or more activities to colln. db.ErrNoRows if no
+// activities to insert.
+func (colln ActivityCollection) Insert(ctx context.Context, activities ...db.Activity) error {
+	if len(activities) == 0 {
+		return db.ErrNoRows
+	}
+	_, err := Tx[struct{}](ctx, colln.DB, func(tx Querier) (struct{}, error) {
+		var zero struct{}
+		// prepare insert query
+		stmt, err := tx.PrepareContext(ctx, ActivityInsertQuery)
+		if err != nil {
+			log.Println("invalid stmt to prepare: ", err)
+			return zero, err
+		}
+		defer stmt.Close()
+		// insert every activity
+		for _, a := range activities {
+			_, err := stmt.ExecContext(
+				ctx, a.Sid, a.Aid, a.Actor, a.Kind, a.Target,
+				unixTime(a.Time), string(a.Before), string(a.After),
+			)
+			if err != nil {
+				return zero, Error(err)
+			}
+		}
+		return zero, nil
+	})
+	return err
+}
+
+// DeleteOne is not supported on `activities` collection.
+func (colln ActivityCollection) DeleteOne(context.Context, *db.ActivityId) error {
+	return errors.ErrUnsupported
+}
+
+// UpdateOne is not supported on `activities` collection.
+func (colln ActivityCollection) UpdateOne(context.Context, *db.ActivityId, *db.ActivityUpdater) error {
+	return errors.ErrUnsupported
+}
+
+// FindOne fetches activity from colln by id.
+func (colln ActivityCollection) FindOne(ctx context.Context, id *db.ActivityId) (a db.Activity, err error) {
+	if id == nil {
+		err = db.ErrNil
+		return
+	}
+	var activity db.Activity
+	err = colln.DB.QueryRowContext(ctx, ActivitySelectQuery, id.Sid, id.Aid).Scan(
+		&activity.Sid, &activity.Aid, &activity.Actor, &activity.Kind, &activity.Target,
+		(*unixTime)(&activity.Time), (*[]byte)(&activity.Before), (*[]byte)(&activity.After),
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = db.ErrNoRows
+		}
+		return
+	}
+	return activity, nil
+}
+
+// Find fetches all the activities from colln subject to filter and
+// projection options specified.
+func (colln ActivityCollection) Find(
+	ctx context.Context,
+	filter *db.ActivityFilter,
+	projector *db.Projector,
+) (list *db.Iterable[db.Activity], err error) {
+	args := colln.buildArgs(filter)
+	query, err := colln.buildSelectQuery(projector, len(args))
+	if err != nil {
+		return
+	}
+	iterator := func(yield func(db.Activity) bool) (int, error) {
+		return Tx[int](ctx, colln.DB, func(tx Querier) (int, error) {
+			return queryData[db.Activity]{
+				context: ctx,
+				sqldb:   tx,
+				query:   query,
+				args:    args,
+				scanner: colln.scanOne,
+			}.iterator(yield)
+		})
+	}
+	return db.NewIterable(iterator), nil
+}
+
+// scanOne scans one activity from rows and returns associated data.
+func (colln ActivityCollection) scanOne(rows *sql.Rows) (a db.Activity, err error) {
+	var activity db.Activity
+	err = rows.Scan(
+		&activity.Sid, &activity.Aid, &activity.Actor, &activity.Kind, &activity.Target,
+		(*unixTime)(&activity.Time), (*[]byte)(&activity.Before), (*[]byte)(&activity.After),
+	)
+	if err != nil {
+		return
+	}
+	return activity, nil
+}
+
+// buildSelectQuery constructs activity select query using provided
+// projector and ActivitySelectTemplate, following argc filter args.
+// Sorting on any column not in db.ActivityAllowedCols gives
+// db.ErrInvalidColumn.
+func (colln ActivityCollection) buildSelectQuery(projector *db.Projector, argc int) (selectQuery, error) {
+	// keysets carry times, stored as unix micros
+	if projector != nil && projector.Paging != nil {
+		order := db.KeysetOrder(projector.Order, db.ActivityKeyCols)
+		p, paging := *projector, *projector.Paging
+		paging.After = unixKeyset(paging.After, order, "time")
+		paging.Before = unixKeyset(paging.Before, order, "time")
+		p.Paging = &paging
+		projector = &p
+	}
+	return buildSelect(ActivitySelectTemplate, projector, db.ActivityAllowedCols, db.ActivityKeyCols, argc)
+}
+
+// buildArgs constructs sql numbered argument values for executing the query.
+func (colln ActivityCollection) buildArgs(filter *db.ActivityFilter) []any {
+	if filter == nil {
+		filter = new(db.ActivityFilter)
+	}
+	args := make([]any, 0)
+	// WHERE clause
+	args = append(args, filter.Sid == "", filter.Sid)
+	args = append(args, filter.Aid == "", filter.Aid)
+	args = append(args, filter.Actor == "", filter.Actor)
+	args = append(args, filter.Kind == "", filter.Kind)
+	args = append(args, filter.Target == "", filter.Target)
+	return args
+}
+
+// compile-time assertion
+var _ db.Collection[db.Activity, db.ActivityFilter, db.ActivityUpdater, db.ActivityId] = ActivityCollection{}
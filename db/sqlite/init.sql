@@ -0,0 +1,127 @@
+CREATE TABLE IF NOT EXISTS users
+(
+    uid      TEXT NOT NULL,
+    email    TEXT NOT NULL,
+    username TEXT NOT NULL,
+    password TEXT NOT NULL,
+    PRIMARY KEY (uid),
+    UNIQUE (email)
+);
+
+CREATE TABLE IF NOT EXISTS scounts
+(
+    sid         TEXT NOT NULL,
+    owner       TEXT NOT NULL,
+    title       TEXT NOT NULL,
+    description TEXT NOT NULL,
+    currency    TEXT NOT NULL DEFAULT 'EUR',
+    FOREIGN KEY (owner) REFERENCES users (uid),
+    PRIMARY KEY (sid),
+    CHECK (currency GLOB '[A-Z][A-Z][A-Z]')
+);
+
+-- guest members have no row in users, hence no foreign key on uid
+CREATE TABLE IF NOT EXISTS members
+(
+    sid   TEXT    NOT NULL,
+    uid   TEXT    NOT NULL,
+    role  TEXT    NOT NULL DEFAULT 'member',
+    name  TEXT    NOT NULL DEFAULT '',
+    guest BOOLEAN NOT NULL DEFAULT FALSE,
+    FOREIGN KEY (sid) REFERENCES scounts (sid),
+    PRIMARY KEY (sid, uid),
+    CHECK (role IN ('owner', 'admin', 'member', 'viewer')),
+    CHECK (NOT guest OR name <> ''),
+    CHECK (NOT guest OR role <> 'owner')
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS members_owner_idx ON members (sid) WHERE role = 'owner';
+
+-- rates are exact decimals, kept as text
+CREATE TABLE IF NOT EXISTS expenses
+(
+    sid           TEXT    NOT NULL,
+    eid           TEXT    NOT NULL,
+    payer         TEXT    NOT NULL,
+    title         TEXT    NOT NULL,
+    amount        INTEGER NOT NULL,
+    currency      TEXT    NOT NULL,
+    rate          TEXT    NOT NULL DEFAULT '1',
+    base_amount   INTEGER NOT NULL,
+    base_currency TEXT    NOT NULL,
+    mode          TEXT    NOT NULL DEFAULT 'equal',
+    FOREIGN KEY (sid) REFERENCES scounts (sid),
+    FOREIGN KEY (sid, payer) REFERENCES members (sid, uid),
+    PRIMARY KEY (sid, eid),
+    CHECK (amount > 0),
+    CHECK (currency GLOB '[A-Z][A-Z][A-Z]'),
+    CHECK (CAST(rate AS REAL) > 0),
+    CHECK (base_amount >= 0),
+    CHECK (base_currency GLOB '[A-Z][A-Z][A-Z]'),
+    CHECK (mode IN ('equal', 'exact', 'percent', 'shares'))
+);
+
+CREATE TABLE IF NOT EXISTS expense_shares
+(
+    sid         TEXT    NOT NULL,
+    eid         TEXT    NOT NULL,
+    uid         TEXT    NOT NULL,
+    weight      INTEGER NOT NULL,
+    amount      INTEGER NOT NULL,
+    base_amount INTEGER NOT NULL,
+    FOREIGN KEY (sid, eid) REFERENCES expenses (sid, eid) ON DELETE CASCADE,
+    FOREIGN KEY (sid, uid) REFERENCES members (sid, uid),
+    PRIMARY KEY (sid, eid, uid),
+    CHECK (weight >= 0),
+    CHECK (amount >= 0),
+    CHECK (base_amount >= 0)
+);
+
+CREATE INDEX IF NOT EXISTS expenses_payer_idx ON expenses (sid, payer);
+
+CREATE INDEX IF NOT EXISTS expense_shares_uid_idx ON expense_shares (sid, uid);
+
+CREATE TABLE IF NOT EXISTS settlements
+(
+    sid           TEXT    NOT NULL,
+    stid          TEXT    NOT NULL,
+    payer         TEXT    NOT NULL,
+    payee         TEXT    NOT NULL,
+    amount        INTEGER NOT NULL,
+    currency      TEXT    NOT NULL,
+    rate          TEXT    NOT NULL DEFAULT '1',
+    base_amount   INTEGER NOT NULL,
+    base_currency TEXT    NOT NULL,
+    FOREIGN KEY (sid) REFERENCES scounts (sid),
+    FOREIGN KEY (sid, payer) REFERENCES members (sid, uid),
+    FOREIGN KEY (sid, payee) REFERENCES members (sid, uid),
+    PRIMARY KEY (sid, stid),
+    CHECK (amount > 0),
+    CHECK (currency GLOB '[A-Z][A-Z][A-Z]'),
+    CHECK (CAST(rate AS REAL) > 0),
+    CHECK (base_amount >= 0),
+    CHECK (base_currency GLOB '[A-Z][A-Z][A-Z]'),
+    CHECK (payer <> payee)
+);
+
+-- expires is in microseconds since the unix epoch
+CREATE TABLE IF NOT EXISTS invites
+(
+    sid        TEXT    NOT NULL,
+    iid        TEXT    NOT NULL,
+    creator    TEXT    NOT NULL,
+    role       TEXT    NOT NULL DEFAULT 'member',
+    guest      TEXT,
+    expires    INTEGER NOT NULL,
+    single_use BOOLEAN NOT NULL DEFAULT FALSE,
+    uses       INTEGER NOT NULL DEFAULT 0,
+    FOREIGN KEY (sid) REFERENCES scounts (sid) ON DELETE CASCADE,
+    FOREIGN KEY (creator) REFERENCES users (uid),
+    FOREIGN KEY (sid, guest) REFERENCES members (sid, uid) ON DELETE CASCADE,
+    PRIMARY KEY (iid),
+    CHECK (role IN ('admin', 'member', 'viewer')),
+    CHECK (uses >= 0),
+    CHECK (guest IS NULL OR single_use)
+);
+
+CREATE INDEX IF NOT EXISTS invites_sid_idx ON invites (sid);
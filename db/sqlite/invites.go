@@ -0,0 +1,242 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"text/template"
+	"time"
+
+	"github.com/manojnakp/scount/db"
+)
+
+// InviteInsertQuery is query statement for inserting single invite.
+// Role defaults to member.
+const InviteInsertQuery = `
+INSERT INTO invites (sid, iid, creator, role, guest, expires, single_use, uses)
+VALUES (?1, ?2, ?3, COALESCE(NULLIF(?4, ''), 'member'), NULLIF(?5, ''), ?6, ?7, ?8);`
+
+// InviteDeleteQuery is a query statement for deleting single invite by id.
+const InviteDeleteQuery = `
+DELETE FROM invites
+WHERE iid = ?1 AND (?2 OR sid = ?3);`
+
+// InviteSelectQuery is a query statement for fetching single invite by id.
+const InviteSelectQuery = `
+SELECT sid, iid, creator, role, COALESCE(guest, ''), expires, single_use, uses
+FROM invites
+WHERE iid = ?1 AND (?2 OR sid = ?3);`
+
+// InviteUseQuery is a query statement for recording a single use of
+// an invite by id, provided it is neither expired nor used up.
+const InviteUseQuery = `
+UPDATE invites SET uses = uses + 1
+WHERE iid = ?1 AND (?2 OR sid = ?3)
+AND expires > ?4
+AND NOT (single_use AND uses > 0);`
+
+// NO UPDATE ALLOWED
+
+// InviteSelectTemplate is a query template for finding matching invites
+// from InviteCollection.
+var InviteSelectTemplate = template.Must(template.New("invite-select").
+	Funcs(template.FuncMap{"join": JoinSorter}).
+	Parse(`
+{{ define "filter" }}
+	FROM invites
+	WHERE (?1 OR sid = ?2)
+	AND (?3 OR iid = ?4)
+	AND (?5 OR creator = ?6)
+{{ end }}
+
+{{ define "find" }}
+	SELECT sid, iid, creator, role, COALESCE(guest, ''), expires, single_use, uses
+	{{ template "filter" }}
+	{{ with .Where }}AND {{ . }}{{ end }}
+	ORDER BY {{ join .Order "iid" }}
+	{{ with .Paging }}
+		LIMIT {{ .Limit }}
+		OFFSET {{ .Offset }}
+	{{ end }};
+{{ end }}
+
+{{ define "count" }}
+	SELECT count(*) AS total
+	{{ template "filter" }};
+{{ end }}
+`))
+
+// InviteCollection provides a convenient way to interact with `invites` table.
+type InviteCollection struct {
+	DB Querier
+}
+
+// Insert adds one or more invites to colln. db.ErrNoRows if no invites to insert.
+func (colln InviteCollection) Insert(ctx context.Context, invites ...db.Invite) error {
+	if len(invites) == 0 {
+		return db.ErrNoRows
+	}
+	_, err := Tx[struct{}](ctx, colln.DB, func(tx Querier) (struct{}, error) {
+		var zero struct{}
+		// prepare insert query
+		stmt, err := tx.PrepareContext(ctx, InviteInsertQuery)
+		if err != nil {
+			log.Println("invalid stmt to prepare: ", err)
+			return zero, err
+		}
+		defer stmt.Close()
+		// insert every invite
+		for _, i := range invites {
+			_, err := stmt.ExecContext(
+				ctx, i.Sid, i.Iid, i.Creator, i.Role, i.Guest,
+				unixTime(i.Expires), i.SingleUse, i.Uses,
+			)
+			if err != nil {
+				return zero, Error(err)
+			}
+		}
+		return zero, nil
+	})
+	return err
+}
+
+// DeleteOne removes exactly 1 invite from `invites` collection based on matching id.
+func (colln InviteCollection) DeleteOne(ctx context.Context, id *db.InviteId) error {
+	if id == nil {
+		return db.ErrNil
+	}
+	res, err := colln.DB.ExecContext(ctx, InviteDeleteQuery, id.Iid, id.Sid == "", id.Sid)
+	if err != nil {
+		return Error(err)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return db.ErrNoRows
+	}
+	return nil
+}
+
+// UpdateOne is not supported on `invites` collection.
+func (colln InviteCollection) UpdateOne(context.Context, *db.InviteId, *db.InviteUpdater) error {
+	return errors.ErrUnsupported
+}
+
+// Use records a single use of the invite by id in colln. If not found,
+// then db.ErrNoRows. If expired or used up, then db.ErrConflict.
+func (colln InviteCollection) Use(ctx context.Context, id *db.InviteId) error {
+	if id == nil {
+		return db.ErrNil
+	}
+	res, err := colln.DB.ExecContext(ctx, InviteUseQuery, id.Iid, id.Sid == "", id.Sid, unixTime(time.Now()))
+	if err != nil {
+		return Error(err)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count != 0 {
+		return nil
+	}
+	// tell missing invites apart from unusable ones
+	_, err = colln.FindOne(ctx, id)
+	if err != nil {
+		return err
+	}
+	return db.ErrConflict
+}
+
+// FindOne fetches invite from colln by id.
+func (colln InviteCollection) FindOne(ctx context.Context, id *db.InviteId) (i db.Invite, err error) {
+	if id == nil {
+		err = db.ErrNil
+		return
+	}
+	var invite db.Invite
+	err = colln.DB.QueryRowContext(ctx, InviteSelectQuery, id.Iid, id.Sid == "", id.Sid).Scan(
+		&invite.Sid, &invite.Iid, &invite.Creator, &invite.Role, &invite.Guest,
+		(*unixTime)(&invite.Expires), &invite.SingleUse, &invite.Uses,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = db.ErrNoRows
+		}
+		return
+	}
+	return invite, nil
+}
+
+// Find fetches all the invites from colln subject to filter and
+// projection options specified.
+func (colln InviteCollection) Find(
+	ctx context.Context,
+	filter *db.InviteFilter,
+	projector *db.Projector,
+) (list *db.Iterable[db.Invite], err error) {
+	args := colln.buildArgs(filter)
+	query, err := colln.buildSelectQuery(projector, len(args))
+	if err != nil {
+		return
+	}
+	iterator := func(yield func(db.Invite) bool) (int, error) {
+		return Tx[int](ctx, colln.DB, func(tx Querier) (int, error) {
+			return queryData[db.Invite]{
+				context: ctx,
+				sqldb:   tx,
+				query:   query,
+				args:    args,
+				scanner: colln.scanOne,
+			}.iterator(yield)
+		})
+	}
+	return db.NewIterable(iterator), nil
+}
+
+// scanOne scans one invite from rows and returns associated data.
+func (colln InviteCollection) scanOne(rows *sql.Rows) (i db.Invite, err error) {
+	var invite db.Invite
+	err = rows.Scan(
+		&invite.Sid, &invite.Iid, &invite.Creator, &invite.Role, &invite.Guest,
+		(*unixTime)(&invite.Expires), &invite.SingleUse, &invite.Uses,
+	)
+	if err != nil {
+		return
+	}
+	return invite, nil
+}
+
+// buildSelectQuery constructs invite select query using provided
+// projector and InviteSelectTemplate, following argc filter args. Sorting
+// on any column not in db.InviteAllowedCols gives db.ErrInvalidColumn.
+func (colln InviteCollection) buildSelectQuery(projector *db.Projector, argc int) (selectQuery, error) {
+	// keysets carry expiry as time, stored as unix micros
+	if projector != nil && projector.Paging != nil {
+		order := db.KeysetOrder(projector.Order, db.InviteKeyCols)
+		p, paging := *projector, *projector.Paging
+		paging.After = unixKeyset(paging.After, order, "expires")
+		paging.Before = unixKeyset(paging.Before, order, "expires")
+		p.Paging = &paging
+		projector = &p
+	}
+	return buildSelect(InviteSelectTemplate, projector, db.InviteAllowedCols, db.InviteKeyCols, argc)
+}
+
+// buildArgs constructs sql numbered argument values for executing the query.
+func (colln InviteCollection) buildArgs(filter *db.InviteFilter) []any {
+	if filter == nil {
+		filter = new(db.InviteFilter)
+	}
+	args := make([]any, 0)
+	// WHERE clause
+	args = append(args, filter.Sid == "", filter.Sid)
+	args = append(args, filter.Iid == "", filter.Iid)
+	args = append(args, filter.Creator == "", filter.Creator)
+	return args
+}
+
+// compile-time assertion
+var _ db.Collection[db.Invite, db.InviteFilter, db.InviteUpdater, db.InviteId] = InviteCollection{}
@@ -0,0 +1,342 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"text/template"
+
+	"github.com/manojnakp/scount/db"
+)
+
+// MemberInsertQuery is query statement for inserting single member.
+// Role defaults to member.
+const MemberInsertQuery = `
+INSERT INTO members (sid, uid, role, name, guest)
+VALUES (?1, ?2, COALESCE(NULLIF(?3, ''), 'member'), ?4, ?5);`
+
+// MemberDeleteQuery is a query statement for deleting single member by id.
+const MemberDeleteQuery = `
+DELETE FROM members
+WHERE sid = ?1 AND uid = ?2;`
+
+// MemberSelectQuery is a query statement for fetching single member by id.
+const MemberSelectQuery = `
+SELECT sid, uid, role, name, guest FROM members
+WHERE sid = ?1 AND uid = ?2;`
+
+// MemberUpdateQuery is a query statement for updating role of a single
+// member by id.
+const MemberUpdateQuery = `
+UPDATE members SET role = ?3
+WHERE sid = ?1 AND uid = ?2;`
+
+// MemberClaimQuery is a query statement for taking over the role of
+// guest member ?2 of scount ?1 by user ?3.
+const MemberClaimQuery = `
+INSERT INTO members (sid, uid, role)
+SELECT sid, ?3, role FROM members
+WHERE sid = ?1 AND uid = ?2 AND guest;`
+
+// MemberLeaveQuery is a query statement for leaving guest ?3 named
+// ?4 in place of member ?2 of scount ?1, if it is no guest and
+// has expenses or settlements.
+const MemberLeaveQuery = `
+INSERT INTO members (sid, uid, role, name, guest)
+SELECT sid, ?3, 'member', ?4, TRUE FROM members
+WHERE sid = ?1 AND uid = ?2 AND NOT guest AND (
+	EXISTS (SELECT 1 FROM expenses e
+		WHERE e.sid = members.sid AND e.payer = members.uid)
+	OR EXISTS (SELECT 1 FROM expense_shares s
+		WHERE s.sid = members.sid AND s.uid = members.uid)
+	OR EXISTS (SELECT 1 FROM settlements st
+		WHERE st.sid = members.sid AND members.uid IN (st.payer, st.payee))
+);`
+
+// MemberMergeQueries are query statements for moving the history of
+// member ?2 of scount ?1 over to member ?3.
+var MemberMergeQueries = []string{
+	`UPDATE expenses SET payer = ?3 WHERE sid = ?1 AND payer = ?2;`,
+	`UPDATE expense_shares SET uid = ?3 WHERE sid = ?1 AND uid = ?2;`,
+	`UPDATE settlements SET payer = ?3 WHERE sid = ?1 AND payer = ?2;`,
+	`UPDATE settlements SET payee = ?3 WHERE sid = ?1 AND payee = ?2;`,
+}
+
+// MemberSelectTemplate is a query template for finding matching members
+// from MemberCollection.
+var MemberSelectTemplate = template.Must(template.New("member-select").
+	Funcs(template.FuncMap{"join": JoinSorter}).
+	Parse(`
+{{ define "filter" }}
+	FROM members
+	WHERE (?1 OR sid = ?2)
+	AND (?3 OR uid = ?4)
+	AND (?5 OR role = ?6)
+{{ end }}
+
+{{ define "find" }}
+	SELECT sid, uid, role, name, guest
+	{{ template "filter" }}
+	{{ with .Where }}AND {{ . }}{{ end }}
+	ORDER BY {{ join .Order "sid, uid" }}
+	{{ with .Paging }}
+		LIMIT {{ .Limit }}
+		OFFSET {{ .Offset }}
+	{{ end }};
+{{ end }}
+
+{{ define "count" }}
+	SELECT count(*) AS total
+	{{ template "filter" }};
+{{ end }}
+`))
+
+// MemberCollection provides a convenient way to interact with `members` table.
+type MemberCollection struct {
+	DB Querier
+}
+
+// Insert adds one or more members to colln. db.ErrNoRows if no users to insert.
+func (colln MemberCollection) Insert(ctx context.Context, members ...db.Member) error {
+	if len(members) == 0 {
+		return db.ErrNoRows
+	}
+	_, err := Tx[struct{}](ctx, colln.DB, func(tx Querier) (struct{}, error) {
+		var zero struct{}
+		// prepare insert query
+		stmt, err := tx.PrepareContext(ctx, MemberInsertQuery)
+		if err != nil {
+			log.Println("invalid stmt to prepare ", err)
+			return zero, err
+		}
+		defer stmt.Close()
+		// insert every member
+		for _, m := range members {
+			res, err := stmt.ExecContext(ctx, m.Sid, m.Uid, m.Role, m.Name, m.Guest)
+			if err != nil {
+				return zero, Error(err)
+			}
+			// assert res.RowsAffected gives 1
+			count, err := res.RowsAffected()
+			if err == nil {
+				// assert count == 1
+				_ = count
+			} else {
+				log.Println("failed RowsAffected: ", err)
+				// does not affect insert operation
+			}
+		}
+		return zero, nil
+	})
+	return err
+}
+
+// DeleteOne removes exactly 1 member from `members` collection based on matching id.
+func (colln MemberCollection) DeleteOne(ctx context.Context, id *db.MemberId) error {
+	if id == nil {
+		return db.ErrNil
+	}
+	res, err := colln.DB.ExecContext(ctx, MemberDeleteQuery, id.Sid, id.Uid)
+	if err != nil {
+		return Error(err)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return db.ErrNoRows
+	}
+	return nil
+}
+
+// UpdateOne modifies the role of exactly 1 member from `members` collection.
+// Empty role is left untouched.
+func (colln MemberCollection) UpdateOne(
+	ctx context.Context,
+	id *db.MemberId,
+	setter *db.MemberUpdater,
+) error {
+	// pointer validity check
+	if id == nil {
+		return db.ErrNil
+	}
+	if setter == nil {
+		setter = new(db.MemberUpdater)
+	}
+	// nothing to set: check existence only
+	if setter.Role == "" {
+		_, err := colln.FindOne(ctx, id)
+		return err
+	}
+	res, err := colln.DB.ExecContext(ctx, MemberUpdateQuery, id.Sid, id.Uid, setter.Role)
+	if err != nil {
+		return Error(err)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return db.ErrNoRows
+	}
+	return nil
+}
+
+// Claim hands over the place of guest member id to user uid within
+// a transaction. If no such guest, then db.ErrNoRows. If uid is already
+// a member, then db.ErrConflict.
+func (colln MemberCollection) Claim(ctx context.Context, id *db.MemberId, uid string) error {
+	if id == nil {
+		return db.ErrNil
+	}
+	_, err := Tx[struct{}](ctx, colln.DB, func(tx Querier) (struct{}, error) {
+		var zero struct{}
+		// user takes over the role of the guest
+		res, err := tx.ExecContext(ctx, MemberClaimQuery, id.Sid, id.Uid, uid)
+		if err != nil {
+			return zero, Error(err)
+		}
+		count, err := res.RowsAffected()
+		if err != nil {
+			return zero, err
+		}
+		if count == 0 {
+			return zero, db.ErrNoRows
+		}
+		// move the history over
+		for _, query := range MemberMergeQueries {
+			_, err = tx.ExecContext(ctx, query, id.Sid, id.Uid, uid)
+			if err != nil {
+				return zero, Error(err)
+			}
+		}
+		// guest no longer referred
+		_, err = tx.ExecContext(ctx, MemberDeleteQuery, id.Sid, id.Uid)
+		return zero, Error(err)
+	})
+	return err
+}
+
+// Leave removes member id within a transaction, leaving guest named
+// db.FormerMember in its place along with its expenses, shares and
+// settlements if it has any. If no such member, then db.ErrNoRows.
+// If the member is a guest with history, then db.ErrConflict.
+func (colln MemberCollection) Leave(ctx context.Context, id *db.MemberId, guest string) error {
+	if id == nil {
+		return db.ErrNil
+	}
+	_, err := Tx[struct{}](ctx, colln.DB, func(tx Querier) (struct{}, error) {
+		var zero struct{}
+		res, err := tx.ExecContext(ctx, MemberLeaveQuery, id.Sid, id.Uid, guest, db.FormerMember)
+		if err != nil {
+			return zero, Error(err)
+		}
+		count, err := res.RowsAffected()
+		if err != nil {
+			return zero, err
+		}
+		// move the history over to the guest
+		if count != 0 {
+			for _, query := range MemberMergeQueries {
+				_, err = tx.ExecContext(ctx, query, id.Sid, id.Uid, guest)
+				if err != nil {
+					return zero, Error(err)
+				}
+			}
+		}
+		res, err = tx.ExecContext(ctx, MemberDeleteQuery, id.Sid, id.Uid)
+		if err != nil {
+			return zero, Error(err)
+		}
+		count, err = res.RowsAffected()
+		if err != nil {
+			return zero, err
+		}
+		if count == 0 {
+			return zero, db.ErrNoRows
+		}
+		return zero, nil
+	})
+	return err
+}
+
+// FindOne fetches member from colln by id.
+func (colln MemberCollection) FindOne(
+	ctx context.Context,
+	id *db.MemberId,
+) (m db.Member, err error) {
+	if id == nil {
+		err = db.ErrNil
+		return
+	}
+	var member db.Member
+	err = colln.DB.QueryRowContext(ctx, MemberSelectQuery, id.Sid, id.Uid).
+		Scan(&member.Sid, &member.Uid, &member.Role, &member.Name, &member.Guest)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = db.ErrNoRows
+		}
+		return
+	}
+	return member, nil
+}
+
+// Find fetches all the members from colln subject to filter and
+// projection options specified.
+func (colln MemberCollection) Find(
+	ctx context.Context,
+	filter *db.MemberFilter,
+	projector *db.Projector,
+) (list *db.Iterable[db.Member], err error) {
+	args := colln.buildArgs(filter)
+	query, err := colln.buildSelectQuery(projector, len(args))
+	if err != nil {
+		return
+	}
+	iterable := func(yield func(db.Member) bool) (int, error) {
+		return Tx[int](ctx, colln.DB, func(tx Querier) (int, error) {
+			return queryData[db.Member]{
+				context: ctx,
+				sqldb:   tx,
+				query:   query,
+				args:    args,
+				scanner: colln.scanOne,
+			}.iterator(yield)
+		})
+	}
+	return db.NewIterable(iterable), nil
+}
+
+// scanOne scans one member from rows and returns associated data.
+func (colln MemberCollection) scanOne(rows *sql.Rows) (m db.Member, err error) {
+	var member db.Member
+	err = rows.Scan(&member.Sid, &member.Uid, &member.Role, &member.Name, &member.Guest)
+	if err != nil {
+		return
+	}
+	return member, nil
+}
+
+// buildSelectQuery constructs member select query using provided
+// projector and MemberSelectTemplate, following argc filter args. Sorting
+// on any column not in db.MemberAllowedCols gives db.ErrInvalidColumn.
+func (colln MemberCollection) buildSelectQuery(projector *db.Projector, argc int) (selectQuery, error) {
+	return buildSelect(MemberSelectTemplate, projector, db.MemberAllowedCols, db.MemberKeyCols, argc)
+}
+
+func (colln MemberCollection) buildArgs(filter *db.MemberFilter) []any {
+	if filter == nil {
+		filter = new(db.MemberFilter)
+	}
+	args := make([]any, 0)
+	// WHERE clause
+	args = append(args, filter.Sid == "", filter.Sid)
+	args = append(args, filter.Uid == "", filter.Uid)
+	args = append(args, filter.Role == "", filter.Role)
+	return args
+}
+
+// compile-time assertion
+var _ db.Collection[db.Member, db.MemberFilter, db.MemberUpdater, db.MemberId] = MemberCollection{}
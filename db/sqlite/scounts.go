@@ -0,0 +1,516 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"text/template"
+	"time"
+
+	"github.com/manojnakp/scount/db"
+	"github.com/manojnakp/scount/money"
+)
+
+// ScountInsertQuery is a query statement for adding a single scount by id.
+const ScountInsertQuery = `
+INSERT INTO scounts (sid, owner, title, description, currency)
+VALUES (?1, ?2, ?3, ?4, ?5);`
+
+// ScountOwnerQuery is a query statement for adding the owner of a
+// scount by sid as a member.
+const ScountOwnerQuery = `
+INSERT INTO members (sid, uid, role)
+VALUES (?1, ?2, 'owner');`
+
+// ScountDeleteQuery is a query statement for deleting a single scount by sid.
+const ScountDeleteQuery = `
+DELETE FROM scounts
+WHERE sid = ?1;`
+
+// ScountTrashQuery is a query statement for moving a single scount by
+// sid to the trash at time ?2.
+const ScountTrashQuery = `
+UPDATE scounts SET deleted_at = ?2
+WHERE sid = ?1 AND deleted_at IS NULL;`
+
+// ScountRestoreQuery is a query statement for moving a single scount by
+// sid back from the trash.
+const ScountRestoreQuery = `
+UPDATE scounts SET deleted_at = NULL
+WHERE sid = ?1 AND deleted_at IS NOT NULL;`
+
+// ScountPurgeQuery is a query statement for fetching sids of the scounts
+// moved to the trash before time ?1.
+const ScountPurgeQuery = `
+SELECT sid FROM scounts
+WHERE deleted_at < ?1;`
+
+// ScountCascadeQueries are query statements for deleting everything of
+// a scount by sid, in order of dependence, before the scount itself.
+// Shares go along with expenses.
+var ScountCascadeQueries = []string{
+	`DELETE FROM activities WHERE sid = ?1;`,
+	`DELETE FROM invites WHERE sid = ?1;`,
+	`DELETE FROM settlements WHERE sid = ?1;`,
+	`DELETE FROM expenses WHERE sid = ?1;`,
+	`DELETE FROM members WHERE sid = ?1;`,
+}
+
+// ScountSelectQuery is a query statement for fetching a single scount by sid.
+const ScountSelectQuery = `
+SELECT sid, owner, title, description, currency
+FROM scounts
+WHERE sid = ?1 AND deleted_at IS NULL;`
+
+// ScountExistsQuery is a query statement for checking existence of a scount by sid.
+const ScountExistsQuery = `
+SELECT EXISTS (SELECT 1 FROM scounts WHERE sid = ?1 AND deleted_at IS NULL);`
+
+// ScountBalanceQuery is a query statement for computing balances of
+// every member of a scount by sid, in the currency of the scount.
+// Expenses in the trash are left out.
+const ScountBalanceQuery = `
+WITH paid AS (
+	SELECT payer AS uid, sum(base_amount) AS total
+	FROM expenses
+	WHERE sid = ?1 AND deleted_at IS NULL
+	GROUP BY payer
+), owed AS (
+	SELECT s.uid, sum(s.base_amount) AS total
+	FROM expense_shares s
+	JOIN expenses e USING (sid, eid)
+	WHERE s.sid = ?1 AND e.deleted_at IS NULL
+	GROUP BY s.uid
+), sent AS (
+	SELECT payer AS uid, sum(base_amount) AS total
+	FROM settlements
+	WHERE sid = ?1
+	GROUP BY payer
+), received AS (
+	SELECT payee AS uid, sum(base_amount) AS total
+	FROM settlements
+	WHERE sid = ?1
+	GROUP BY payee
+)
+SELECT m.uid, s.currency,
+	CAST(COALESCE(paid.total, 0) AS INTEGER) AS paid,
+	CAST(COALESCE(owed.total, 0) AS INTEGER) AS owed,
+	CAST(COALESCE(sent.total, 0) AS INTEGER) AS sent,
+	CAST(COALESCE(received.total, 0) AS INTEGER) AS received
+FROM members m
+JOIN scounts s USING (sid)
+LEFT JOIN paid USING (uid)
+LEFT JOIN owed USING (uid)
+LEFT JOIN sent USING (uid)
+LEFT JOIN received USING (uid)
+WHERE m.sid = ?1
+ORDER BY m.uid;`
+
+// ScountDemoteOwnerQuery is a query statement for demoting the owner of
+// a scount by sid to an admin.
+const ScountDemoteOwnerQuery = `
+UPDATE members SET role = 'admin'
+WHERE sid = ?1 AND role = 'owner';`
+
+// ScountPromoteOwnerQuery is a query statement for promoting a member of
+// a scount by sid and uid to the owner.
+const ScountPromoteOwnerQuery = `
+UPDATE members SET role = 'owner'
+WHERE sid = ?1 AND uid = ?2;`
+
+// ScountUpdateTemplate is a query template for updating scounts from ScountCollection.
+var ScountUpdateTemplate = template.Must(template.New("scount-update").
+	Funcs(template.FuncMap{"add": Add}).
+	Parse(`
+UPDATE scounts SET
+{{ range $i, $col := . }}
+	{{ if $i }},{{ end }} {{ $col }} = {{ add $i 2 | printf "?%d" }}
+{{ end }}
+WHERE sid = ?1 AND deleted_at IS NULL;
+`))
+
+// ScountSelectTemplate is a query template for finding scounts from ScountCollection.
+var ScountSelectTemplate = template.Must(template.New("scount-select").
+	Funcs(template.FuncMap{"join": JoinSorter}).
+	Parse(`
+{{ define "filter" }}
+	FROM scounts s
+	WHERE (?1 OR sid = ?2)
+	AND (?3 OR EXISTS (SELECT 1 FROM members m WHERE m.sid = s.sid AND m.uid = ?4))
+	AND (?5 OR owner = ?6)
+	AND (?7 OR title LIKE ?8 ESCAPE '\')
+	AND (?9 OR EXISTS (SELECT 1 FROM members m WHERE m.sid = s.sid AND m.uid = ?10))
+	AND (deleted_at IS NOT NULL) = ?11
+{{ end }}
+
+{{ define "find" }}
+	SELECT sid, owner, title, description, currency, deleted_at
+	{{ template "filter" }}
+	{{ with .Where }}AND {{ . }}{{ end }}
+	ORDER BY {{ join .Order "sid" }}
+	{{ with .Paging }}
+		LIMIT {{ .Limit }}
+		OFFSET {{ .Offset }}
+	{{ end }};
+{{ end }}
+
+{{ define "count" }}
+	SELECT count(*) AS total
+	{{ template "filter" }};
+{{ end }}
+`))
+
+// ScountCollection provides a convenient way to interact with `scounts` table.
+type ScountCollection struct {
+	DB Querier
+}
+
+// DeleteOne moves exactly 1 scount from `scounts` collection to the
+// trash based on sid.
+func (colln ScountCollection) DeleteOne(ctx context.Context, id *db.ScountId) error {
+	if id == nil {
+		return db.ErrNil
+	}
+	return colln.exec(ctx, ScountTrashQuery, id.Sid, unixTime(time.Now()))
+}
+
+// Restore moves exactly 1 scount from the trash back to `scounts`
+// collection based on sid.
+func (colln ScountCollection) Restore(ctx context.Context, id *db.ScountId) error {
+	if id == nil {
+		return db.ErrNil
+	}
+	return colln.exec(ctx, ScountRestoreQuery, id.Sid)
+}
+
+// exec executes query with args, expecting some rows to be affected,
+// otherwise db.ErrNoRows.
+func (colln ScountCollection) exec(ctx context.Context, query string, args ...any) error {
+	res, err := colln.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return Error(err)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return db.ErrNoRows
+	}
+	return nil
+}
+
+// Purge removes the scounts moved to the trash before the given time
+// for good, along with their members, expenses, settlements and invites.
+func (colln ScountCollection) Purge(ctx context.Context, before time.Time) (int, error) {
+	return Tx[int](ctx, colln.DB, func(tx Querier) (int, error) {
+		return colln.purge(ctx, tx, ScountPurgeQuery, unixTime(before))
+	})
+}
+
+// purge removes the scounts with sids fetched by query with args for
+// good, along with everything of them, within tx.
+func (colln ScountCollection) purge(ctx context.Context, tx Querier, query string, args ...any) (int, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, Error(err)
+	}
+	sids := make([]string, 0)
+	for rows.Next() {
+		var sid string
+		err = rows.Scan(&sid)
+		if err != nil {
+			_ = rows.Close()
+			return 0, err
+		}
+		sids = append(sids, sid)
+	}
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	for _, sid := range sids {
+		for _, query := range append(ScountCascadeQueries, ScountDeleteQuery) {
+			_, err = tx.ExecContext(ctx, query, sid)
+			if err != nil {
+				return 0, Error(err)
+			}
+		}
+	}
+	return len(sids), nil
+}
+
+// UpdateOne modifies exactly 1 scount from `scounts` collection. Change
+// of owner promotes the new owner and demotes the old owner to an admin
+// within the same transaction. If the new owner is not a member of the
+// scount, then db.ErrConflict.
+func (colln ScountCollection) UpdateOne(
+	ctx context.Context,
+	id *db.ScountId,
+	setter *db.ScountUpdater,
+) error {
+	// pointer validity check
+	if id == nil {
+		return db.ErrNil
+	}
+	if setter == nil {
+		setter = new(db.ScountUpdater)
+	}
+	// construct query from template
+	query, args, err := colln.buildUpdateQuery(id, setter)
+	if err != nil {
+		return err
+	}
+	_, err = Tx[struct{}](ctx, colln.DB, func(tx Querier) (struct{}, error) {
+		var zero struct{}
+		// execute query
+		res, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return zero, Error(err)
+		}
+		// expect at least 1 row to be updated
+		count, err := res.RowsAffected()
+		if err != nil {
+			return zero, err
+		}
+		if count == 0 {
+			return zero, db.ErrNoRows
+		}
+		// owner unchanged
+		if setter.Owner == "" {
+			return zero, nil
+		}
+		return zero, colln.transferOwner(ctx, tx, id.Sid, setter.Owner)
+	})
+	// all good
+	return err
+}
+
+// transferOwner demotes the owner of scount sid to an admin and
+// promotes member uid to the owner within tx.
+func (colln ScountCollection) transferOwner(ctx context.Context, tx Querier, sid, uid string) error {
+	_, err := tx.ExecContext(ctx, ScountDemoteOwnerQuery, sid)
+	if err != nil {
+		return Error(err)
+	}
+	res, err := tx.ExecContext(ctx, ScountPromoteOwnerQuery, sid, uid)
+	if err != nil {
+		return Error(err)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	// new owner not a member
+	if count == 0 {
+		return db.ErrConflict
+	}
+	return nil
+}
+
+// buildUpdateQuery constructs a scount update query using provided id,
+// setter and ScountUpdateTemplate. id and setter are not nil.
+func (colln ScountCollection) buildUpdateQuery(
+	id *db.ScountId, setter *db.ScountUpdater,
+) (string, []any, error) {
+	// numbered arguments in the SQL query
+	args := []any{id.Sid}
+	// cols for template arguments
+	cols := make([]string, 0)
+	if setter.Owner != "" {
+		cols = append(cols, "owner")
+		args = append(args, setter.Owner)
+	}
+	if setter.Title != "" {
+		cols = append(cols, "title")
+		args = append(args, setter.Title)
+	}
+	// nothing to set: touch the row to report existence
+	if len(cols) == 0 {
+		cols = append(cols, "sid")
+		args = append(args, id.Sid)
+	}
+	// construct
+	buf := new(bytes.Buffer)
+	err := ScountUpdateTemplate.Execute(buf, cols)
+	if err != nil {
+		log.Println("tmpl exec scount-update: ", err)
+		return "", nil, err
+	}
+	return buf.String(), args, nil
+}
+
+// FindOne fetches scount from colln by id.
+func (colln ScountCollection) FindOne(
+	ctx context.Context,
+	id *db.ScountId,
+) (s db.Scount, err error) {
+	if id == nil {
+		err = db.ErrNil
+		return
+	}
+	var scount db.Scount
+	err = colln.DB.QueryRowContext(ctx, ScountSelectQuery, id.Sid).
+		Scan(&scount.Sid, &scount.Owner, &scount.Title, &scount.Description, &scount.Currency)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = db.ErrNoRows
+		}
+		return
+	}
+	return scount, nil
+}
+
+// compile-time assertion
+var _ interface {
+	DeleteOne(ctx context.Context, id *db.ScountId) error
+	UpdateOne(ctx context.Context, id *db.ScountId, setter *db.ScountUpdater) error
+	FindOne(ctx context.Context, id *db.ScountId) (db.Scount, error)
+} = ScountCollection{}
+
+// Insert adds one or more scounts into colln. db.ErrNoRows if empty scounts.
+func (colln ScountCollection) Insert(ctx context.Context, scounts ...db.Scount) error {
+	if len(scounts) == 0 {
+		return db.ErrNoRows
+	}
+	_, err := Tx[struct{}](ctx, colln.DB, func(tx Querier) (struct{}, error) {
+		var zero struct{}
+		// prepare insert query
+		stmt, err := tx.PrepareContext(ctx, ScountInsertQuery)
+		if err != nil {
+			log.Println("invalid stmt to prepare: ", err)
+			return zero, err
+		}
+		defer stmt.Close()
+		// insert every scount along with its owner
+		for _, s := range scounts {
+			res, err := stmt.ExecContext(ctx, s.Sid, s.Owner, s.Title, s.Description, s.Currency)
+			if err != nil {
+				return zero, Error(err)
+			}
+			_, err = tx.ExecContext(ctx, ScountOwnerQuery, s.Sid, s.Owner)
+			if err != nil {
+				return zero, Error(err)
+			}
+			// assert res.RowsAffected gives 1
+			count, err := res.RowsAffected()
+			if err == nil {
+				// assert count == 1
+				_ = count == 1
+			} else {
+				log.Println("failed RowsAffected: ", err)
+				// does not affect insert operation
+			}
+		}
+		return zero, nil
+	})
+	return err
+}
+
+// Find fetches all the scounts from colln subject to filter and projector
+// options specified.
+func (colln ScountCollection) Find(
+	ctx context.Context,
+	filter *db.ScountFilter,
+	projector *db.Projector,
+) (list *db.Iterable[db.Scount], err error) {
+	args := colln.buildArgs(filter)
+	query, err := colln.buildSelectQuery(projector, len(args))
+	if err != nil {
+		return
+	}
+	iterator := func(yield func(db.Scount) bool) (int, error) {
+		return Tx[int](ctx, colln.DB, func(tx Querier) (int, error) {
+			return queryData[db.Scount]{
+				context: ctx,
+				sqldb:   tx,
+				query:   query,
+				args:    args,
+				scanner: colln.scanOne,
+			}.iterator(yield)
+		})
+	}
+	return db.NewIterable[db.Scount](iterator), nil
+}
+
+// scanOne scans one scount from rows and returns associated data.
+func (colln ScountCollection) scanOne(rows *sql.Rows) (s db.Scount, err error) {
+	var scount db.Scount
+	err = rows.Scan(
+		&scount.Sid, &scount.Owner, &scount.Title, &scount.Description, &scount.Currency,
+		(*unixTime)(&scount.Deleted),
+	)
+	if err != nil {
+		return
+	}
+	return scount, nil
+}
+
+// buildSelectQuery constructs scount select query using provided
+// projector and ScountSelectTemplate, following argc filter args. Sorting
+// on any column not in db.ScountAllowedCols gives db.ErrInvalidColumn.
+func (colln ScountCollection) buildSelectQuery(projector *db.Projector, argc int) (selectQuery, error) {
+	return buildSelect(ScountSelectTemplate, projector, db.ScountAllowedCols, db.ScountKeyCols, argc)
+}
+
+// buildArgs constructs sql numbered argument values for executing the query.
+func (colln ScountCollection) buildArgs(filter *db.ScountFilter) []any {
+	if filter == nil {
+		filter = new(db.ScountFilter)
+	}
+	args := make([]any, 0)
+	// WHERE clause
+	args = append(args, filter.Sid == "", filter.Sid)
+	args = append(args, filter.Uid == "", filter.Uid)
+	args = append(args, filter.Owner == "", filter.Owner)
+	args = append(args, filter.Title == "", filter.Title)
+	args = append(args, filter.Member == "", filter.Member)
+	args = append(args, filter.Trash)
+	return args
+}
+
+// Balances computes the balance of every member of scount by sid. If no
+// such scount exists, then db.ErrNoRows.
+func (colln ScountCollection) Balances(ctx context.Context, sid string) ([]db.Balance, error) {
+	return Tx[[]db.Balance](ctx, colln.DB, func(tx Querier) ([]db.Balance, error) {
+		var exists bool
+		err := tx.QueryRowContext(ctx, ScountExistsQuery, sid).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, db.ErrNoRows
+		}
+		rows, err := tx.QueryContext(ctx, ScountBalanceQuery, sid)
+		if err != nil {
+			return nil, Error(err)
+		}
+		defer rows.Close()
+		balances := make([]db.Balance, 0)
+		for rows.Next() {
+			var (
+				b        db.Balance
+				currency money.Currency
+			)
+			err = rows.Scan(&b.Uid, &currency, &b.Paid, &b.Owed, &b.Sent, &b.Received)
+			if err != nil {
+				return nil, err
+			}
+			b.Paid.Currency = currency
+			b.Owed.Currency = currency
+			b.Sent.Currency = currency
+			b.Received.Currency = currency
+			balances = append(balances, b)
+		}
+		return balances, rows.Err()
+	})
+}
+
+// compile-time assertion
+var _ interface {
+	db.Collection[db.Scount, db.ScountFilter, db.ScountUpdater, db.ScountId]
+	db.Trash[db.ScountId]
+	Balances(ctx context.Context, sid string) ([]db.Balance, error)
+} = ScountCollection{}
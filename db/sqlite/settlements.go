@@ -0,0 +1,215 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"text/template"
+
+	"github.com/manojnakp/scount/db"
+)
+
+// SettlementInsertQuery is query statement for inserting single settlement.
+const SettlementInsertQuery = `
+INSERT INTO settlements (sid, stid, payer, payee, amount, currency,
+	rate, base_amount, base_currency)
+VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9);`
+
+// SettlementDeleteQuery is a query statement for deleting single settlement by id.
+const SettlementDeleteQuery = `
+DELETE FROM settlements
+WHERE sid = ?1 AND stid = ?2;`
+
+// SettlementSelectQuery is a query statement for fetching single settlement by id.
+const SettlementSelectQuery = `
+SELECT sid, stid, payer, payee, amount, currency,
+	rate, base_amount, base_currency
+FROM settlements
+WHERE sid = ?1 AND stid = ?2;`
+
+// NO UPDATE ALLOWED
+
+// SettlementSelectTemplate is a query template for finding matching
+// settlements from SettlementCollection.
+var SettlementSelectTemplate = template.Must(template.New("settlement-select").
+	Funcs(template.FuncMap{"join": JoinSorter}).
+	Parse(`
+{{ define "filter" }}
+	FROM settlements
+	WHERE (?1 OR sid = ?2)
+	AND (?3 OR stid = ?4)
+	AND (?5 OR payer = ?6)
+	AND (?7 OR payee = ?8)
+	AND (?9 OR payer = ?10 OR payee = ?10)
+{{ end }}
+
+{{ define "find" }}
+	SELECT sid, stid, payer, payee, amount, currency,
+		rate, base_amount, base_currency
+	{{ template "filter" }}
+	{{ with .Where }}AND {{ . }}{{ end }}
+	ORDER BY {{ join .Order "stid" }}
+	{{ with .Paging }}
+		LIMIT {{ .Limit }}
+		OFFSET {{ .Offset }}
+	{{ end }};
+{{ end }}
+
+{{ define "count" }}
+	SELECT count(*) AS total
+	{{ template "filter" }};
+{{ end }}
+`))
+
+// SettlementCollection provides a convenient way to interact with `settlements` table.
+type SettlementCollection struct {
+	DB Querier
+}
+
+// Insert adds one or more settlements to colln. db.ErrNoRows if no settlements to insert.
+func (colln SettlementCollection) Insert(ctx context.Context, settlements ...db.Settlement) error {
+	if len(settlements) == 0 {
+		return db.ErrNoRows
+	}
+	_, err := Tx[struct{}](ctx, colln.DB, func(tx Querier) (struct{}, error) {
+		var zero struct{}
+		// prepare insert query
+		stmt, err := tx.PrepareContext(ctx, SettlementInsertQuery)
+		if err != nil {
+			log.Println("invalid stmt to prepare: ", err)
+			return zero, err
+		}
+		defer stmt.Close()
+		// insert every settlement
+		for _, s := range settlements {
+			_, err := stmt.ExecContext(
+				ctx, s.Sid, s.Stid, s.Payer, s.Payee,
+				s.Amount, s.Amount.Currency,
+				s.Rate, s.Base, s.Base.Currency,
+			)
+			if err != nil {
+				return zero, Error(err)
+			}
+		}
+		return zero, nil
+	})
+	return err
+}
+
+// DeleteOne removes exactly 1 settlement from `settlements` collection based on matching id.
+func (colln SettlementCollection) DeleteOne(ctx context.Context, id *db.SettlementId) error {
+	if id == nil {
+		return db.ErrNil
+	}
+	res, err := colln.DB.ExecContext(ctx, SettlementDeleteQuery, id.Sid, id.Stid)
+	if err != nil {
+		return Error(err)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return db.ErrNoRows
+	}
+	return nil
+}
+
+// UpdateOne is not supported on `settlements` collection.
+func (colln SettlementCollection) UpdateOne(context.Context, *db.SettlementId, *db.SettlementUpdater) error {
+	return errors.ErrUnsupported
+}
+
+// FindOne fetches settlement from colln by id.
+func (colln SettlementCollection) FindOne(
+	ctx context.Context,
+	id *db.SettlementId,
+) (s db.Settlement, err error) {
+	if id == nil {
+		err = db.ErrNil
+		return
+	}
+	var settlement db.Settlement
+	err = colln.DB.QueryRowContext(ctx, SettlementSelectQuery, id.Sid, id.Stid).Scan(
+		&settlement.Sid, &settlement.Stid, &settlement.Payer,
+		&settlement.Payee, &settlement.Amount, &settlement.Amount.Currency,
+		&settlement.Rate, &settlement.Base, &settlement.Base.Currency,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = db.ErrNoRows
+		}
+		return
+	}
+	settlement.Rate.From = settlement.Amount.Currency
+	settlement.Rate.To = settlement.Base.Currency
+	return settlement, nil
+}
+
+// Find fetches all the settlements from colln subject to filter and
+// projection options specified.
+func (colln SettlementCollection) Find(
+	ctx context.Context,
+	filter *db.SettlementFilter,
+	projector *db.Projector,
+) (list *db.Iterable[db.Settlement], err error) {
+	args := colln.buildArgs(filter)
+	query, err := colln.buildSelectQuery(projector, len(args))
+	if err != nil {
+		return
+	}
+	iterator := func(yield func(db.Settlement) bool) (int, error) {
+		return Tx[int](ctx, colln.DB, func(tx Querier) (int, error) {
+			return queryData[db.Settlement]{
+				context: ctx,
+				sqldb:   tx,
+				query:   query,
+				args:    args,
+				scanner: colln.scanOne,
+			}.iterator(yield)
+		})
+	}
+	return db.NewIterable(iterator), nil
+}
+
+// scanOne scans one settlement from rows and returns associated data.
+func (colln SettlementCollection) scanOne(rows *sql.Rows) (s db.Settlement, err error) {
+	var settlement db.Settlement
+	err = rows.Scan(
+		&settlement.Sid, &settlement.Stid, &settlement.Payer,
+		&settlement.Payee, &settlement.Amount, &settlement.Amount.Currency,
+		&settlement.Rate, &settlement.Base, &settlement.Base.Currency,
+	)
+	if err != nil {
+		return
+	}
+	settlement.Rate.From = settlement.Amount.Currency
+	settlement.Rate.To = settlement.Base.Currency
+	return settlement, nil
+}
+
+// buildSelectQuery constructs settlement select query using provided
+// projector and SettlementSelectTemplate, following argc filter args. Sorting
+// on any column not in db.SettlementAllowedCols gives db.ErrInvalidColumn.
+func (colln SettlementCollection) buildSelectQuery(projector *db.Projector, argc int) (selectQuery, error) {
+	return buildSelect(SettlementSelectTemplate, projector, db.SettlementAllowedCols, db.SettlementKeyCols, argc)
+}
+
+// buildArgs constructs sql numbered argument values for executing the query.
+func (colln SettlementCollection) buildArgs(filter *db.SettlementFilter) []any {
+	if filter == nil {
+		filter = new(db.SettlementFilter)
+	}
+	args := make([]any, 0)
+	// WHERE clause
+	args = append(args, filter.Sid == "", filter.Sid)
+	args = append(args, filter.Stid == "", filter.Stid)
+	args = append(args, filter.Payer == "", filter.Payer)
+	args = append(args, filter.Payee == "", filter.Payee)
+	args = append(args, filter.Member == "", filter.Member)
+	return args
+}
+
+// compile-time assertion
+var _ db.Collection[db.Settlement, db.SettlementFilter, db.SettlementUpdater, db.SettlementId] = SettlementCollection{}
@@ -0,0 +1,461 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	_ "embed"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/manojnakp/scount/db"
+	"github.com/manojnakp/scount/db/internal"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Schema is the SQL script creating the tables of a scount database as
+// first released, see Migrate.
+//
+//go:embed init.sql
+var Schema string
+
+// NewStore constructs a [db.Store] from a SQL (sqlite supported)
+// database connection handle. Foreign keys are supposed to be enforced
+// on every connection, see Open.
+func NewStore(DB *sql.DB) *db.Store {
+	return newStore(DB)
+}
+
+// newStore constructs a [db.Store] over the database handle DB.
+func newStore(DB Querier) *db.Store {
+	return &db.Store{
+		Users:       UserCollection{DB},
+		Scounts:     ScountCollection{DB},
+		Members:     MemberCollection{DB},
+		Expenses:    ExpenseCollection{DB},
+		Settlements: SettlementCollection{DB},
+		Invites:     InviteCollection{DB},
+		Activities:  ActivityCollection{DB},
+		Transact:    transact(DB),
+	}
+}
+
+// Open opens the SQLITE database at uri, like `sqlite:///var/lib/scount.db`
+// or `sqlite:scount.db`, migrates the schema (see Migrate) and constructs
+// a [db.Store]. Connections enforce foreign keys and wait on locks held
+// by other writers. Wraps over NewStore.
+func Open(uri string) (*db.Store, error) {
+	sqldb, err := sql.Open("sqlite3", DSN(uri))
+	if err != nil {
+		return nil, err
+	}
+	err = Migrate(context.Background(), sqldb)
+	if err != nil {
+		_ = sqldb.Close()
+		return nil, err
+	}
+	return NewStore(sqldb), nil
+}
+
+// DSN converts the SQLITE uri into the data source name for the driver,
+// with the connection parameters required by NewStore.
+func DSN(uri string) string {
+	name := strings.TrimPrefix(strings.TrimPrefix(uri, "sqlite:"), "//")
+	name, query, _ := strings.Cut(name, "?")
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		params = make(url.Values)
+	}
+	params.Set("_foreign_keys", "1")
+	if !params.Has("_busy_timeout") {
+		params.Set("_busy_timeout", "5000")
+	}
+	if !params.Has("_txlock") {
+		params.Set("_txlock", "immediate")
+	}
+	return "file:" + name + "?" + params.Encode()
+}
+
+// Error is a utility function for error handling.
+func Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	log.Printf("db error: %#v", err)
+	var sqlerr sqlite3.Error
+	if errors.As(err, &sqlerr) {
+		switch sqlerr.Code {
+		// data type mismatch, out of range or too big
+		case sqlite3.ErrMismatch, sqlite3.ErrRange, sqlite3.ErrTooBig:
+			return internal.Error{
+				Pretty: db.ErrInvalidData,
+				Err:    err,
+			}
+		// constraint violation
+		case sqlite3.ErrConstraint:
+			return internal.Error{
+				Pretty: db.ErrConflict,
+				Err:    err,
+			}
+		// sql error or authorization denied
+		case sqlite3.ErrError, sqlite3.ErrAuth, sqlite3.ErrPerm:
+			return internal.Error{
+				Pretty: db.ErrSyntaxPrivilege,
+				Err:    err,
+			}
+		}
+	}
+	return err
+}
+
+// QuoteIdentifier quotes name for use as an identifier in queries.
+func QuoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// unixTime is a time stored as microseconds since the unix epoch, which
+// sorts and compares like the time itself.
+type unixTime time.Time
+
+// Value implements driver.Valuer on unixTime.
+func (t unixTime) Value() (driver.Value, error) {
+	return time.Time(t).UnixMicro(), nil
+}
+
+// Scan implements sql.Scanner on unixTime. NULL scans as the zero time.
+func (t *unixTime) Scan(src any) error {
+	if src == nil {
+		*t = unixTime{}
+		return nil
+	}
+	micros, ok := src.(int64)
+	if !ok {
+		return fmt.Errorf("%w: cannot scan %T into time", db.ErrEncoding, src)
+	}
+	*t = unixTime(time.UnixMicro(micros))
+	return nil
+}
+
+// unixKeyset gives a copy of keyset with values of column (a time) as
+// unix micros, see unixTime.
+func unixKeyset(keyset db.Keyset, order []db.Sorter, column db.Column) db.Keyset {
+	if keyset == nil {
+		return nil
+	}
+	keyset = slices.Clone(keyset)
+	for i, sorter := range order {
+		if i >= len(keyset) || sorter.Column != column {
+			continue
+		}
+		switch v := keyset[i].(type) {
+		case time.Time:
+			keyset[i] = unixTime(v)
+		case string:
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err == nil {
+				keyset[i] = unixTime(t)
+			}
+		}
+	}
+	return keyset
+}
+
+// Add defines addition behavior inside templates.
+func Add(x, y int) int {
+	return x + y
+}
+
+// CheckOrder checks that projector sorts on the allowed columns only,
+// since columns are interpolated into queries. If not, then
+// db.ErrInvalidColumn.
+func CheckOrder(projector *db.Projector, allowed []db.Column) error {
+	if projector == nil {
+		return nil
+	}
+	for _, order := range projector.Order {
+		if !slices.Contains(allowed, order.Column) {
+			return fmt.Errorf("%w: %q", db.ErrInvalidColumn, order.Column)
+		}
+	}
+	return nil
+}
+
+// JoinSorter defines `join` operation inside templates. Columns are
+// quoted as identifiers, fallback is used as is.
+func JoinSorter(cols []db.Sorter, fallback string) string {
+	if len(cols) == 0 {
+		return fallback
+	}
+	const DESC string = " DESC"
+	const SEP string = ", "
+	order := cols[0]
+	var b strings.Builder
+	b.WriteString(QuoteIdentifier(order.Column.String()))
+	if order.Desc {
+		b.WriteString(DESC)
+	}
+	for _, order = range cols[1:] {
+		b.WriteString(SEP)
+		b.WriteString(QuoteIdentifier(order.Column.String()))
+		if order.Desc {
+			b.WriteString(DESC)
+		}
+	}
+	return b.String()
+}
+
+// Querier is an SQL database handle, either *sql.DB or the *sql.Tx of a
+// unit of work (see db.Store.WithTx).
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Tx is a handy callback wrapper for executing transactions. Within the
+// transaction of a unit of work, callback runs in a savepoint instead.
+func Tx[T any](
+	ctx context.Context,
+	sqldb Querier,
+	callback func(Querier) (T, error),
+) (t T, err error) {
+	switch sqldb := sqldb.(type) {
+	case *sql.DB:
+		if sqldb == nil {
+			break
+		}
+		tx, err := sqldb.BeginTx(ctx, nil)
+		if err != nil {
+			return t, err
+		}
+		defer tx.Rollback()
+		// execute callback
+		value, err := callback(tx)
+		if err != nil {
+			return t, err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return t, err
+		}
+		return value, nil
+	case *sql.Tx:
+		if sqldb == nil {
+			break
+		}
+		return savepoint(ctx, sqldb, callback)
+	}
+	err = db.ErrNil
+	return
+}
+
+// savepoint runs callback within a savepoint of tx, rolled back to if
+// callback fails, so that tx is still usable.
+func savepoint[T any](
+	ctx context.Context,
+	tx *sql.Tx,
+	callback func(Querier) (T, error),
+) (t T, err error) {
+	_, err = tx.ExecContext(ctx, "SAVEPOINT unit;")
+	if err != nil {
+		return
+	}
+	value, err := callback(tx)
+	if err != nil {
+		_, _ = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT unit;")
+		_, _ = tx.ExecContext(ctx, "RELEASE SAVEPOINT unit;")
+		return
+	}
+	_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT unit;")
+	if err != nil {
+		return
+	}
+	return value, nil
+}
+
+// transact implements db.Store.Transact over sqldb.
+func transact(sqldb Querier) func(context.Context, func(*db.Store) error) error {
+	return func(ctx context.Context, callback func(*db.Store) error) error {
+		_, err := Tx[struct{}](ctx, sqldb, func(tx Querier) (struct{}, error) {
+			return struct{}{}, callback(newStore(tx))
+		})
+		return err
+	}
+}
+
+// selectQuery is a select query constructed from a projector, see
+// buildSelect.
+type selectQuery struct {
+	counter string // count query, empty if not counting
+	finder  string // find query
+	keyset  []any  // args of find query following the filter args
+	reverse bool   // rows found in reverse of the sort order
+}
+
+// buildSelect constructs select query using tmpl, which defines "count"
+// and "find" templates executed on selectData. Order of projector is
+// checked against allowed columns and extended with keys, see
+// db.KeysetOrder. The keyset (if any) is compared against the columns
+// of the order as numbered arguments following argc filter args.
+func buildSelect(
+	tmpl *template.Template,
+	projector *db.Projector,
+	allowed, keys []db.Column,
+	argc int,
+) (selectQuery, error) {
+	var query selectQuery
+	err := CheckOrder(projector, allowed)
+	if err != nil {
+		return query, err
+	}
+	if projector == nil {
+		projector = new(db.Projector)
+	}
+	data := selectData{
+		Order:  db.KeysetOrder(projector.Order, keys),
+		Paging: projector.Paging,
+	}
+	// keyset pagination
+	if paging := projector.Paging; paging != nil {
+		keyset, before := paging.After, false
+		if keyset == nil && paging.Before != nil {
+			keyset, before = paging.Before, true
+		}
+		if keyset != nil {
+			data.Where, err = keysetClause(data.Order, len(keyset), before, argc)
+			if err != nil {
+				return query, err
+			}
+			query.keyset = keyset
+			// fetch backwards from the keyset
+			if before {
+				data.Order = reverseOrder(data.Order)
+				query.reverse = true
+			}
+		}
+	}
+	// construct count query
+	buf := new(bytes.Buffer)
+	if projector.Count {
+		err = tmpl.ExecuteTemplate(buf, "count", data)
+		if err != nil {
+			return query, err
+		}
+		query.counter = buf.String()
+	}
+	// construct find query
+	buf.Reset()
+	err = tmpl.ExecuteTemplate(buf, "find", data)
+	if err != nil {
+		return query, err
+	}
+	query.finder = buf.String()
+	return query, nil
+}
+
+// selectData is the data for executing select query templates. Where is
+// the additional condition (if any) on the found rows.
+type selectData struct {
+	Order  []db.Sorter
+	Paging *db.Paging
+	Where  string
+}
+
+// keysetClause constructs the condition for rows strictly after (or
+// before) the keyset of n numbered arguments following argc args, in
+// order. Like `(a > ?3 OR a = ?3 AND b < ?4)` for order `a, b DESC`.
+func keysetClause(order []db.Sorter, n int, before bool, argc int) (string, error) {
+	if n != len(order) {
+		return "", fmt.Errorf("%w: keyset of %d for %d columns", db.ErrInvalidData, n, len(order))
+	}
+	terms := make([]string, 0, len(order))
+	for i, sorter := range order {
+		var b strings.Builder
+		for j := 0; j < i; j++ {
+			fmt.Fprintf(&b, "%s = ?%d AND ", QuoteIdentifier(order[j].Column.String()), argc+j+1)
+		}
+		op := ">"
+		if sorter.Desc != before {
+			op = "<"
+		}
+		fmt.Fprintf(&b, "%s %s ?%d", QuoteIdentifier(sorter.Column.String()), op, argc+i+1)
+		terms = append(terms, b.String())
+	}
+	return "(" + strings.Join(terms, " OR ") + ")", nil
+}
+
+// reverseOrder gives the reverse of order.
+func reverseOrder(order []db.Sorter) []db.Sorter {
+	reverse := make([]db.Sorter, len(order))
+	for i, sorter := range order {
+		reverse[i] = db.Sorter{Column: sorter.Column, Desc: !sorter.Desc}
+	}
+	return reverse
+}
+
+// queryData is a convenience struct to capture context information
+// as an alternative to writing a closure.
+type queryData[T any] struct {
+	context context.Context
+	sqldb   interface {
+		QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+		QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	}
+	query   selectQuery
+	args    []any
+	scanner func(*sql.Rows) (T, error)
+}
+
+// iterator is the iterator function for constructing [db.Iterable].
+// queryData struct is used to capture variables instead of writing
+// a closure (avoid callback hell). Total is -1 if not counted.
+func (data queryData[T]) iterator(yield func(T) bool) (int, error) {
+	total := -1
+	if data.query.counter != "" {
+		err := data.sqldb.QueryRowContext(data.context, data.query.counter, data.args...).
+			Scan(&total)
+		if err != nil {
+			return 0, err
+		}
+	}
+	args := append(data.args[:len(data.args):len(data.args)], data.query.keyset...)
+	rows, err := data.sqldb.QueryContext(data.context, data.query.finder, args...)
+	if err != nil {
+		return total, Error(err)
+	}
+	defer rows.Close()
+	// rows in reverse are yielded once all are read
+	var buffer []T
+	for rows.Next() {
+		t, err := data.scanner(rows)
+		if err != nil {
+			return total, err
+		}
+		if data.query.reverse {
+			buffer = append(buffer, t)
+			continue
+		}
+		if !yield(t) {
+			break
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		return total, err
+	}
+	for i := len(buffer) - 1; i >= 0; i-- {
+		if !yield(buffer[i]) {
+			break
+		}
+	}
+	return total, nil
+}
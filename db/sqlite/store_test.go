@@ -0,0 +1,90 @@
+package sqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/manojnakp/scount/db"
+	"github.com/manojnakp/scount/db/dbtest"
+	"github.com/manojnakp/scount/db/sqlite"
+)
+
+// TestStore runs the conformance suite against sqlite, every test in a
+// database file of its own.
+func TestStore(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) *db.Store {
+		uri := "sqlite:" + filepath.Join(t.TempDir(), "scount.db")
+		sqldb, err := sql.Open("sqlite3", sqlite.DSN(uri))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = sqldb.Close() })
+		err = sqlite.Migrate(context.Background(), sqldb)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sqlite.NewStore(sqldb)
+	})
+}
+
+// TestMigrate checks that a database created by Schema alone, as by the
+// first release, is brought up to date with its records kept.
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	uri := "sqlite:" + filepath.Join(t.TempDir(), "scount.db")
+	sqldb, err := sql.Open("sqlite3", sqlite.DSN(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = sqldb.Close() })
+	_, err = sqldb.Exec(sqlite.Schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := sqlite.NewStore(sqldb)
+	err = store.Users.Insert(ctx, db.User{Uid: "u1", Email: "u1@example.com", Username: "u1", Password: []byte("x")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = sqldb.Exec(`INSERT INTO scounts (sid, owner, title, description) VALUES ('s1', 'u1', 'Trip', '');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// twice, as on every start
+	for i := 0; i < 2; i++ {
+		err = sqlite.Migrate(ctx, sqldb)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	upgrades, err := sqlite.Upgrades()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var version int
+	err = sqldb.QueryRow("PRAGMA user_version;").Scan(&version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != len(upgrades) {
+		t.Errorf("user_version = %d, want %d", version, len(upgrades))
+	}
+	// trash-aware queries work on the upgraded tables
+	scount, err := store.Scounts.FindOne(ctx, &db.ScountId{Sid: "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scount.Title != "Trip" {
+		t.Errorf("title = %q, want %q", scount.Title, "Trip")
+	}
+	err = store.Scounts.DeleteOne(ctx, &db.ScountId{Sid: "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Activities.Insert(ctx, db.Activity{Aid: "a1", Sid: "s1", Actor: "u1", Kind: db.ActivityScountDeleted})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
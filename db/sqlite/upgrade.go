@@ -0,0 +1,87 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"slices"
+)
+
+// upgradeFiles embeds the upgrade scripts, named like `0001_trash.sql`
+// and applied in order of name.
+//
+//go:embed upgrades/*.sql
+var upgradeFiles embed.FS
+
+// Upgrades gives the SQL scripts bringing a database created by Schema
+// up to date, in order. Schema is the schema as first released and is
+// never changed, as existing databases are left as is by it (tables are
+// created if missing). PRAGMA user_version of a database is the number
+// of upgrades applied to it.
+func Upgrades() ([]string, error) {
+	names, err := fs.Glob(upgradeFiles, "upgrades/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(names)
+	scripts := make([]string, 0, len(names))
+	for _, name := range names {
+		script, err := fs.ReadFile(upgradeFiles, name)
+		if err != nil {
+			return nil, err
+		}
+		scripts = append(scripts, string(script))
+	}
+	return scripts, nil
+}
+
+// Migrate creates the tables of Schema (if missing) on DB and applies
+// the pending Upgrades, each in a transaction of its own along with the
+// bump of PRAGMA user_version.
+func Migrate(ctx context.Context, DB *sql.DB) error {
+	_, err := DB.ExecContext(ctx, Schema)
+	if err != nil {
+		return Error(err)
+	}
+	upgrades, err := Upgrades()
+	if err != nil {
+		return err
+	}
+	for version := range upgrades {
+		err = upgradeOne(ctx, DB, version, upgrades[version])
+		if err != nil {
+			return fmt.Errorf("upgrade %d: %w", version+1, err)
+		}
+	}
+	return nil
+}
+
+// upgradeOne applies script to DB in a transaction, unless DB is past
+// version already, and sets PRAGMA user_version to the next version.
+func upgradeOne(ctx context.Context, DB *sql.DB, version int, script string) error {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var current int
+	err = tx.QueryRowContext(ctx, "PRAGMA user_version;").Scan(&current)
+	if err != nil {
+		return Error(err)
+	}
+	if current > version {
+		return nil
+	}
+	_, err = tx.ExecContext(ctx, script)
+	if err != nil {
+		return Error(err)
+	}
+	// pragma arguments cannot be bound
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d;", version+1))
+	if err != nil {
+		return Error(err)
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,7 @@
+-- deleted_at is in microseconds since the unix epoch, NULL if not in
+-- the trash
+ALTER TABLE scounts
+    ADD COLUMN deleted_at INTEGER;
+
+ALTER TABLE expenses
+    ADD COLUMN deleted_at INTEGER;
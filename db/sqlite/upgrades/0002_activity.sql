@@ -0,0 +1,19 @@
+-- append-only, actors are kept as is once gone; before_value and
+-- after_value are JSON text, time is in microseconds since the unix epoch
+CREATE TABLE IF NOT EXISTS activities
+(
+    sid          TEXT    NOT NULL,
+    aid          TEXT    NOT NULL,
+    actor        TEXT    NOT NULL,
+    kind         TEXT    NOT NULL,
+    target       TEXT    NOT NULL DEFAULT '',
+    time         INTEGER NOT NULL,
+    before_value TEXT,
+    after_value  TEXT,
+    FOREIGN KEY (sid) REFERENCES scounts (sid),
+    PRIMARY KEY (aid),
+    CHECK (before_value IS NULL OR json_valid(before_value)),
+    CHECK (after_value IS NULL OR json_valid(after_value))
+);
+
+CREATE INDEX IF NOT EXISTS activities_sid_idx ON activities (sid, time);
@@ -3,6 +3,8 @@ package db
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 )
 
 // some common errors.
@@ -16,15 +18,95 @@ var (
 	ErrInvalidColumn   = errors.New("db: invalid or non-permissible column")
 )
 
+// errors of refused user deletion, both ErrConflict.
+var (
+	ErrOwnsScounts = fmt.Errorf("%w: user owns scounts", ErrConflict)
+	ErrOpenBalance = fmt.Errorf("%w: user has an open balance", ErrConflict)
+)
+
 // Store provides an interface for all datastore operations in one place.
 type Store struct {
+	// Users.DeleteOne refuses to delete a user who owns scounts (see
+	// ErrOwnsScounts) or whose balance is not zero in some scount (see
+	// ErrOpenBalance), scounts in the trash aside. Otherwise, scounts of
+	// the user in the trash are purged, memberships with expenses or
+	// settlements become guests named FormerMember, the others are
+	// removed, invites created by the user are revoked and the user is
+	// removed.
 	Users interface {
 		Collection[User, UserFilter, UserUpdater, UserId]
 		FindByEmail(ctx context.Context, email string) (User, error)
 		UpdatePassword(context.Context, *PasswordUpdater) error
 	}
-	Scounts Collection[Scount, ScountFilter, ScountUpdater, ScountId]
-	Members Collection[Member, MemberFilter, MemberUpdater, MemberId]
+	// Scounts.DeleteOne moves the scount to the trash, where it is
+	// hidden from FindOne and Find (unless ScountFilter.Trash) until
+	// restored or purged along with its members, expenses, settlements
+	// and invites.
+	Scounts interface {
+		Collection[Scount, ScountFilter, ScountUpdater, ScountId]
+		Trash[ScountId]
+		Balances(ctx context.Context, sid string) ([]Balance, error)
+	}
+	Members interface {
+		Collection[Member, MemberFilter, MemberUpdater, MemberId]
+		// Claim hands over the place of guest member id, along with its
+		// expenses, shares and settlements, to the user uid. If no such
+		// guest, then ErrNoRows. If uid is already a member, then
+		// ErrConflict.
+		Claim(ctx context.Context, id *MemberId, uid string) error
+		// Leave removes member id like DeleteOne, unless it paid or
+		// shares in any expense or settlement. Then the guest member
+		// guest named FormerMember takes its place, along with its
+		// expenses, shares and settlements, as for users deleted. If the
+		// member is a guest with history, then ErrConflict.
+		Leave(ctx context.Context, id *MemberId, guest string) error
+	}
+	// Expenses.DeleteOne moves the expense to the trash, where it is
+	// hidden from FindOne, Find (unless ExpenseFilter.Trash) and the
+	// balances until restored or purged.
+	Expenses interface {
+		Collection[Expense, ExpenseFilter, ExpenseUpdater, ExpenseId]
+		Trash[ExpenseId]
+	}
+	Settlements Collection[Settlement, SettlementFilter, SettlementUpdater, SettlementId]
+	Invites     interface {
+		Collection[Invite, InviteFilter, InviteUpdater, InviteId]
+		// Use records a single use of the invite by id. If not found, then
+		// ErrNoRows. If expired or already used up, then ErrConflict.
+		Use(ctx context.Context, id *InviteId) error
+	}
+	// Activities is the append-only activity feed of every scount, gone
+	// along with the scount. UpdateOne and DeleteOne are not supported.
+	Activities Collection[Activity, ActivityFilter, ActivityUpdater, ActivityId]
+	// Transact runs callback with a store bound to a new transaction,
+	// see WithTx.
+	Transact func(ctx context.Context, callback func(*Store) error) error
+}
+
+// WithTx runs callback as a unit of work: every operation on the store
+// passed to callback is part of a single transaction, committed if
+// callback returns nil and rolled back otherwise (error returned as is).
+// WithTx on that store again makes a nested unit of work, rolled back on
+// its own. The store must not be used after callback returns, nor the
+// outer store within callback; lists found within callback must be
+// consumed before it returns. If not supported, then
+// errors.ErrUnsupported.
+func (s *Store) WithTx(ctx context.Context, callback func(*Store) error) error {
+	if s.Transact == nil {
+		return errors.ErrUnsupported
+	}
+	return s.Transact(ctx, callback)
+}
+
+// Trash is implemented by collections whose records are moved to the
+// trash upon deletion (soft deletion).
+type Trash[Id any] interface {
+	// Restore moves exactly one record back from the trash. If no such
+	// record in the trash, then ErrNoRows.
+	Restore(ctx context.Context, id *Id) error
+	// Purge removes the records moved to the trash before the given time
+	// for good, and gives their number.
+	Purge(ctx context.Context, before time.Time) (int, error)
 }
 
 // Collection is a generic implementation of a collection with
@@ -46,17 +128,60 @@ type Collection[Item, Filter, Updater, Id any] interface {
 	FindOne(ctx context.Context, id *Id) (Item, error)
 }
 
-// Paging provides pagination options for querying the database.
+// Paging provides pagination options for querying the database. Offset
+// skips as many records, while After (or else Before) fetches the records
+// strictly after (or before) the given keyset in the sort order, known
+// as keyset pagination. Records are always in the sort order.
 type Paging struct {
 	Limit  int
 	Offset int
+	After  Keyset
+	Before Keyset
 }
 
 // Projector provides projection options for fetching the
-// data from a collection.
+// data from a collection. Total is counted only if Count.
 type Projector struct {
 	Order  []Sorter // column order matters
 	Paging *Paging  // pagination options
+	Count  bool     // count total records
+}
+
+// Keyset is the values of the sort columns of a record, in the sort
+// order, marking the position of the record for keyset pagination.
+type Keyset []any
+
+// Keyed is implemented by records that give the value of any of their
+// sortable columns.
+type Keyed interface {
+	Key(Column) any
+}
+
+// KeysetOf gives the keyset of record as per order.
+func KeysetOf(record Keyed, order []Sorter) Keyset {
+	keyset := make(Keyset, len(order))
+	for i, sorter := range order {
+		keyset[i] = record.Key(sorter.Column)
+	}
+	return keyset
+}
+
+// KeysetOrder extends order with the key columns (ascending) not in it
+// already, so that no two records are equal in the sort order, as needed
+// for keyset pagination.
+func KeysetOrder(order []Sorter, keys []Column) []Sorter {
+	total := make([]Sorter, len(order), len(order)+len(keys))
+	copy(total, order)
+outer:
+	for _, key := range keys {
+		for _, sorter := range order {
+			if sorter.Column == key {
+				continue outer
+			}
+		}
+		total = append(total, Sorter{Column: key})
+	}
+	return total
 }
 
 // Sorter defines the sorting order for a particular column.
@@ -78,9 +203,10 @@ type Iterable[T any] struct {
 	consumed bool
 }
 
-// Total returns the total number of elements in the list. It
-// is supposed to be called after consuming the list. If it is
-// called before iterating over the list, then call panics.
+// Total returns the total number of elements in the list, or -1 if not
+// counted (see Projector). It is supposed to be called after consuming
+// the list. If it is called before iterating over the list, then call
+// panics.
 func (list *Iterable[T]) Total() int {
 	if !list.consumed {
 		panic("iterator not consumed yet")
@@ -8,6 +8,10 @@ type User struct {
 	Password []byte
 }
 
+// FormerMember is the name of the guest left in place of a deleted user
+// in the scounts with their history.
+const FormerMember = "Former member"
+
 // UserId is the 'id' type for user collection. Uid is primary key or
 // object identifier in the database.
 type UserId struct {
@@ -36,3 +40,19 @@ type UserUpdater struct {
 
 // UserAllowedCols is a list of columns allowed for sorting.
 var UserAllowedCols = []Column{"uid", "email", "username"}
+
+// UserKeyCols is a list of columns that identify a user uniquely.
+var UserKeyCols = []Column{"uid"}
+
+// Key implements Keyed on User.
+func (u User) Key(c Column) any {
+	switch c {
+	case "uid":
+		return u.Uid
+	case "email":
+		return u.Email
+	case "username":
+		return u.Username
+	}
+	return nil
+}
@@ -11,6 +11,8 @@ import (
 	"path"
 
 	"github.com/go-chi/chi/v5"
+
+	"github.com/manojnakp/scount/api"
 )
 
 // filesystem embedding `./docs/static` contains json files (mostly schema definitions),
@@ -54,11 +56,11 @@ func (FileServer) ServeFile(w http.ResponseWriter, filename string) {
 		if errors.Is(err, fs.ErrInvalid) ||
 			errors.Is(err, fs.ErrPermission) ||
 			errors.Is(err, fs.ErrNotExist) {
-			w.WriteHeader(http.StatusNotFound)
+			api.ProblemNotFound.Write(w)
 			return
 		}
 		// otherwise server error
-		w.WriteHeader(http.StatusInternalServerError)
+		api.ProblemInternal.Write(w)
 		return
 	}
 	extension := path.Ext(filename)
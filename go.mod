@@ -6,6 +6,8 @@ require (
 	github.com/go-chi/chi/v5 v5.0.10
 	github.com/lestrrat-go/jwx/v2 v2.0.12
 	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.33
+	github.com/santhosh-tekuri/jsonschema/v5 v5.3.1
 	golang.org/x/crypto v0.13.0
 )
 
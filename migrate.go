@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/manojnakp/scount/db/postgres"
+)
+
+// migrateUsage is the usage of the migrate subcommand.
+const migrateUsage = "usage: scount migrate [up | down [steps] | status]"
+
+// migrateMode parses the DB_MIGRATE setting, what to do about pending
+// migrations at startup: `apply` (default), `check` or `skip`.
+func migrateMode(s string) (postgres.MigrateMode, error) {
+	switch strings.ToLower(s) {
+	case "", "apply":
+		return postgres.MigrateApply, nil
+	case "check":
+		return postgres.MigrateCheck, nil
+	case "skip":
+		return postgres.MigrateSkip, nil
+	default:
+		return 0, fmt.Errorf("invalid DB_MIGRATE %q, want apply, check or skip", s)
+	}
+}
+
+// Migrate runs the migrate subcommand with args against the postgres
+// database at DB_URI. It applies the pending migrations (up), rolls back
+// the last steps (default 1) applied migrations (down) or lists the
+// migrations and whether applied (status).
+func Migrate(args []string) error {
+	uri := dbURI()
+	if scheme, _, _ := strings.Cut(uri, ":"); scheme != "postgres" && scheme != "postgresql" {
+		return fmt.Errorf("migrations apply to postgres only, not %q", scheme)
+	}
+	sqldb, err := sql.Open("postgres", uri)
+	if err != nil {
+		return err
+	}
+	defer sqldb.Close()
+	ctx := context.Background()
+	command := "up"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	switch {
+	case command == "up" && len(args) == 0:
+		done, err := postgres.Migrate(ctx, sqldb)
+		for _, m := range done {
+			fmt.Println("applied", m)
+		}
+		return err
+	case command == "down" && len(args) <= 1:
+		steps := 1
+		if len(args) == 1 {
+			steps, err = strconv.Atoi(args[0])
+			if err != nil || steps < 1 {
+				return errors.New(migrateUsage)
+			}
+		}
+		done, err := postgres.Rollback(ctx, sqldb, steps)
+		for _, m := range done {
+			fmt.Println("rolled back", m)
+		}
+		return err
+	case command == "status" && len(args) == 0:
+		migrations, err := postgres.Migrations()
+		if err != nil {
+			return err
+		}
+		pending, err := postgres.Pending(ctx, sqldb)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			state := "applied"
+			for _, p := range pending {
+				if p.Version == m.Version {
+					state = "pending"
+				}
+			}
+			fmt.Printf("%s\t%s\n", m, state)
+		}
+		return nil
+	default:
+		return errors.New(migrateUsage)
+	}
+}
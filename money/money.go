@@ -0,0 +1,288 @@
+// Package money provides exact arithmetic on amounts of money, held as
+// integer minor units (like cents) of an ISO 4217 currency.
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// some common errors.
+var (
+	ErrCurrency = errors.New("money: unknown currency")
+	ErrMismatch = errors.New("money: currency mismatch")
+	ErrFormat   = errors.New("money: invalid amount format")
+	ErrOverflow = errors.New("money: amount overflow")
+	ErrAllocate = errors.New("money: invalid allocation weights")
+)
+
+// Amount is an exact amount of money in minor units of a currency.
+// The zero value is a zero amount of no currency.
+type Amount struct {
+	Minor    int64    // minor units, like cents
+	Currency Currency // ISO 4217 code
+}
+
+// New constructs an amount of minor units in currency c.
+func New(minor int64, c Currency) Amount {
+	return Amount{Minor: minor, Currency: c}
+}
+
+// Parse parses a decimal string like "-12.34" into an amount of
+// currency c. More fractional digits than the minor units of c are
+// rejected rather than rounded.
+func Parse(s string, c Currency) (Amount, error) {
+	var zero Amount
+	exp, err := c.Exponent()
+	if err != nil {
+		return zero, err
+	}
+	str := s
+	negative := false
+	switch {
+	case strings.HasPrefix(str, "-"):
+		negative = true
+		str = str[1:]
+	case strings.HasPrefix(str, "+"):
+		str = str[1:]
+	}
+	whole, frac, dotted := strings.Cut(str, ".")
+	if whole == "" || dotted && frac == "" || len(frac) > exp ||
+		!digits(whole) || !digits(frac) {
+		return zero, fmt.Errorf("%w: %q", ErrFormat, s)
+	}
+	// pad fraction up to minor units
+	frac += strings.Repeat("0", exp-len(frac))
+	minor, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return zero, fmt.Errorf("%w: %q", ErrOverflow, s)
+	}
+	if negative {
+		minor = -minor
+	}
+	return New(minor, c), nil
+}
+
+// digits reports whether s consists of ASCII digits only.
+func digits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Decimal formats the amount as a decimal string like "-12.34" with
+// exactly as many fractional digits as the minor units of currency.
+func (a Amount) Decimal() string {
+	exp, err := a.Currency.Exponent()
+	if err != nil {
+		exp = 0
+	}
+	sign := ""
+	abs := uint64(a.Minor)
+	if a.Minor < 0 {
+		sign = "-"
+		abs = -abs
+	}
+	s := strconv.FormatUint(abs, 10)
+	if exp == 0 {
+		return sign + s
+	}
+	// left pad with zeros for at least one whole digit
+	if len(s) <= exp {
+		s = strings.Repeat("0", exp-len(s)+1) + s
+	}
+	return sign + s[:len(s)-exp] + "." + s[len(s)-exp:]
+}
+
+// String implements fmt.Stringer on Amount, like "12.34 EUR".
+func (a Amount) String() string {
+	return a.Decimal() + " " + a.Currency.String()
+}
+
+// IsZero reports whether the amount is zero (in any currency).
+func (a Amount) IsZero() bool {
+	return a.Minor == 0
+}
+
+// Sign gives -1, 0 or +1 depending on the sign of the amount.
+func (a Amount) Sign() int {
+	switch {
+	case a.Minor < 0:
+		return -1
+	case a.Minor > 0:
+		return +1
+	}
+	return 0
+}
+
+// Neg gives the negated amount.
+func (a Amount) Neg() Amount {
+	return New(-a.Minor, a.Currency)
+}
+
+// Add gives the sum of a and b. If currencies differ, then ErrMismatch.
+func (a Amount) Add(b Amount) (Amount, error) {
+	if a.Currency != b.Currency {
+		return a, fmt.Errorf("%w: %s and %s", ErrMismatch, a.Currency, b.Currency)
+	}
+	sum := a.Minor + b.Minor
+	// overflow iff both operands have the same sign, different from sum
+	if (a.Minor >= 0) == (b.Minor >= 0) && (sum >= 0) != (a.Minor >= 0) {
+		return a, ErrOverflow
+	}
+	return New(sum, a.Currency), nil
+}
+
+// Sub gives the difference of a and b. If currencies differ, then ErrMismatch.
+func (a Amount) Sub(b Amount) (Amount, error) {
+	if b.Minor == math.MinInt64 {
+		return a, ErrOverflow
+	}
+	return a.Add(b.Neg())
+}
+
+// Cmp compares a and b, giving -1, 0 or +1. If currencies differ, then ErrMismatch.
+func (a Amount) Cmp(b Amount) (int, error) {
+	if a.Currency != b.Currency {
+		return 0, fmt.Errorf("%w: %s and %s", ErrMismatch, a.Currency, b.Currency)
+	}
+	switch {
+	case a.Minor < b.Minor:
+		return -1, nil
+	case a.Minor > b.Minor:
+		return +1, nil
+	}
+	return 0, nil
+}
+
+// Allocate divides the amount in proportion to weights without losing
+// a single minor unit. Remainder left after proportional division is
+// handed out one minor unit at a time to the largest fractional parts,
+// ties broken by position in weights. Weights must be non-negative with
+// a positive sum, otherwise ErrAllocate.
+func (a Amount) Allocate(weights ...int64) ([]Amount, error) {
+	var sum uint64
+	for _, w := range weights {
+		if w < 0 {
+			return nil, fmt.Errorf("%w: negative weight", ErrAllocate)
+		}
+		var carry uint64
+		sum, carry = bits.Add64(sum, uint64(w), 0)
+		if carry != 0 {
+			return nil, ErrOverflow
+		}
+	}
+	if sum == 0 {
+		return nil, fmt.Errorf("%w: no weight", ErrAllocate)
+	}
+	abs := uint64(a.Minor)
+	if a.Minor < 0 {
+		abs = -abs
+	}
+	parts := make([]uint64, len(weights))
+	remainders := make([]uint64, len(weights))
+	left := abs
+	for i, w := range weights {
+		// abs * w / sum never exceeds abs, hence no overflow
+		hi, lo := bits.Mul64(abs, uint64(w))
+		parts[i], remainders[i] = bits.Div64(hi, lo, sum)
+		left -= parts[i]
+	}
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return remainders[order[i]] > remainders[order[j]]
+	})
+	// left is less than number of parts with non-zero remainder
+	for _, i := range order[:left] {
+		parts[i]++
+	}
+	amounts := make([]Amount, len(weights))
+	for i, p := range parts {
+		minor := int64(p)
+		if a.Minor < 0 {
+			minor = -int64(p)
+		}
+		amounts[i] = New(minor, a.Currency)
+	}
+	return amounts, nil
+}
+
+// Split divides the amount equally into n parts, see Allocate.
+func (a Amount) Split(n int) ([]Amount, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("%w: no parts", ErrAllocate)
+	}
+	weights := make([]int64, n)
+	for i := range weights {
+		weights[i] = 1
+	}
+	return a.Allocate(weights...)
+}
+
+// jsonAmount is the JSON representation of Amount.
+type jsonAmount struct {
+	Value    string   `json:"value"`
+	Currency Currency `json:"currency"`
+}
+
+// MarshalJSON implements json.Marshaler on Amount, like
+// `{"value":"12.34","currency":"EUR"}`.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonAmount{Value: a.Decimal(), Currency: a.Currency})
+}
+
+// UnmarshalJSON implements json.Unmarshaler on Amount. The value must be
+// a decimal string and currency a known ISO 4217 code.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	var v jsonAmount
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		return err
+	}
+	amount, err := Parse(v.Value, v.Currency)
+	if err != nil {
+		return err
+	}
+	*a = amount
+	return nil
+}
+
+// Value implements driver.Valuer on Amount giving the minor units only.
+// Currency is supposed to be stored in a column of its own.
+func (a Amount) Value() (driver.Value, error) {
+	return a.Minor, nil
+}
+
+// Scan implements sql.Scanner on Amount reading the minor units only,
+// currency is left untouched. Currency is supposed to be scanned from
+// a column of its own.
+func (a *Amount) Scan(src any) error {
+	switch src := src.(type) {
+	case int64:
+		a.Minor = src
+	case []byte:
+		return a.Scan(string(src))
+	case string:
+		minor, err := strconv.ParseInt(src, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: %q", ErrFormat, src)
+		}
+		a.Minor = minor
+	default:
+		return fmt.Errorf("%w: cannot scan %T into amount", ErrFormat, src)
+	}
+	return nil
+}
@@ -0,0 +1,312 @@
+package money_test
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"math/big"
+	"reflect"
+	"testing"
+	"testing/quick"
+
+	"github.com/manojnakp/scount/money"
+)
+
+// currencies of every exponent in use.
+var currencies = []money.Currency{"JPY", "EUR", "BHD", "CLF"}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		s        string
+		currency money.Currency
+		want     int64
+		err      error
+	}{
+		{"12.34", "EUR", 1234, nil},
+		{"12.3", "EUR", 1230, nil},
+		{"12", "EUR", 1200, nil},
+		{"+7", "EUR", 700, nil},
+		{"-0.05", "EUR", -5, nil},
+		{"0", "EUR", 0, nil},
+		{"5", "JPY", 5, nil},
+		{"1.234", "BHD", 1234, nil},
+		{"0.0001", "CLF", 1, nil},
+		{"92233720368547758.07", "EUR", math.MaxInt64, nil},
+		{"-92233720368547758.07", "EUR", -math.MaxInt64, nil},
+		{"92233720368547758.08", "EUR", 0, money.ErrOverflow},
+		{"9223372036854775808", "JPY", 0, money.ErrOverflow},
+		{"12.345", "EUR", 0, money.ErrFormat},
+		{"1.5", "JPY", 0, money.ErrFormat},
+		{"", "EUR", 0, money.ErrFormat},
+		{"-", "EUR", 0, money.ErrFormat},
+		{".5", "EUR", 0, money.ErrFormat},
+		{"5.", "EUR", 0, money.ErrFormat},
+		{"1e3", "EUR", 0, money.ErrFormat},
+		{" 1", "EUR", 0, money.ErrFormat},
+		{"1,00", "EUR", 0, money.ErrFormat},
+		{"--1", "EUR", 0, money.ErrFormat},
+		{"1", "XYZ", 0, money.ErrCurrency},
+		{"1", "", 0, money.ErrCurrency},
+	}
+	for _, tt := range tests {
+		got, err := money.Parse(tt.s, tt.currency)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Parse(%q, %s) error = %v, want %v", tt.s, tt.currency, err, tt.err)
+			continue
+		}
+		if tt.err == nil && got != money.New(tt.want, tt.currency) {
+			t.Errorf("Parse(%q, %s) = %v, want %d minor units", tt.s, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	tests := []struct {
+		amount money.Amount
+		want   string
+	}{
+		{money.New(0, "EUR"), "0.00"},
+		{money.New(5, "EUR"), "0.05"},
+		{money.New(-5, "EUR"), "-0.05"},
+		{money.New(1234, "EUR"), "12.34"},
+		{money.New(-100, "EUR"), "-1.00"},
+		{money.New(5, "JPY"), "5"},
+		{money.New(-5, "JPY"), "-5"},
+		{money.New(1, "BHD"), "0.001"},
+		{money.New(12345, "CLF"), "1.2345"},
+		{money.New(math.MaxInt64, "EUR"), "92233720368547758.07"},
+		{money.New(math.MinInt64, "EUR"), "-92233720368547758.08"},
+	}
+	for _, tt := range tests {
+		got := tt.amount.Decimal()
+		if got != tt.want {
+			t.Errorf("New(%d, %s).Decimal() = %q, want %q", tt.amount.Minor, tt.amount.Currency, got, tt.want)
+		}
+	}
+}
+
+// TestDecimalParse checks that Parse reads back every amount formatted
+// by Decimal, across currency exponents.
+func TestDecimalParse(t *testing.T) {
+	property := func(minor int64, i uint8) bool {
+		if minor == math.MinInt64 { // no positive counterpart
+			minor++
+		}
+		a := money.New(minor, currencies[int(i)%len(currencies)])
+		b, err := money.Parse(a.Decimal(), a.Currency)
+		return err == nil && a == b
+	}
+	err := quick.Check(property, nil)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAddSub(t *testing.T) {
+	eur := func(minor int64) money.Amount { return money.New(minor, "EUR") }
+	tests := []struct {
+		name string
+		op   func(a, b money.Amount) (money.Amount, error)
+		a, b money.Amount
+		want money.Amount
+		err  error
+	}{
+		{"add", money.Amount.Add, eur(150), eur(-250), eur(-100), nil},
+		{"add max", money.Amount.Add, eur(math.MaxInt64 - 1), eur(1), eur(math.MaxInt64), nil},
+		{"add overflow", money.Amount.Add, eur(math.MaxInt64), eur(1), money.Amount{}, money.ErrOverflow},
+		{"add underflow", money.Amount.Add, eur(math.MinInt64), eur(-1), money.Amount{}, money.ErrOverflow},
+		{"add mismatch", money.Amount.Add, eur(1), money.New(1, "USD"), money.Amount{}, money.ErrMismatch},
+		{"sub", money.Amount.Sub, eur(150), eur(250), eur(-100), nil},
+		{"sub min", money.Amount.Sub, eur(-1), eur(math.MaxInt64), eur(math.MinInt64), nil},
+		{"sub overflow", money.Amount.Sub, eur(0), eur(math.MinInt64), money.Amount{}, money.ErrOverflow},
+		{"sub underflow", money.Amount.Sub, eur(math.MinInt64), eur(1), money.Amount{}, money.ErrOverflow},
+		{"sub mismatch", money.Amount.Sub, eur(1), money.New(1, "USD"), money.Amount{}, money.ErrMismatch},
+	}
+	for _, tt := range tests {
+		got, err := tt.op(tt.a, tt.b)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if tt.err == nil && got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		minor   int64
+		weights []int64
+		want    []int64
+		err     error
+	}{
+		{"even", 300, []int64{1, 1, 1}, []int64{100, 100, 100}, nil},
+		{"remainder to first", 100, []int64{1, 1, 1}, []int64{34, 33, 33}, nil},
+		{"remainder to largest fraction", 100, []int64{1, 2, 3}, []int64{17, 33, 50}, nil},
+		{"remainder spread", 5, []int64{1, 1, 1, 1, 1, 1, 1}, []int64{1, 1, 1, 1, 1, 0, 0}, nil},
+		{"negative", -100, []int64{1, 1, 1}, []int64{-34, -33, -33}, nil},
+		{"zero weight", 10, []int64{0, 1}, []int64{0, 10}, nil},
+		{"zero amount", 0, []int64{1, 2}, []int64{0, 0}, nil},
+		{"max", math.MaxInt64, []int64{1, 1}, []int64{math.MaxInt64/2 + 1, math.MaxInt64 / 2}, nil},
+		{"min", math.MinInt64, []int64{1}, []int64{math.MinInt64}, nil},
+		{"no weights", 100, nil, nil, money.ErrAllocate},
+		{"all zero", 100, []int64{0, 0}, nil, money.ErrAllocate},
+		{"negative weight", 100, []int64{2, -1}, nil, money.ErrAllocate},
+		{"weight overflow", 100, []int64{math.MaxInt64, math.MaxInt64, 2}, nil, money.ErrOverflow},
+	}
+	for _, tt := range tests {
+		got, err := money.New(tt.minor, "EUR").Allocate(tt.weights...)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if tt.err != nil {
+			continue
+		}
+		minors := make([]int64, len(got))
+		for i, a := range got {
+			minors[i] = a.Minor
+			if a.Currency != "EUR" {
+				t.Errorf("%s: part %d in %s", tt.name, i, a.Currency)
+			}
+		}
+		if !reflect.DeepEqual(minors, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, minors, tt.want)
+		}
+	}
+}
+
+// TestAllocateExact checks that the parts add up exactly to the amount,
+// each within a minor unit of its exact proportional share and of the
+// same sign as the amount.
+func TestAllocateExact(t *testing.T) {
+	property := func(minor int64, weights []uint16) bool {
+		ws := make([]int64, 0, len(weights)+1)
+		sum := big.NewInt(1)
+		ws = append(ws, 1) // positive sum of weights
+		for _, w := range weights {
+			ws = append(ws, int64(w))
+			sum.Add(sum, big.NewInt(int64(w)))
+		}
+		parts, err := money.New(minor, "EUR").Allocate(ws...)
+		if err != nil || len(parts) != len(ws) {
+			t.Log(err)
+			return false
+		}
+		total := new(big.Int)
+		for i, part := range parts {
+			p := big.NewInt(part.Minor)
+			total.Add(total, p)
+			if part.Sign()*money.New(minor, "EUR").Sign() < 0 {
+				t.Logf("part %d = %d of %d", i, part.Minor, minor)
+				return false
+			}
+			// |part * sum - minor * w| < sum
+			diff := new(big.Int).Mul(p, sum)
+			diff.Sub(diff, new(big.Int).Mul(big.NewInt(minor), big.NewInt(ws[i])))
+			if diff.Abs(diff).Cmp(sum) >= 0 {
+				t.Logf("part %d = %d off its share of %d", i, part.Minor, minor)
+				return false
+			}
+		}
+		return total.Cmp(big.NewInt(minor)) == 0
+	}
+	err := quick.Check(property, nil)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	parts, err := money.New(1000, "EUR").Split(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []money.Amount{money.New(334, "EUR"), money.New(333, "EUR"), money.New(333, "EUR")}
+	if !reflect.DeepEqual(parts, want) {
+		t.Errorf("Split(3) = %v, want %v", parts, want)
+	}
+	for _, n := range []int{0, -1} {
+		_, err = money.New(1000, "EUR").Split(n)
+		if !errors.Is(err, money.ErrAllocate) {
+			t.Errorf("Split(%d) error = %v, want %v", n, err, money.ErrAllocate)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	for _, a := range []money.Amount{
+		money.New(1234, "EUR"),
+		money.New(-5, "EUR"),
+		money.New(5, "JPY"),
+		money.New(1, "BHD"),
+		money.New(math.MaxInt64, "CLF"),
+	} {
+		b, err := json.Marshal(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got money.Amount
+		err = json.Unmarshal(b, &got)
+		if err != nil {
+			t.Errorf("Unmarshal(%s) error = %v", b, err)
+			continue
+		}
+		if got != a {
+			t.Errorf("Unmarshal(%s) = %v, want %v", b, got, a)
+		}
+	}
+	b, _ := json.Marshal(money.New(1234, "EUR"))
+	if string(b) != `{"value":"12.34","currency":"EUR"}` {
+		t.Errorf("Marshal() = %s", b)
+	}
+	for _, s := range []string{
+		`{"value":"12.345","currency":"EUR"}`,
+		`{"value":"12.34","currency":"XYZ"}`,
+		`{"value":12.34,"currency":"EUR"}`,
+		`{"currency":"EUR"}`,
+		`"12.34"`,
+	} {
+		var a money.Amount
+		err := json.Unmarshal([]byte(s), &a)
+		if err == nil {
+			t.Errorf("Unmarshal(%s) = %v, want error", s, a)
+		}
+	}
+}
+
+func TestSQL(t *testing.T) {
+	a := money.New(-1234, "EUR")
+	v, err := a.Value()
+	if err != nil || v != int64(-1234) {
+		t.Errorf("Value() = %v, %v, want -1234", v, err)
+	}
+	for _, src := range []any{int64(-1234), "-1234", []byte("-1234")} {
+		// currency is left as is
+		got := money.New(0, "EUR")
+		err = got.Scan(src)
+		if err != nil || got != a {
+			t.Errorf("Scan(%#v) = %v, %v, want %v", src, got, err, a)
+		}
+	}
+	for _, src := range []any{"12.34", 12.34, nil, true} {
+		var got money.Amount
+		err = got.Scan(src)
+		if !errors.Is(err, money.ErrFormat) {
+			t.Errorf("Scan(%#v) error = %v, want %v", src, err, money.ErrFormat)
+		}
+	}
+	var c money.Currency
+	for _, src := range []any{"EUR", []byte("EUR")} {
+		err = c.Scan(src)
+		if err != nil || c != "EUR" {
+			t.Errorf("Currency.Scan(%#v) = %q, %v", src, c, err)
+		}
+	}
+	err = c.Scan(nil)
+	if err != nil || c != "" {
+		t.Errorf("Currency.Scan(nil) = %q, %v", c, err)
+	}
+}
@@ -0,0 +1,258 @@
+package money
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// ErrRate is returned when an exchange rate is not available.
+var ErrRate = errors.New("money: exchange rate unavailable")
+
+// RatePrecision is the number of decimal digits kept in exchange rates,
+// so that every rate has an exact and short decimal representation.
+const RatePrecision = 10
+
+// ExchangeRates is the source of exchange rates between currencies.
+type ExchangeRates interface {
+	// Rate gives the rate for converting amounts of currency from into
+	// currency to. If not available, then ErrRate.
+	Rate(ctx context.Context, from, to Currency) (Rate, error)
+}
+
+// Rate is an exact exchange rate. Ratio is the number of major units
+// (like euros) of To for a single major unit of From.
+type Rate struct {
+	From  Currency
+	To    Currency
+	Ratio *big.Rat
+}
+
+// NewRate constructs an exchange rate from currency from into currency
+// to, rounding ratio to RatePrecision decimal digits.
+func NewRate(from, to Currency, ratio *big.Rat) Rate {
+	scale := pow10(RatePrecision)
+	scaled := new(big.Rat).Mul(ratio, new(big.Rat).SetInt(scale))
+	return Rate{
+		From:  from,
+		To:    to,
+		Ratio: new(big.Rat).SetFrac(round(scaled), scale),
+	}
+}
+
+// Identity gives the exchange rate of c into itself.
+func Identity(c Currency) Rate {
+	return Rate{From: c, To: c, Ratio: big.NewRat(1, 1)}
+}
+
+// ParseRate parses a positive decimal string like "1.0850" into the
+// exchange rate from currency from into currency to.
+func ParseRate(from, to Currency, s string) (Rate, error) {
+	ratio, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok || ratio.Sign() <= 0 {
+		return Rate{}, fmt.Errorf("%w: rate %q", ErrFormat, s)
+	}
+	return NewRate(from, to, ratio), nil
+}
+
+// Decimal gives the decimal string representation of the ratio without
+// trailing zeros, like "1.085". Empty if the ratio is missing.
+func (r Rate) Decimal() string {
+	if r.Ratio == nil {
+		return ""
+	}
+	s := r.Ratio.FloatString(RatePrecision)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// String implements fmt.Stringer on Rate, like "EUR/USD 1.085".
+func (r Rate) String() string {
+	return string(r.From) + "/" + string(r.To) + " " + r.Decimal()
+}
+
+// Convert converts amount a of currency From into currency To, rounding
+// half away from zero to the minor units of To. If a is not in currency
+// From, then ErrMismatch.
+func (r Rate) Convert(a Amount) (Amount, error) {
+	var zero Amount
+	if a.Currency != r.From {
+		return zero, fmt.Errorf("%w: %s into %s", ErrMismatch, a.Currency, r)
+	}
+	if r.Ratio == nil {
+		return zero, fmt.Errorf("%w: %s", ErrRate, r)
+	}
+	expFrom, err := r.From.Exponent()
+	if err != nil {
+		return zero, err
+	}
+	expTo, err := r.To.Exponent()
+	if err != nil {
+		return zero, err
+	}
+	// minor(To) = minor(From) * ratio * 10^expTo / 10^expFrom
+	value := new(big.Rat).SetInt64(a.Minor)
+	value.Mul(value, r.Ratio)
+	value.Mul(value, new(big.Rat).SetFrac(pow10(expTo), pow10(expFrom)))
+	minor := round(value)
+	if !minor.IsInt64() {
+		return zero, ErrOverflow
+	}
+	return New(minor.Int64(), r.To), nil
+}
+
+// Value implements driver.Valuer on Rate giving the decimal ratio only.
+// Currencies are supposed to be stored in columns of their own.
+func (r Rate) Value() (driver.Value, error) {
+	if r.Ratio == nil {
+		return nil, nil
+	}
+	return r.Decimal(), nil
+}
+
+// Scan implements sql.Scanner on Rate reading the decimal ratio only,
+// currencies are left untouched.
+func (r *Rate) Scan(src any) error {
+	switch src := src.(type) {
+	case []byte:
+		return r.Scan(string(src))
+	case string:
+		ratio, ok := new(big.Rat).SetString(src)
+		if !ok {
+			return fmt.Errorf("%w: rate %q", ErrFormat, src)
+		}
+		r.Ratio = ratio
+	case float64:
+		r.Ratio = new(big.Rat).SetFloat64(src)
+	case int64:
+		r.Ratio = new(big.Rat).SetInt64(src)
+	case nil:
+		r.Ratio = nil
+	default:
+		return fmt.Errorf("%w: cannot scan %T into rate", ErrFormat, src)
+	}
+	return nil
+}
+
+// pow10 gives 10^n as a big integer.
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// round rounds x half away from zero to an integer.
+func round(x *big.Rat) *big.Int {
+	quo, rem := new(big.Int).QuoRem(x.Num(), x.Denom(), new(big.Int))
+	// |2 * rem| >= denominator: round away from zero
+	rem.Abs(rem).Lsh(rem, 1)
+	if rem.Cmp(x.Denom()) >= 0 {
+		quo.Add(quo, big.NewInt(int64(x.Sign())))
+	}
+	return quo
+}
+
+// StaticRates is ExchangeRates backed by a fixed table of rates, which
+// works offline. Rates maps every currency to the number of its major
+// units for a single major unit of Base.
+type StaticRates struct {
+	Base  Currency
+	Rates map[Currency]*big.Rat
+}
+
+// Rate implements ExchangeRates on StaticRates. Rates between any two
+// currencies of the table are derived through Base.
+func (s StaticRates) Rate(_ context.Context, from, to Currency) (Rate, error) {
+	if from == to {
+		return Identity(from), nil
+	}
+	rfrom, err := s.ratio(from)
+	if err != nil {
+		return Rate{}, err
+	}
+	rto, err := s.ratio(to)
+	if err != nil {
+		return Rate{}, err
+	}
+	return NewRate(from, to, new(big.Rat).Quo(rto, rfrom)), nil
+}
+
+// ratio gives the rate of Base into currency c.
+func (s StaticRates) ratio(c Currency) (*big.Rat, error) {
+	if c == s.Base {
+		return big.NewRat(1, 1), nil
+	}
+	ratio, ok := s.Rates[c]
+	if !ok || ratio.Sign() <= 0 {
+		return nil, fmt.Errorf("%w: %s/%s", ErrRate, s.Base, c)
+	}
+	return ratio, nil
+}
+
+// jsonRates is the JSON representation of StaticRates, with rates as
+// decimal strings, like `{"base":"EUR","rates":{"USD":"1.085"}}`.
+type jsonRates struct {
+	Base  Currency            `json:"base"`
+	Rates map[Currency]string `json:"rates"`
+}
+
+// ReadRates reads StaticRates in JSON from r.
+func ReadRates(r io.Reader) (StaticRates, error) {
+	var v jsonRates
+	err := json.NewDecoder(r).Decode(&v)
+	if err != nil {
+		return StaticRates{}, err
+	}
+	if !v.Base.Valid() {
+		return StaticRates{}, fmt.Errorf("%w: %q", ErrCurrency, string(v.Base))
+	}
+	rates := StaticRates{
+		Base:  v.Base,
+		Rates: make(map[Currency]*big.Rat, len(v.Rates)),
+	}
+	for c, s := range v.Rates {
+		if !c.Valid() {
+			return StaticRates{}, fmt.Errorf("%w: %q", ErrCurrency, string(c))
+		}
+		rate, err := ParseRate(v.Base, c, s)
+		if err != nil {
+			return StaticRates{}, err
+		}
+		rates.Rates[c] = rate.Ratio
+	}
+	return rates, nil
+}
+
+// LoadRates reads StaticRates in JSON from the named file.
+func LoadRates(name string) (StaticRates, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return StaticRates{}, err
+	}
+	defer f.Close()
+	return ReadRates(f)
+}
+
+// defaultRates is the table of rates shipped along with the package.
+//
+//go:embed rates.json
+var defaultRates []byte
+
+// DefaultRates is the table of rates shipped along with the package,
+// that is a snapshot of reference rates against the euro.
+var DefaultRates = func() StaticRates {
+	rates, err := ReadRates(bytes.NewReader(defaultRates))
+	if err != nil {
+		panic(err)
+	}
+	return rates
+}()
+
+// compile-time assertion
+var _ ExchangeRates = StaticRates{}
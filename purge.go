@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/manojnakp/scount/db"
+)
+
+// Defaults of the purge job.
+const (
+	TrashRetention = 30 * 24 * time.Hour // how long items stay in the trash
+	PurgeInterval  = time.Hour           // how often the trash is purged
+)
+
+// trashRetention parses the TRASH_RETENTION setting, a duration like
+// `720h`, defaulting to TrashRetention.
+func trashRetention(s string) (time.Duration, error) {
+	if s == "" {
+		return TrashRetention, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid TRASH_RETENTION %q, want a duration like 720h", s)
+	}
+	return d, nil
+}
+
+// Purge removes the scounts and expenses in the trash of store for
+// good every PurgeInterval, once they are older than retention. It
+// returns when ctx is done.
+func Purge(ctx context.Context, store *db.Store, retention time.Duration) {
+	ticker := time.NewTicker(PurgeInterval)
+	defer ticker.Stop()
+	for {
+		before := time.Now().Add(-retention)
+		scounts, err := store.Scounts.Purge(ctx, before)
+		if err != nil {
+			log.Println("purge scounts:", err)
+		}
+		expenses, err := store.Expenses.Purge(ctx, before)
+		if err != nil {
+			log.Println("purge expenses:", err)
+		}
+		if scounts+expenses > 0 {
+			log.Printf("purged %d scounts and %d expenses from the trash", scounts, expenses)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
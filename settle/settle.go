@@ -0,0 +1,161 @@
+// Package settle plans the transfers that settle up the balances of
+// members, that is bring every balance to zero.
+//
+// Finding the least number of transfers is NP-hard (it reduces to
+// subset sum), so the planner uses a greedy heuristic: members whose
+// debts and credits match exactly are paired first, then the largest
+// debtor repeatedly pays the largest creditor. Such a plan needs at most
+// n-1 transfers for n members with non-zero balance, and is deterministic
+// for the same set of balances.
+package settle
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrUnbalanced is reported when balances in a currency do not add up to zero.
+var ErrUnbalanced = errors.New("settle: balances do not add up to zero")
+
+// Balance is the net position of a member in a currency (in minor units).
+// Positive amount means the member is owed money by others, whereas
+// negative amount means the member owes money to others.
+type Balance struct {
+	Member   string
+	Currency string
+	Amount   int64
+}
+
+// Transfer is a payment of amount from one member to another in a currency.
+type Transfer struct {
+	From     string
+	To       string
+	Currency string
+	Amount   int64
+}
+
+// Plan computes a list of transfers that brings every balance to zero.
+// Every currency is planned separately, and balances of the same member
+// in the same currency are merged. Transfers are ordered by currency.
+// If balances in any currency do not add up to zero, then ErrUnbalanced.
+func Plan(balances []Balance) ([]Transfer, error) {
+	// merge balances per currency per member
+	ledger := make(map[string]map[string]int64)
+	for _, b := range balances {
+		members, ok := ledger[b.Currency]
+		if !ok {
+			members = make(map[string]int64)
+			ledger[b.Currency] = members
+		}
+		members[b.Member] += b.Amount
+	}
+	currencies := make([]string, 0, len(ledger))
+	for currency := range ledger {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	transfers := make([]Transfer, 0)
+	for _, currency := range currencies {
+		plan, err := planCurrency(currency, ledger[currency])
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, plan...)
+	}
+	return transfers, nil
+}
+
+// position is the outstanding amount of a member, always positive.
+type position struct {
+	member string
+	amount int64
+}
+
+// planCurrency plans the transfers for balances of members in a single currency.
+func planCurrency(currency string, members map[string]int64) ([]Transfer, error) {
+	var (
+		sum       int64
+		debtors   []position
+		creditors []position
+	)
+	for member, amount := range members {
+		sum += amount
+		switch {
+		case amount < 0:
+			debtors = append(debtors, position{member, -amount})
+		case amount > 0:
+			creditors = append(creditors, position{member, amount})
+		}
+	}
+	if sum != 0 {
+		return nil, fmt.Errorf("%w: %q off by %d", ErrUnbalanced, currency, sum)
+	}
+	byMember := func(list []position) {
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].member < list[j].member
+		})
+	}
+	byMember(debtors)
+	byMember(creditors)
+	transfers := make([]Transfer, 0)
+	// pair exact matches first: a single transfer settles both
+	for i := range debtors {
+		for j := range creditors {
+			if creditors[j].amount != 0 && creditors[j].amount == debtors[i].amount {
+				transfers = append(transfers, Transfer{
+					From:     debtors[i].member,
+					To:       creditors[j].member,
+					Currency: currency,
+					Amount:   debtors[i].amount,
+				})
+				debtors[i].amount = 0
+				creditors[j].amount = 0
+				break
+			}
+		}
+	}
+	debtors = outstanding(debtors)
+	creditors = outstanding(creditors)
+	// largest debtor pays largest creditor
+	for len(debtors) > 0 && len(creditors) > 0 {
+		largest(debtors)
+		largest(creditors)
+		amount := min(debtors[0].amount, creditors[0].amount)
+		transfers = append(transfers, Transfer{
+			From:     debtors[0].member,
+			To:       creditors[0].member,
+			Currency: currency,
+			Amount:   amount,
+		})
+		debtors[0].amount -= amount
+		creditors[0].amount -= amount
+		debtors = outstanding(debtors)
+		creditors = outstanding(creditors)
+	}
+	return transfers, nil
+}
+
+// outstanding removes settled positions in place, preserving the order.
+func outstanding(list []position) []position {
+	result := list[:0]
+	for _, p := range list {
+		if p.amount != 0 {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// largest moves the position with largest amount to the front, ties
+// broken by member. Order of the rest of list is not preserved.
+func largest(list []position) {
+	top := 0
+	for i, p := range list {
+		if p.amount > list[top].amount ||
+			p.amount == list[top].amount && p.member < list[top].member {
+			top = i
+		}
+	}
+	list[0], list[top] = list[top], list[0]
+}
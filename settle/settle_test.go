@@ -0,0 +1,202 @@
+package settle_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"testing/quick"
+
+	"github.com/manojnakp/scount/settle"
+)
+
+func TestPlan(t *testing.T) {
+	tests := []struct {
+		name     string
+		balances []settle.Balance
+		want     []settle.Transfer
+		err      error
+	}{
+		{
+			name:     "no balances",
+			balances: nil,
+			want:     []settle.Transfer{},
+		},
+		{
+			name: "already settled",
+			balances: []settle.Balance{
+				{Member: "alice", Currency: "EUR", Amount: 0},
+				{Member: "bob", Currency: "EUR", Amount: 0},
+			},
+			want: []settle.Transfer{},
+		},
+		{
+			name: "merged per member",
+			balances: []settle.Balance{
+				{Member: "alice", Currency: "EUR", Amount: 500},
+				{Member: "bob", Currency: "EUR", Amount: -300},
+				{Member: "alice", Currency: "EUR", Amount: -500},
+				{Member: "bob", Currency: "EUR", Amount: 300},
+			},
+			want: []settle.Transfer{},
+		},
+		{
+			name: "single debt",
+			balances: []settle.Balance{
+				{Member: "alice", Currency: "EUR", Amount: 1000},
+				{Member: "bob", Currency: "EUR", Amount: -1000},
+			},
+			want: []settle.Transfer{
+				{From: "bob", To: "alice", Currency: "EUR", Amount: 1000},
+			},
+		},
+		{
+			// greedy alone would take 4 transfers: a→c, b→d, a→e, b→e
+			name: "exact match paired first",
+			balances: []settle.Balance{
+				{Member: "a", Currency: "EUR", Amount: -5},
+				{Member: "b", Currency: "EUR", Amount: -4},
+				{Member: "c", Currency: "EUR", Amount: 4},
+				{Member: "d", Currency: "EUR", Amount: 3},
+				{Member: "e", Currency: "EUR", Amount: 2},
+			},
+			want: []settle.Transfer{
+				{From: "b", To: "c", Currency: "EUR", Amount: 4},
+				{From: "a", To: "d", Currency: "EUR", Amount: 3},
+				{From: "a", To: "e", Currency: "EUR", Amount: 2},
+			},
+		},
+		{
+			name: "largest debtor pays largest creditor",
+			balances: []settle.Balance{
+				{Member: "alice", Currency: "EUR", Amount: 700},
+				{Member: "bob", Currency: "EUR", Amount: 200},
+				{Member: "carol", Currency: "EUR", Amount: -400},
+				{Member: "dave", Currency: "EUR", Amount: -500},
+			},
+			want: []settle.Transfer{
+				{From: "dave", To: "alice", Currency: "EUR", Amount: 500},
+				{From: "carol", To: "alice", Currency: "EUR", Amount: 200},
+				{From: "carol", To: "bob", Currency: "EUR", Amount: 200},
+			},
+		},
+		{
+			name: "multi-currency",
+			balances: []settle.Balance{
+				{Member: "alice", Currency: "USD", Amount: -250},
+				{Member: "bob", Currency: "USD", Amount: 250},
+				{Member: "alice", Currency: "EUR", Amount: 1000},
+				{Member: "bob", Currency: "EUR", Amount: -1000},
+			},
+			want: []settle.Transfer{
+				{From: "bob", To: "alice", Currency: "EUR", Amount: 1000},
+				{From: "alice", To: "bob", Currency: "USD", Amount: 250},
+			},
+		},
+		{
+			name: "unbalanced",
+			balances: []settle.Balance{
+				{Member: "alice", Currency: "EUR", Amount: 1000},
+				{Member: "bob", Currency: "EUR", Amount: -999},
+			},
+			err: settle.ErrUnbalanced,
+		},
+		{
+			name: "unbalanced in one currency",
+			balances: []settle.Balance{
+				{Member: "alice", Currency: "EUR", Amount: 1000},
+				{Member: "bob", Currency: "EUR", Amount: -1000},
+				{Member: "alice", Currency: "USD", Amount: 1},
+			},
+			err: settle.ErrUnbalanced,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := settle.Plan(tt.balances)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Plan() error = %v, want %v", err, tt.err)
+			}
+			if tt.err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Plan() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestPlanSettles checks that applying the plan zeroes every balance,
+// using at most n-1 transfers per currency for n members with non-zero
+// balance.
+func TestPlanSettles(t *testing.T) {
+	property := func(eur, usd []int16) bool {
+		balances := append(balanced("EUR", eur), balanced("USD", usd)...)
+		transfers, err := settle.Plan(balances)
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		// net position per currency per member
+		ledger := make(map[string]map[string]int64)
+		for _, b := range balances {
+			if ledger[b.Currency] == nil {
+				ledger[b.Currency] = make(map[string]int64)
+			}
+			ledger[b.Currency][b.Member] += b.Amount
+		}
+		count := make(map[string]int)
+		for _, tr := range transfers {
+			if tr.Amount <= 0 || tr.From == tr.To {
+				t.Logf("invalid transfer %+v", tr)
+				return false
+			}
+			ledger[tr.Currency][tr.From] += tr.Amount
+			ledger[tr.Currency][tr.To] -= tr.Amount
+			count[tr.Currency]++
+		}
+		for currency, members := range ledger {
+			for _, amount := range members {
+				if amount != 0 {
+					t.Logf("%s not settled: %v", currency, members)
+					return false
+				}
+			}
+			owing := nonZero(balances, currency)
+			if owing > 0 && count[currency] > owing-1 {
+				t.Logf("%s: %d transfers for %d members", currency, count[currency], owing)
+				return false
+			}
+		}
+		return true
+	}
+	err := quick.Check(property, nil)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// balanced gives the balances of members in currency from amounts, with
+// one more member whose balance makes them add up to zero.
+func balanced(currency string, amounts []int16) []settle.Balance {
+	balances := make([]settle.Balance, 0, len(amounts)+1)
+	var sum int64
+	for i, amount := range amounts {
+		balances = append(balances, settle.Balance{
+			Member:   fmt.Sprint("m", i),
+			Currency: currency,
+			Amount:   int64(amount),
+		})
+		sum += int64(amount)
+	}
+	return append(balances, settle.Balance{Member: "last", Currency: currency, Amount: -sum})
+}
+
+// nonZero counts the members with non-zero balance in currency.
+func nonZero(balances []settle.Balance, currency string) int {
+	count := 0
+	for _, b := range balances {
+		if b.Currency == currency && b.Amount != 0 {
+			count++
+		}
+	}
+	return count
+}